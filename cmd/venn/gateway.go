@@ -6,8 +6,9 @@ import (
 
 	"github.com/gfx-labs/venn/lib/config"
 	"github.com/gfx-labs/venn/svc/app/gateway"
+	"github.com/gfx-labs/venn/svc/gateway/quarks/apikeys"
 	"github.com/gfx-labs/venn/svc/gateway/quarks/telemetry"
-	"github.com/gfx-labs/venn/svc/gateway/services/gnat"
+	"github.com/gfx-labs/venn/svc/shared/services/gnat"
 	"github.com/gfx-labs/venn/svc/shared/services/prom"
 	"github.com/gfx-labs/venn/svc/shared/services/redi"
 	"gfx.cafe/open/jrpc/contrib/extension/subscription"
@@ -43,6 +44,7 @@ func (o *StartGateway) Run() error {
 		// simple services (quarks)
 		fx.Provide(
 			telemetry.New,
+			apikeys.New,
 		),
 		// middlewares
 		fx.Provide(
@@ -8,16 +8,21 @@ import (
 	"github.com/gfx-labs/venn/svc/app/node"
 	"github.com/gfx-labs/venn/svc/node/atoms/cacher"
 	"github.com/gfx-labs/venn/svc/node/atoms/election"
+	"github.com/gfx-labs/venn/svc/node/atoms/headoracle"
 	"github.com/gfx-labs/venn/svc/node/atoms/headstoreProvider"
 	"github.com/gfx-labs/venn/svc/node/atoms/stalker"
 	"github.com/gfx-labs/venn/svc/node/atoms/subcenter"
 	"github.com/gfx-labs/venn/svc/node/atoms/vennstore"
+	"github.com/gfx-labs/venn/svc/node/middlewares/deduper"
 	"github.com/gfx-labs/venn/svc/node/middlewares/headreplacer"
 	"github.com/gfx-labs/venn/svc/node/middlewares/promcollect"
 	"github.com/gfx-labs/venn/svc/node/quarks/cluster"
+	"github.com/gfx-labs/venn/svc/node/stores/headstores/natshead"
 	"github.com/gfx-labs/venn/svc/node/stores/headstores/redihead"
 	"github.com/gfx-labs/venn/svc/node/stores/vennstores/chainblock"
+	"github.com/gfx-labs/venn/svc/node/stores/vennstores/diskblock"
 	"github.com/gfx-labs/venn/svc/node/stores/vennstores/rediblock"
+	"github.com/gfx-labs/venn/svc/shared/services/gnat"
 	"github.com/gfx-labs/venn/svc/shared/services/prom"
 	"github.com/gfx-labs/venn/svc/shared/services/redi"
 	"gfx.cafe/open/jrpc/contrib/extension/subscription"
@@ -48,6 +53,7 @@ func (o *StartNode) Run() error {
 		fx.Provide(
 			prom.New,
 			redi.New,
+			gnat.New,
 		),
 		// simple services (quarks)
 		fx.Provide(
@@ -58,13 +64,16 @@ func (o *StartNode) Run() error {
 		fx.Provide(
 			chainblock.New,
 			rediblock.New,
+			diskblock.New,
 			redihead.New,
+			natshead.New,
 		),
 		// more complicated services (atoms)
 		fx.Provide(
 			headstoreProvider.New,
 			subcenter.New,
 			election.New,
+			headoracle.New,
 			vennstore.New,
 			cacher.New,
 			stalker.New,
@@ -74,6 +83,7 @@ func (o *StartNode) Run() error {
 			NewSubscriptionEngine,
 			// blockland.New,
 			headreplacer.New,
+			deduper.New,
 			promcollect.New,
 		),
 		// http handler
@@ -13,6 +13,8 @@ import (
 	"github.com/gfx-labs/venn/lib/callcenter"
 	"github.com/gfx-labs/venn/lib/config"
 	"github.com/gfx-labs/venn/lib/stores/headstore"
+	"github.com/gfx-labs/venn/svc/node/atoms/headoracle"
+	"github.com/gfx-labs/venn/svc/node/atoms/stalker"
 	"github.com/gfx-labs/venn/svc/node/quarks/cluster"
 )
 
@@ -23,14 +25,18 @@ type Handler struct {
 	chains    map[string]*config.Chain
 	clusters  *cluster.Clusters
 	headstore headstore.Store
+	oracle    *headoracle.HeadOracle
+	stalker   *stalker.Stalker
 	sf        singleflight.Group
 }
 
-func NewHandler(chains map[string]*config.Chain, clusters *cluster.Clusters, headstore headstore.Store) *Handler {
+func NewHandler(chains map[string]*config.Chain, clusters *cluster.Clusters, headstore headstore.Store, oracle *headoracle.HeadOracle, stalker *stalker.Stalker) *Handler {
 	return &Handler{
 		chains:    chains,
 		clusters:  clusters,
 		headstore: headstore,
+		oracle:    oracle,
+		stalker:   stalker,
 	}
 }
 
@@ -106,11 +112,16 @@ func (h *Handler) handleChainDetail(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	owners, self := h.getStalkers(r)
+
 	data := templates.ChainDetailData{
 		ChainInfo: templates.ChainInfo{
 			Name:           chain.Name,
 			ChainID:        uint64(chain.Id),
 			HeadBlock:      uint64(headBlock),
+			OracleHead:     h.getOracleHead(chainName),
+			Stalker:        owners[chainName],
+			StalkerSelf:    owners[chainName] != "" && owners[chainName] == self,
 			Status:         h.getChainStatus(chainName),
 			RemoteCount:    len(remotes),
 			HealthyCount:   healthyCount,
@@ -152,6 +163,7 @@ func (h *Handler) getChainInfos(r *http.Request) []templates.ChainInfo {
 	// Use singleflight to prevent duplicate work
 	result, _, _ := h.sf.Do("getChainInfos", func() (interface{}, error) {
 		chains := make([]templates.ChainInfo, 0, len(h.chains))
+		owners, self := h.getStalkers(r)
 
 		for _, chain := range h.chains {
 			headBlock, _ := h.headstore.Get(r.Context(), chain)
@@ -169,6 +181,9 @@ func (h *Handler) getChainInfos(r *http.Request) []templates.ChainInfo {
 				Name:           chain.Name,
 				ChainID:        uint64(chain.Id),
 				HeadBlock:      uint64(headBlock),
+				OracleHead:     h.getOracleHead(chain.Name),
+				Stalker:        owners[chain.Name],
+				StalkerSelf:    owners[chain.Name] != "" && owners[chain.Name] == self,
 				Status:         h.getChainStatus(chain.Name),
 				RemoteCount:    len(remotes),
 				HealthyCount:   healthyCount,
@@ -220,12 +235,26 @@ func (h *Handler) getRemoteInfos(chainName string, chain *config.Chain, headBloc
 				maxBlockLookBack := int64(0)
 				var requestsPerMin float64
 
-				// Get latest block from validator
+				// Get latest block and oracle lag from validator
 				var lastUpdated time.Time
+				var oracleLag uint64
+				var behind bool
 				if target.Validator != nil {
 					head, updated := target.Validator.GetHead()
 					latestBlock = uint64(head)
 					lastUpdated = updated
+
+					lag, _ := target.Validator.GetLag()
+					oracleLag = uint64(lag)
+					behind = target.Validator.IsBehind()
+				}
+
+				// Get circuit breaker state
+				circuit := callcenter.CircuitClosed
+				var errorRate float64
+				if target.Breaker != nil {
+					circuit = target.Breaker.State()
+					errorRate = target.Breaker.GetErrorRate()
 				}
 
 				// Check if doctor exists and get health status
@@ -283,6 +312,10 @@ func (h *Handler) getRemoteInfos(chainName string, chain *config.Chain, headBloc
 					Priority:         priority,
 					MaxBlockLookback: maxBlockLookBack,
 					RequestsPerMin:   requestsPerMin,
+					OracleLag:        oracleLag,
+					Behind:           behind,
+					Circuit:          circuit,
+					ErrorRate:        errorRate,
 				})
 			}
 		}
@@ -304,6 +337,27 @@ func (h *Handler) getRemoteInfos(chainName string, chain *config.Chain, headBloc
 	return []templates.RemoteInfo{}
 }
 
+// getOracleHead returns the head oracle consensus for the chain, or 0 if it has none
+func (h *Handler) getOracleHead(chainName string) uint64 {
+	if h.oracle == nil {
+		return 0
+	}
+	head, _, _ := h.oracle.Consensus(chainName)
+	return uint64(head)
+}
+
+// getStalkers returns the replica stalking each chain, and the name of this replica
+func (h *Handler) getStalkers(r *http.Request) (map[string]string, string) {
+	if h.stalker == nil {
+		return nil, ""
+	}
+	owners, self, err := h.stalker.Owners(r.Context())
+	if err != nil {
+		return nil, ""
+	}
+	return owners, self
+}
+
 func (h *Handler) getChainStatus(chainName string) callcenter.HealthStatus {
 	if cluster, ok := h.clusters.Remotes[chainName]; ok && cluster != nil {
 		// Check if any remote is healthy
@@ -0,0 +1,141 @@
+package callcenter
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gfx.cafe/open/jrpc/pkg/jsonrpc"
+
+	"github.com/gfx-labs/venn/lib/config"
+	"github.com/gfx-labs/venn/svc/shared/services/prom"
+)
+
+// Batcher coalesces concurrent requests to a remote into JSON-RPC batches. a batch is sent once it is full, or once
+// the linger window since its first request has passed. every caller gets back its own result or error, so failures of
+// single items are still seen by the middlewares of that request.
+type Batcher struct {
+	chain   string
+	remote  string
+	maxSize int
+	linger  time.Duration
+
+	pending *batch
+	mu      sync.Mutex
+}
+
+type batch struct {
+	conn  jsonrpc.Conn
+	calls []*batchCall
+	timer *time.Timer
+}
+
+type batchCall struct {
+	ctx    context.Context
+	elem   *jsonrpc.BatchElem
+	result json.RawMessage
+	done   chan struct{}
+}
+
+// NewBatcher creates a batcher for the remote. It returns nil if batching is not configured.
+func NewBatcher(chain string, remote string, cfg *config.Batch) *Batcher {
+	if cfg == nil {
+		return nil
+	}
+	return &Batcher{
+		chain:   chain,
+		remote:  remote,
+		maxSize: cfg.MaxSize,
+		linger:  cfg.Linger.Duration,
+	}
+}
+
+// Do adds the request to the pending batch and waits for its result
+func (T *Batcher) Do(ctx context.Context, conn jsonrpc.Conn, method string, params any) (json.RawMessage, error) {
+	call := &batchCall{
+		ctx:  ctx,
+		done: make(chan struct{}),
+	}
+	call.elem = &jsonrpc.BatchElem{
+		Method: method,
+		Params: params,
+		Result: &call.result,
+	}
+
+	T.mu.Lock()
+	if T.pending == nil {
+		b := &batch{conn: conn}
+		b.timer = time.AfterFunc(T.linger, func() {
+			T.mu.Lock()
+			if T.pending != b {
+				// already sent because it filled up
+				T.mu.Unlock()
+				return
+			}
+			T.pending = nil
+			T.mu.Unlock()
+			T.send(b)
+		})
+		T.pending = b
+	}
+	b := T.pending
+	b.calls = append(b.calls, call)
+	full := len(b.calls) >= T.maxSize
+	if full {
+		T.pending = nil
+		b.timer.Stop()
+	}
+	T.mu.Unlock()
+
+	if full {
+		go T.send(b)
+	}
+
+	select {
+	case <-call.done:
+		return call.result, call.elem.Error
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// send sends the batch. the request is only cancelled once every caller in the batch has given up.
+func (T *Batcher) send(b *batch) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var remaining atomic.Int64
+	remaining.Store(int64(len(b.calls)))
+	elems := make([]*jsonrpc.BatchElem, 0, len(b.calls))
+	for _, call := range b.calls {
+		stop := context.AfterFunc(call.ctx, func() {
+			if remaining.Add(-1) == 0 {
+				cancel()
+			}
+		})
+		defer stop()
+		elems = append(elems, call.elem)
+	}
+
+	prom.Batches.Size(prom.BatchLabel{
+		Chain:  T.chain,
+		Remote: T.remote,
+	}).Observe(float64(len(elems)))
+
+	if err := b.conn.BatchCall(ctx, elems...); err != nil {
+		// the whole batch failed, so every request in it did
+		for _, elem := range elems {
+			elem.Error = err
+		}
+	}
+	for _, call := range b.calls {
+		// a remote may leave requests out of its answer. a null result is still written out, so nothing at all means
+		// there was no response
+		if call.elem.Error == nil && len(call.result) == 0 {
+			call.elem.Error = ErrMissingBatchResponse
+		}
+		close(call.done)
+	}
+}
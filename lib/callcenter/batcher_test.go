@@ -0,0 +1,113 @@
+package callcenter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"gfx.cafe/open/jrpc/pkg/jsonrpc"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gfx-labs/venn/lib/config"
+)
+
+// testBatchConn answers every batch with respond, and records the size of the batches
+type testBatchConn struct {
+	respond func(elems []*jsonrpc.BatchElem) error
+	sizes   []int
+	mu      sync.Mutex
+}
+
+func (T *testBatchConn) Do(context.Context, any, string, any) error {
+	return errors.New("not batched")
+}
+
+func (T *testBatchConn) BatchCall(_ context.Context, elems ...*jsonrpc.BatchElem) error {
+	T.mu.Lock()
+	T.sizes = append(T.sizes, len(elems))
+	T.mu.Unlock()
+	return T.respond(elems)
+}
+
+func (T *testBatchConn) Close() error {
+	return nil
+}
+
+func (T *testBatchConn) Closed() <-chan struct{} {
+	return nil
+}
+
+// doBatch makes the calls through the batcher at once, and returns their results and errors in order
+func doBatch(b *Batcher, conn jsonrpc.Conn, methods ...string) ([]json.RawMessage, []error) {
+	results := make([]json.RawMessage, len(methods))
+	errs := make([]error, len(methods))
+	var wg sync.WaitGroup
+	for i, method := range methods {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = b.Do(context.Background(), conn, method, nil)
+		}()
+	}
+	wg.Wait()
+	return results, errs
+}
+
+func TestBatcher(t *testing.T) {
+	b := NewBatcher("test", "remote", &config.Batch{MaxSize: 3, Linger: config.Duration{Duration: time.Second}})
+	conn := &testBatchConn{respond: func(elems []*jsonrpc.BatchElem) error {
+		for _, elem := range elems {
+			switch elem.Method {
+			case "eth_chainId":
+				*elem.Result.(*json.RawMessage) = json.RawMessage(`"0x1"`)
+			case "eth_getBlockByHash":
+				*elem.Result.(*json.RawMessage) = json.RawMessage(`null`)
+			default:
+				elem.Error = jsonrpc.NewInvalidRequestError("method not found")
+			}
+		}
+		return nil
+	}}
+
+	// the batch is sent as soon as it is full, and every caller gets its own answer
+	results, errs := doBatch(b, conn, "eth_chainId", "eth_getBlockByHash", "eth_foo")
+	require.Equal(t, []int{3}, conn.sizes)
+	require.NoError(t, errs[0])
+	require.JSONEq(t, `"0x1"`, string(results[0]))
+	require.NoError(t, errs[1])
+	require.JSONEq(t, `null`, string(results[1]))
+	require.Error(t, errs[2])
+}
+
+func TestBatcher_MissingResponse(t *testing.T) {
+	b := NewBatcher("test", "remote", &config.Batch{MaxSize: 2, Linger: config.Duration{Duration: time.Second}})
+	conn := &testBatchConn{respond: func(elems []*jsonrpc.BatchElem) error {
+		// the remote only answers the first request
+		*elems[0].Result.(*json.RawMessage) = json.RawMessage(`"0x1"`)
+		return nil
+	}}
+
+	results, errs := doBatch(b, conn, "eth_chainId", "eth_chainId")
+	require.ElementsMatch(t, []error{nil, ErrMissingBatchResponse}, errs)
+	for i, err := range errs {
+		if err == nil {
+			require.JSONEq(t, `"0x1"`, string(results[i]))
+		}
+	}
+}
+
+func TestBatcher_Linger(t *testing.T) {
+	b := NewBatcher("test", "remote", &config.Batch{MaxSize: 10, Linger: config.Duration{Duration: 10 * time.Millisecond}})
+	failed := errors.New("failed")
+	conn := &testBatchConn{respond: func([]*jsonrpc.BatchElem) error {
+		return failed
+	}}
+
+	// a batch which does not fill up is sent after the linger window, and a failed batch fails every request in it
+	_, errs := doBatch(b, conn, "eth_chainId", "eth_chainId")
+	require.Equal(t, []error{failed, failed}, errs)
+	require.Equal(t, []int{2}, conn.sizes)
+}
@@ -0,0 +1,302 @@
+package callcenter
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"gfx.cafe/open/jrpc"
+	"gfx.cafe/open/jrpc/pkg/jsonrpc"
+	"github.com/asecurityteam/rolling"
+
+	"github.com/gfx-labs/venn/lib/config"
+	"github.com/gfx-labs/venn/lib/jrpcutil"
+	"github.com/gfx-labs/venn/lib/util"
+	"github.com/gfx-labs/venn/svc/shared/services/prom"
+)
+
+type CircuitState int
+
+const (
+	// CircuitClosed lets all requests through
+	CircuitClosed CircuitState = iota
+	// CircuitHalfOpen lets a limited number of probe requests through to test if the remote has recovered
+	CircuitHalfOpen
+	// CircuitOpen rejects all requests because the remote is failing
+	CircuitOpen
+	// CircuitRateLimited rejects all requests because the remote is rate limiting us
+	CircuitRateLimited
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitHalfOpen:
+		return "half-open"
+	case CircuitOpen:
+		return "open"
+	case CircuitRateLimited:
+		return "rate-limited"
+	default:
+		return "unknown"
+	}
+}
+
+// breakerBuckets is the number of buckets the error rate window is split into
+const breakerBuckets = 100
+
+// Breaker is a circuit breaker for a particular remote. it opens when the error rate over a sliding window is too
+// high, and after a backoff lets a few probe requests through before closing again. rate limits open the circuit
+// separately, for a fixed duration.
+type Breaker struct {
+	chain  string
+	remote string
+
+	rateLimitTimeout time.Duration
+	errorMinTimeout  time.Duration
+	errorMaxTimeout  time.Duration
+
+	errorRate   float64
+	minRequests int
+	probes      int
+	window      time.Duration
+
+	log *slog.Logger
+
+	state   CircuitState
+	until   time.Time
+	timeout time.Duration
+	// outcomes holds a 1 for every failed request and a 0 for every successful one
+	outcomes *rolling.TimePolicy
+	inFlight int
+	passed   int
+	mu       sync.Mutex
+}
+
+func NewBreaker(
+	log *slog.Logger,
+	chain string,
+	remote string,
+	rateLimitTimeout time.Duration,
+	errorMinTimeout time.Duration,
+	errorMaxTimeout time.Duration,
+	circuit config.Circuit,
+) *Breaker {
+	breaker := &Breaker{
+		chain:  chain,
+		remote: remote,
+		log:    log,
+
+		rateLimitTimeout: rateLimitTimeout,
+		errorMinTimeout:  errorMinTimeout,
+		errorMaxTimeout:  errorMaxTimeout,
+
+		errorRate:   circuit.ErrorRate,
+		minRequests: circuit.MinRequests,
+		probes:      max(circuit.Probes, 1),
+		window:      circuit.Window.Duration,
+
+		timeout: errorMinTimeout,
+	}
+	breaker.resetWindow()
+	breaker.updateMetrics()
+	return breaker
+}
+
+func (T *Breaker) resetWindow() {
+	T.outcomes = rolling.NewTimePolicy(rolling.NewWindow(breakerBuckets), max(T.window/breakerBuckets, time.Millisecond))
+}
+
+// State returns the current state of the circuit
+func (T *Breaker) State() CircuitState {
+	T.mu.Lock()
+	defer T.mu.Unlock()
+
+	T.refresh()
+	return T.state
+}
+
+// GetErrorRate returns the fraction of requests which failed within the window
+func (T *Breaker) GetErrorRate() float64 {
+	T.mu.Lock()
+	defer T.mu.Unlock()
+
+	return T.currentErrorRate()
+}
+
+func (T *Breaker) currentErrorRate() float64 {
+	var requests, failures float64
+	T.outcomes.Reduce(func(w rolling.Window) float64 {
+		requests = rolling.Count(w)
+		failures = rolling.Sum(w)
+		return 0
+	})
+	if requests == 0 {
+		return 0
+	}
+	return failures / requests
+}
+
+// refresh moves the circuit out of the open and rate limited states once their timeout has passed. must be called
+// with the lock held.
+func (T *Breaker) refresh() {
+	if T.until.IsZero() || time.Now().Before(T.until) {
+		return
+	}
+	switch T.state {
+	case CircuitOpen:
+		T.transition(CircuitHalfOpen, "backoff elapsed")
+	case CircuitRateLimited:
+		T.transition(CircuitClosed, "rate limit backoff elapsed")
+	}
+}
+
+// transition changes the state of the circuit. must be called with the lock held.
+func (T *Breaker) transition(to CircuitState, reason string) {
+	from := T.state
+	if from == to {
+		return
+	}
+	T.state = to
+	T.inFlight = 0
+	T.passed = 0
+
+	switch to {
+	case CircuitClosed:
+		T.until = time.Time{}
+		T.timeout = T.errorMinTimeout
+		T.resetWindow()
+	case CircuitHalfOpen:
+		T.until = time.Time{}
+	case CircuitOpen:
+		T.until = time.Now().Add(T.timeout)
+	case CircuitRateLimited:
+		T.until = time.Now().Add(T.rateLimitTimeout)
+	}
+
+	if to == CircuitClosed || to == CircuitHalfOpen {
+		T.log.Info("circuit state changed", "from", from, "to", to, "reason", reason)
+	} else {
+		T.log.Warn("circuit state changed", "from", from, "to", to, "reason", reason, "until", T.until)
+	}
+
+	prom.RemoteHealth.CircuitTransitions(prom.CircuitLabel{
+		Chain:  T.chain,
+		Remote: T.remote,
+		State:  to.String(),
+	}).Inc()
+	T.updateMetrics()
+}
+
+func (T *Breaker) updateMetrics() {
+	prom.RemoteHealth.CircuitState(prom.RemoteHealthLabel{
+		Chain:  T.chain,
+		Remote: T.remote,
+	}).Set(float64(T.state))
+}
+
+// allow returns whether a request may be sent to the remote, and whether that request is a half-open probe
+func (T *Breaker) allow() (ok bool, probe bool) {
+	T.mu.Lock()
+	defer T.mu.Unlock()
+
+	T.refresh()
+	switch T.state {
+	case CircuitClosed:
+		return true, false
+	case CircuitHalfOpen:
+		if T.inFlight+T.passed >= T.probes {
+			return false, false
+		}
+		T.inFlight++
+		return true, true
+	default:
+		return false, false
+	}
+}
+
+func (T *Breaker) ok(probe bool) {
+	T.mu.Lock()
+	defer T.mu.Unlock()
+
+	switch {
+	case probe && T.state == CircuitHalfOpen:
+		T.inFlight = max(T.inFlight-1, 0)
+		T.passed++
+		if T.passed >= T.probes {
+			T.transition(CircuitClosed, "probes succeeded")
+		}
+	case T.state == CircuitClosed:
+		T.outcomes.Append(0)
+	}
+}
+
+func (T *Breaker) limit(probe bool) {
+	T.mu.Lock()
+	defer T.mu.Unlock()
+
+	if T.state != CircuitClosed && !(probe && T.state == CircuitHalfOpen) {
+		return
+	}
+	T.transition(CircuitRateLimited, "rate limited")
+}
+
+func (T *Breaker) error(probe bool) {
+	T.mu.Lock()
+	defer T.mu.Unlock()
+
+	switch {
+	case probe && T.state == CircuitHalfOpen:
+		// the remote has not recovered, so back off for longer
+		T.timeout = min(T.errorMaxTimeout, T.timeout*2)
+		T.transition(CircuitOpen, "probe failed")
+	case T.state == CircuitClosed:
+		T.outcomes.Append(1)
+		var requests float64
+		T.outcomes.Reduce(func(w rolling.Window) float64 {
+			requests = rolling.Count(w)
+			return 0
+		})
+		if requests < float64(T.minRequests) {
+			return
+		}
+		if rate := T.currentErrorRate(); rate >= T.errorRate {
+			T.transition(CircuitOpen, fmt.Sprintf("error rate %.0f%% over %s", rate*100, T.window))
+		}
+	}
+}
+
+func (T *Breaker) Middleware(next jrpc.Handler) jrpc.Handler {
+	return jrpc.HandlerFunc(func(w jrpc.ResponseWriter, r *jrpc.Request) {
+		ok, probe := T.allow()
+		if !ok {
+			err := jsonrpc.NewInternalError("remote is unhealthy (circuit open)")
+			_ = w.Send(nil, err)
+			return
+		}
+
+		var icept jrpcutil.Interceptor
+		next.ServeRPC(&icept, r)
+
+		if icept.Error != nil {
+			if util.IsUserError(icept.Error) {
+				// node is ok
+				T.ok(probe)
+			} else if util.IsTimeoutError(icept.Error) {
+				T.limit(probe)
+			} else if util.IsNodeError(icept.Error) {
+				T.log.Error("node error", "type", fmt.Sprintf("%T", icept.Error), "error", icept.Error)
+				T.error(probe)
+			} else {
+				// unknown error, it's fine
+				T.ok(probe)
+			}
+		} else {
+			T.ok(probe)
+		}
+
+		_ = w.Send(icept.Result, icept.Error)
+	})
+}
@@ -0,0 +1,189 @@
+package callcenter
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"gfx.cafe/open/jrpc"
+	"gfx.cafe/open/jrpc/pkg/jsonrpc"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gfx-labs/venn/lib/config"
+	"github.com/gfx-labs/venn/lib/jrpcutil"
+)
+
+func newTestBreaker(circuit config.Circuit) *Breaker {
+	return NewBreaker(
+		slog.New(slog.NewJSONHandler(io.Discard, nil)),
+		"test",
+		"remote",
+		time.Minute,
+		time.Second,
+		3*time.Second,
+		circuit,
+	)
+}
+
+// elapse lets the backoff of the breaker pass
+func elapse(b *Breaker) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.until = time.Now().Add(-time.Millisecond)
+}
+
+func TestBreaker_OpensOnErrorRate(t *testing.T) {
+	b := newTestBreaker(config.Circuit{
+		ErrorRate:   0.5,
+		MinRequests: 4,
+		Window:      config.Duration{Duration: time.Minute},
+	})
+
+	// the error rate is not considered until there are enough requests
+	b.error(false)
+	b.error(false)
+	b.error(false)
+	require.Equal(t, CircuitClosed, b.State())
+	b.ok(false)
+	// 3 of 4 failed, but the error rate is only checked on failures
+	require.Equal(t, CircuitClosed, b.State())
+	b.error(false)
+	require.Equal(t, CircuitOpen, b.State())
+	require.InDelta(t, 0.8, b.GetErrorRate(), 1e-9)
+
+	ok, _ := b.allow()
+	require.False(t, ok)
+}
+
+func TestBreaker_StaysClosedBelowErrorRate(t *testing.T) {
+	b := newTestBreaker(config.Circuit{
+		ErrorRate:   0.5,
+		MinRequests: 4,
+		Window:      config.Duration{Duration: time.Minute},
+	})
+	for range 10 {
+		b.ok(false)
+		b.ok(false)
+		b.error(false)
+	}
+	require.Equal(t, CircuitClosed, b.State())
+	require.InDelta(t, 1.0/3, b.GetErrorRate(), 1e-9)
+}
+
+func TestBreaker_HalfOpenProbes(t *testing.T) {
+	b := newTestBreaker(config.Circuit{
+		ErrorRate:   0.5,
+		MinRequests: 1,
+		Window:      config.Duration{Duration: time.Minute},
+		Probes:      2,
+	})
+	b.error(false)
+	require.Equal(t, CircuitOpen, b.State())
+
+	elapse(b)
+	require.Equal(t, CircuitHalfOpen, b.State())
+
+	// only as many probes as configured are let through at a time
+	for range 2 {
+		ok, probe := b.allow()
+		require.True(t, ok)
+		require.True(t, probe)
+	}
+	ok, _ := b.allow()
+	require.False(t, ok)
+
+	b.ok(true)
+	require.Equal(t, CircuitHalfOpen, b.State())
+	// a probe which passed still counts against the probes
+	ok, _ = b.allow()
+	require.False(t, ok)
+
+	b.ok(true)
+	require.Equal(t, CircuitClosed, b.State())
+	// the error rate starts over once closed
+	require.Zero(t, b.GetErrorRate())
+	ok, probe := b.allow()
+	require.True(t, ok)
+	require.False(t, probe)
+}
+
+func TestBreaker_TimeoutDoubles(t *testing.T) {
+	b := newTestBreaker(config.Circuit{
+		ErrorRate:   0.5,
+		MinRequests: 1,
+		Window:      config.Duration{Duration: time.Minute},
+	})
+	b.error(false)
+	require.Equal(t, CircuitOpen, b.State())
+	require.Equal(t, time.Second, b.timeout)
+
+	// every failed probe doubles the backoff, up to the maximum
+	for _, want := range []time.Duration{2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		elapse(b)
+		ok, probe := b.allow()
+		require.True(t, ok)
+		require.True(t, probe)
+		b.error(true)
+		require.Equal(t, CircuitOpen, b.State())
+		require.Equal(t, want, b.timeout)
+		require.WithinDuration(t, time.Now().Add(want), b.until, 100*time.Millisecond)
+	}
+
+	// and closing resets it
+	elapse(b)
+	_, probe := b.allow()
+	b.ok(probe)
+	require.Equal(t, CircuitClosed, b.State())
+	require.Equal(t, time.Second, b.timeout)
+}
+
+func TestBreaker_RateLimited(t *testing.T) {
+	b := newTestBreaker(config.Circuit{
+		ErrorRate:   0.5,
+		MinRequests: 1,
+		Window:      config.Duration{Duration: time.Minute},
+	})
+	b.limit(false)
+	require.Equal(t, CircuitRateLimited, b.State())
+	require.WithinDuration(t, time.Now().Add(time.Minute), b.until, 100*time.Millisecond)
+
+	// errors do not change a rate limited circuit
+	b.error(false)
+	require.Equal(t, CircuitRateLimited, b.State())
+
+	elapse(b)
+	require.Equal(t, CircuitClosed, b.State())
+}
+
+func TestBreaker_MiddlewareRejectsWhenOpen(t *testing.T) {
+	b := newTestBreaker(config.Circuit{
+		ErrorRate:   0.5,
+		MinRequests: 1,
+		Window:      config.Duration{Duration: time.Minute},
+	})
+	var calls int
+	h := b.Middleware(jrpc.HandlerFunc(func(w jrpc.ResponseWriter, r *jrpc.Request) {
+		calls++
+		_ = w.Send("ok", nil)
+	}))
+	serve := func() error {
+		r, err := jsonrpc.NewRequest(context.Background(), jsonrpc.NewNullIDPtr(), "eth_chainId", nil)
+		require.NoError(t, err)
+		var icept jrpcutil.Interceptor
+		h.ServeRPC(&icept, r)
+		return icept.Error
+	}
+
+	require.NoError(t, serve())
+	b.error(false)
+	require.Error(t, serve())
+	require.Equal(t, 1, calls)
+
+	// the request after the backoff is a probe, which closes the circuit again
+	elapse(b)
+	require.NoError(t, serve())
+	require.Equal(t, 2, calls)
+	require.Equal(t, CircuitClosed, b.State())
+}
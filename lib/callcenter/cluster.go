@@ -2,10 +2,12 @@ package callcenter
 
 import (
 	"cmp"
+	"context"
 	"errors"
 	"slices"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"gfx.cafe/open/jrpc/pkg/jsonrpc"
 
@@ -15,6 +17,8 @@ import (
 
 // Cluster combines multiple remotes and attempts each by priority.
 type Cluster struct {
+	strategy       Strategy
+	hedger         *Hedger
 	priorities     []*clustererPriority
 	remotes        []*RemoteWithConfig
 	remotePriority []int
@@ -27,8 +31,15 @@ type clustererPriority struct {
 	round    atomic.Int64
 }
 
-func NewCluster() *Cluster {
-	return &Cluster{}
+// NewCluster creates a cluster. a nil strategy defaults to round-robin, and a nil hedger disables hedging.
+func NewCluster(strategy Strategy, hedger *Hedger) *Cluster {
+	if strategy == nil {
+		strategy = RoundRobin{}
+	}
+	return &Cluster{
+		strategy: strategy,
+		hedger:   hedger,
+	}
 }
 
 func (T *Cluster) Add(priority int, remote *RemoteWithConfig) {
@@ -73,49 +84,169 @@ func (T *Cluster) Remotes() []*RemoteWithConfig {
 	return T.remotes
 }
 
+// order returns the remotes in the order they should be attempted. priorities are attempted in order, and the
+// remotes within each priority are ordered by the strategy. remotes which are behind the chain head are moved to the
+// end, regardless of priority.
+func (T *Cluster) order() []*RemoteWithConfig {
+	order := make([]*RemoteWithConfig, 0, len(T.remotes))
+	var behind []*RemoteWithConfig
+	for _, p := range T.priorities {
+		start := len(order)
+		order = append(order, p.remotes...)
+		tier := order[start:]
+		if len(tier) > 1 {
+			T.strategy.Order(tier, p.round.Add(1))
+		}
+
+		// move any behind remotes out of the tier
+		kept := tier[:0]
+		for _, rem := range tier {
+			if rem.IsBehind() {
+				behind = append(behind, rem)
+				continue
+			}
+			kept = append(kept, rem)
+		}
+		order = order[:start+len(kept)]
+	}
+	return append(order, behind...)
+}
+
 func (T *Cluster) ServeRPC(w jsonrpc.ResponseWriter, r *jsonrpc.Request) {
 	T.mu.RLock()
 	defer T.mu.RUnlock()
 
+	order := T.order()
+	if len(order) > 1 && T.hedger.Enabled(r.Method) {
+		T.serveHedged(w, r, order)
+		return
+	}
+
 	var icept jrpcutil.Interceptor
-	for i, p := range T.priorities {
-		j := 0
-		if len(p.remotes) > 1 {
-			j = int(p.round.Add(1))
-		}
+	for i, rem := range order {
+		rem.Handler.ServeRPC(&icept, r)
+		if icept.Error != nil {
 
-		for k := 0; k < len(p.remotes); k++ {
-			j++
-			rem := p.remotes[j%len(p.remotes)]
+			// check if error is a user error
+			if util.IsUserError(icept.Error) {
+				_ = w.Send(nil, icept.Error)
+				return
+			}
 
-			rem.Handler.ServeRPC(&icept, r)
-			if icept.Error != nil {
+			// check if last possible remote. if not, try the other ones
+			if i != len(order)-1 {
+				continue
+			}
 
-				// check if error is a user error
-				if util.IsUserError(icept.Error) {
-					_ = w.Send(nil, icept.Error)
-					return
-				}
+			// if it's a head old error, just send the data we got
+			if errors.Is(icept.Error, ErrHeadOld) {
+				_ = w.Send(icept.Result, nil)
+				return
+			}
 
-				// check if last possible remote. if not, try the other ones
-				if i != len(T.priorities)-1 || k != len(p.remotes)-1 {
-					continue
-				}
+			_ = w.Send(nil, icept.Error)
+			return
+		}
 
-				// if it's a head old error, just send the data we got
-				if errors.Is(icept.Error, ErrHeadOld) {
-					_ = w.Send(icept.Result, nil)
-					return
-				}
+		if icept.Result != nil {
+			_ = w.Send(icept.Result, nil)
+			return
+		}
+	}
+}
 
-				_ = w.Send(nil, icept.Error)
-				return
+type hedgeAttempt struct {
+	idx     int
+	latency time.Duration
+	result  any
+	err     error
+}
+
+// serveHedged attempts the remotes in order like ServeRPC, but if a remote has not answered within the hedge delay, the
+// request is also sent to the next remote. the first successful answer is sent and the other attempt is canceled.
+func (T *Cluster) serveHedged(w jsonrpc.ResponseWriter, r *jsonrpc.Request, order []*RemoteWithConfig) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	results := make(chan hedgeAttempt, len(order))
+	starts := make([]time.Time, len(order))
+	finished := make([]bool, len(order))
+	next := 0
+	launch := func() {
+		idx := next
+		next++
+		starts[idx] = time.Now()
+		go func() {
+			var icept jrpcutil.Interceptor
+			order[idx].Handler.ServeRPC(&icept, r)
+			results <- hedgeAttempt{
+				idx:     idx,
+				latency: time.Since(starts[idx]),
+				result:  icept.Result,
+				err:     icept.Error,
 			}
+		}()
+	}
 
-			if icept.Result != nil {
-				_ = w.Send(icept.Result, nil)
+	delay := T.hedger.Delay(r.Method)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	launch()
+	pending := 1
+	hedge := -1
+	var last hedgeAttempt
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			// only hedge once, so a slow method can at most double the load
+			if hedge == -1 && next < len(order) {
+				hedge = next
+				T.hedger.hedged(r.Method)
+				launch()
+				pending++
+			}
+		case res := <-results:
+			pending--
+			finished[res.idx] = true
+			if res.err == nil && res.result != nil {
+				T.hedger.Observe(r.Method, res.latency)
+				if res.idx == hedge {
+					T.hedger.won(r.Method)
+					// the attempt the hedge beat is at least this slow. leaving it out would only keep the answers
+					// which came in before the delay, and pull the delay down further every time
+					for i := range hedge {
+						if !finished[i] {
+							T.hedger.Observe(r.Method, time.Since(starts[i]))
+						}
+					}
+				}
+				_ = w.Send(res.result, nil)
 				return
 			}
+			if res.err != nil {
+				if util.IsUserError(res.err) {
+					_ = w.Send(nil, res.err)
+					return
+				}
+				last = res
+			}
+			// the attempt failed, so move on to the next remote right away
+			if pending == 0 && next < len(order) {
+				launch()
+				pending++
+				if hedge == -1 {
+					timer.Reset(delay)
+				}
+			}
 		}
 	}
+
+	// if it's a head old error, just send the data we got
+	if errors.Is(last.err, ErrHeadOld) {
+		_ = w.Send(last.result, nil)
+		return
+	}
+	_ = w.Send(nil, last.err)
 }
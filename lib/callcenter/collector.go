@@ -1,6 +1,9 @@
 package callcenter
 
 import (
+	"math"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"gfx.cafe/open/jrpc"
@@ -10,12 +13,23 @@ import (
 	"github.com/asecurityteam/rolling"
 )
 
+// latencyAlpha is the smoothing factor of the latency EWMA
+const latencyAlpha = 0.2
+
+// latencyStale is how long a latency average is trusted without new samples
+const latencyStale = 30 * time.Second
+
 // Collector collects prometheus stats for this particular remote.
 type Collector struct {
 	chain         string
 	name          string
 	requestWindow *rolling.TimePolicy
 	successWindow *rolling.TimePolicy
+
+	inFlight      atomic.Int64
+	latency       float64
+	latencyUpdate time.Time
+	mu            sync.Mutex
 }
 
 func NewCollector(chain, name string) *Collector {
@@ -33,13 +47,16 @@ func (T *Collector) Middleware(next jrpc.Handler) jrpc.Handler {
 
 		// Track request
 		T.requestWindow.Append(1.0)
+		T.inFlight.Add(1)
 
 		var icept jrpcutil.Interceptor
 
 		defer func() {
 			dur := time.Since(start)
+			T.inFlight.Add(-1)
 
 			success := icept.Error == nil
+			T.observeLatency(dur, success)
 
 			// Track success/failure
 			if success {
@@ -63,6 +80,40 @@ func (T *Collector) Middleware(next jrpc.Handler) jrpc.Handler {
 	})
 }
 
+func (T *Collector) observeLatency(dur time.Duration, success bool) {
+	T.mu.Lock()
+	defer T.mu.Unlock()
+
+	sample := float64(dur)
+	if !success {
+		// failures may be fast, but they should never make the remote look faster
+		sample = max(sample, T.latency)
+	}
+	if T.latencyUpdate.IsZero() || time.Since(T.latencyUpdate) > latencyStale {
+		T.latency = sample
+	} else {
+		T.latency = latencyAlpha*sample + (1-latencyAlpha)*T.latency
+	}
+	T.latencyUpdate = time.Now()
+}
+
+// GetLatencyEWMA returns the exponentially weighted moving average of the request latency.
+// It returns 0 if there have been no requests recently.
+func (T *Collector) GetLatencyEWMA() time.Duration {
+	T.mu.Lock()
+	defer T.mu.Unlock()
+
+	if T.latencyUpdate.IsZero() || time.Since(T.latencyUpdate) > latencyStale {
+		return 0
+	}
+	return time.Duration(math.Round(T.latency))
+}
+
+// GetInFlight returns the number of requests currently being served by the remote
+func (T *Collector) GetInFlight() int64 {
+	return T.inFlight.Load()
+}
+
 // GetRequestsPerMinute returns the current requests per minute rate
 func (T *Collector) GetRequestsPerMinute() float64 {
 	return T.requestWindow.Reduce(func(w rolling.Window) float64 {
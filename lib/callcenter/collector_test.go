@@ -0,0 +1,91 @@
+package callcenter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gfx.cafe/open/jrpc"
+	"gfx.cafe/open/jrpc/pkg/jsonrpc"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gfx-labs/venn/lib/jrpcutil"
+)
+
+func TestCollector_LatencyEWMA(t *testing.T) {
+	c := NewCollector("test", "remote")
+	require.Zero(t, c.GetLatencyEWMA())
+
+	// the first sample is taken as is
+	c.observeLatency(100*time.Millisecond, true)
+	require.Equal(t, 100*time.Millisecond, c.GetLatencyEWMA())
+
+	c.observeLatency(200*time.Millisecond, true)
+	require.Equal(t, 120*time.Millisecond, c.GetLatencyEWMA())
+
+	// a fast failure does not make the remote look faster
+	c.observeLatency(time.Millisecond, false)
+	require.Equal(t, 120*time.Millisecond, c.GetLatencyEWMA())
+
+	// a slow failure does make it look slower
+	c.observeLatency(220*time.Millisecond, false)
+	require.Equal(t, 140*time.Millisecond, c.GetLatencyEWMA())
+}
+
+func TestCollector_LatencyStale(t *testing.T) {
+	c := NewCollector("test", "remote")
+	c.observeLatency(100*time.Millisecond, true)
+	c.latencyUpdate = time.Now().Add(-latencyStale - time.Second)
+	require.Zero(t, c.GetLatencyEWMA())
+
+	// a stale average is replaced instead of smoothed
+	c.observeLatency(300*time.Millisecond, true)
+	require.Equal(t, 300*time.Millisecond, c.GetLatencyEWMA())
+}
+
+func TestCollector_Middleware(t *testing.T) {
+	c := NewCollector("test", "remote")
+	fail := errors.New("failed")
+	started := make(chan struct{})
+	release := map[string]chan struct{}{
+		"eth_chainId": make(chan struct{}),
+		"eth_fail":    make(chan struct{}),
+	}
+	h := c.Middleware(jrpc.HandlerFunc(func(w jrpc.ResponseWriter, r *jrpc.Request) {
+		started <- struct{}{}
+		<-release[r.Method]
+		if r.Method == "eth_fail" {
+			_ = w.Send(nil, fail)
+			return
+		}
+		_ = w.Send("ok", nil)
+	}))
+	serve := func(method string) chan error {
+		done := make(chan error, 1)
+		r, err := jsonrpc.NewRequest(context.Background(), jsonrpc.NewNullIDPtr(), method, nil)
+		require.NoError(t, err)
+		go func() {
+			var icept jrpcutil.Interceptor
+			h.ServeRPC(&icept, r)
+			done <- icept.Error
+		}()
+		<-started
+		return done
+	}
+
+	ok := serve("eth_chainId")
+	failed := serve("eth_fail")
+	require.EqualValues(t, 2, c.GetInFlight())
+
+	close(release["eth_chainId"])
+	require.NoError(t, <-ok)
+	require.EqualValues(t, 1, c.GetInFlight())
+	close(release["eth_fail"])
+	require.ErrorIs(t, <-failed, fail)
+	require.Zero(t, c.GetInFlight())
+
+	require.InDelta(t, 2, c.GetRequestsPerMinute(), 1e-9)
+	require.InDelta(t, 50, c.GetSuccessRate(), 1e-9)
+	require.NotZero(t, c.GetLatencyEWMA())
+}
@@ -8,4 +8,6 @@ var (
 	ErrMethodNotAllowed    = jsonrpc.NewInvalidRequestError("method not allowed")
 	ErrHeadJumpedBackwards = jsonrpc.NewInternalError("head jumped backwards")
 	ErrHeadOld             = jsonrpc.NewInternalError("head old")
+	// ErrMissingBatchResponse is the error of a batched request which the remote answered the batch without
+	ErrMissingBatchResponse = jsonrpc.NewInternalError("missing batch response")
 )
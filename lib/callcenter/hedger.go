@@ -0,0 +1,137 @@
+package callcenter
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/asecurityteam/rolling"
+
+	"github.com/gfx-labs/venn/lib/config"
+	"github.com/gfx-labs/venn/svc/shared/services/prom"
+)
+
+// neverHedge are methods which are not safe to send to more than one remote at a time.
+var neverHedge = map[string]bool{
+	"eth_sendRawTransaction": true,
+	"eth_sendTransaction":    true,
+}
+
+const (
+	// hedgeSamples is the number of latency samples kept per method
+	hedgeSamples = 1024
+	// hedgeMinSamples is the number of samples needed before the percentile is trusted over the minimum delay
+	hedgeMinSamples = 32
+	// hedgeRecompute is how often the delay is recomputed from the samples
+	hedgeRecompute = time.Second
+)
+
+// Hedger decides when a request in a Cluster should also be sent to the next remote.
+type Hedger struct {
+	chain      string
+	percentile float64
+	minDelay   time.Duration
+	maxDelay   time.Duration
+
+	methods map[string]*hedgeMethod
+}
+
+type hedgeMethod struct {
+	latencies *rolling.PointPolicy
+	samples   atomic.Int64
+
+	delay    time.Duration
+	computed time.Time
+	mu       sync.Mutex
+}
+
+// NewHedger creates a hedger for the chain. It returns nil if hedging is not configured.
+func NewHedger(chain string, cfg *config.Hedge) *Hedger {
+	if cfg == nil || len(cfg.Methods) == 0 {
+		return nil
+	}
+	h := &Hedger{
+		chain:      chain,
+		percentile: cfg.Percentile,
+		minDelay:   cfg.MinDelay.Duration,
+		maxDelay:   cfg.MaxDelay.Duration,
+		methods:    make(map[string]*hedgeMethod, len(cfg.Methods)),
+	}
+	for _, method := range cfg.Methods {
+		if neverHedge[method] {
+			continue
+		}
+		h.methods[method] = &hedgeMethod{
+			latencies: rolling.NewPointPolicy(rolling.NewWindow(hedgeSamples)),
+		}
+	}
+	return h
+}
+
+// Enabled returns whether requests for the method should be hedged
+func (T *Hedger) Enabled(method string) bool {
+	if T == nil {
+		return false
+	}
+	_, ok := T.methods[method]
+	return ok
+}
+
+// Delay returns how long to wait for a remote to answer before hedging to the next one
+func (T *Hedger) Delay(method string) time.Duration {
+	m, ok := T.methods[method]
+	if !ok {
+		return T.maxDelay
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if time.Since(m.computed) < hedgeRecompute {
+		return m.delay
+	}
+	m.computed = time.Now()
+
+	samples := int(min(m.samples.Load(), hedgeSamples))
+	if samples < hedgeMinSamples {
+		m.delay = T.minDelay
+		return m.delay
+	}
+	p := m.latencies.Reduce(func(w rolling.Window) float64 {
+		// the window is filled from the start, so only the first samples buckets hold data until it wraps
+		values := make([]float64, 0, samples)
+		for _, bucket := range w[:samples] {
+			values = append(values, bucket...)
+		}
+		slices.Sort(values)
+		return values[min(int(math.Ceil(float64(len(values))*T.percentile/100))-1, len(values)-1)]
+	})
+	m.delay = min(max(time.Duration(p), T.minDelay), T.maxDelay)
+	return m.delay
+}
+
+// Observe records the latency of a successful request
+func (T *Hedger) Observe(method string, latency time.Duration) {
+	m, ok := T.methods[method]
+	if !ok {
+		return
+	}
+	m.latencies.Append(float64(latency))
+	m.samples.Add(1)
+}
+
+func (T *Hedger) hedged(method string) {
+	prom.Hedges.Hedged(prom.HedgeLabel{
+		Chain:  T.chain,
+		Method: method,
+	}).Inc()
+}
+
+func (T *Hedger) won(method string) {
+	prom.Hedges.Wins(prom.HedgeLabel{
+		Chain:  T.chain,
+		Method: method,
+	}).Inc()
+}
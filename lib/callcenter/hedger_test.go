@@ -0,0 +1,201 @@
+package callcenter
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gfx.cafe/open/jrpc"
+	"gfx.cafe/open/jrpc/pkg/jsonrpc"
+	"github.com/asecurityteam/rolling"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gfx-labs/venn/lib/config"
+	"github.com/gfx-labs/venn/lib/jrpcutil"
+)
+
+func newTestHedger(minDelay, maxDelay time.Duration, methods ...string) *Hedger {
+	return NewHedger("test", &config.Hedge{
+		Methods:    methods,
+		Percentile: 90,
+		MinDelay:   config.Duration{Duration: minDelay},
+		MaxDelay:   config.Duration{Duration: maxDelay},
+	})
+}
+
+func TestNewHedger(t *testing.T) {
+	require.Nil(t, NewHedger("test", nil))
+	require.Nil(t, NewHedger("test", &config.Hedge{}))
+
+	var disabled *Hedger
+	require.False(t, disabled.Enabled("eth_call"))
+
+	h := newTestHedger(time.Millisecond, time.Second, "eth_call", "eth_sendRawTransaction", "eth_sendTransaction")
+	require.True(t, h.Enabled("eth_call"))
+	require.False(t, h.Enabled("eth_getLogs"))
+	// sending a transaction twice is never safe, even if configured
+	require.False(t, h.Enabled("eth_sendRawTransaction"))
+	require.False(t, h.Enabled("eth_sendTransaction"))
+}
+
+func TestHedger_Delay(t *testing.T) {
+	cases := []struct {
+		name     string
+		samples  int
+		minDelay time.Duration
+		maxDelay time.Duration
+		want     time.Duration
+	}{
+		{name: "too few samples", samples: hedgeMinSamples - 1, minDelay: 5 * time.Millisecond, maxDelay: time.Second, want: 5 * time.Millisecond},
+		{name: "percentile", samples: 100, minDelay: 5 * time.Millisecond, maxDelay: time.Second, want: 90 * time.Millisecond},
+		{name: "below the minimum", samples: 100, minDelay: 95 * time.Millisecond, maxDelay: time.Second, want: 95 * time.Millisecond},
+		{name: "above the maximum", samples: 100, minDelay: 5 * time.Millisecond, maxDelay: 50 * time.Millisecond, want: 50 * time.Millisecond},
+		// the oldest samples are overwritten once the window is full, leaving 101ms to 1124ms
+		{name: "wrapped", samples: hedgeSamples + 100, minDelay: time.Millisecond, maxDelay: 2 * time.Second, want: 1022 * time.Millisecond},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h := newTestHedger(c.minDelay, c.maxDelay, "eth_call")
+			for i := 1; i <= c.samples; i++ {
+				h.Observe("eth_call", time.Duration(i)*time.Millisecond)
+			}
+			require.Equal(t, c.want, h.Delay("eth_call"))
+		})
+	}
+}
+
+func TestHedger_DelayRecompute(t *testing.T) {
+	h := newTestHedger(5*time.Millisecond, time.Second, "eth_call")
+	require.Equal(t, 5*time.Millisecond, h.Delay("eth_call"))
+	for i := 1; i <= 100; i++ {
+		h.Observe("eth_call", time.Duration(i)*time.Millisecond)
+	}
+	// the delay is cached until it is due to be recomputed
+	require.Equal(t, 5*time.Millisecond, h.Delay("eth_call"))
+	h.methods["eth_call"].computed = time.Time{}
+	require.Equal(t, 90*time.Millisecond, h.Delay("eth_call"))
+
+	require.Equal(t, time.Second, h.Delay("eth_getLogs"))
+}
+
+// newTestHedgeCluster returns a cluster which attempts the remotes in the order given
+func newTestHedgeCluster(hedger *Hedger, handlers ...jrpc.Handler) *Cluster {
+	c := NewCluster(nil, hedger)
+	for i, h := range handlers {
+		c.Add(i, NewRemoteWithConfig(h, &config.Remote{}))
+	}
+	return c
+}
+
+func serveCluster(t *testing.T, c *Cluster, method string) (any, error) {
+	r, err := jsonrpc.NewRequest(context.Background(), jsonrpc.NewNullIDPtr(), method, nil)
+	require.NoError(t, err)
+	var icept jrpcutil.Interceptor
+	c.ServeRPC(&icept, r)
+	return icept.Result, icept.Error
+}
+
+func TestCluster_HedgeCancelsLoser(t *testing.T) {
+	canceled := make(chan error, 1)
+	slow := jrpc.HandlerFunc(func(w jrpc.ResponseWriter, r *jrpc.Request) {
+		<-r.Context().Done()
+		canceled <- r.Context().Err()
+		_ = w.Send(nil, r.Context().Err())
+	})
+	fast := jrpc.HandlerFunc(func(w jrpc.ResponseWriter, r *jrpc.Request) {
+		_ = w.Send("fast", nil)
+	})
+	c := newTestHedgeCluster(newTestHedger(10*time.Millisecond, 10*time.Millisecond, "eth_call"), slow, fast)
+
+	result, err := serveCluster(t, c, "eth_call")
+	require.NoError(t, err)
+	require.Equal(t, "fast", result)
+	select {
+	case err := <-canceled:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("the slow attempt was not canceled")
+	}
+}
+
+func TestCluster_HedgeObservesLoser(t *testing.T) {
+	slow := jrpc.HandlerFunc(func(w jrpc.ResponseWriter, r *jrpc.Request) {
+		<-r.Context().Done()
+		_ = w.Send(nil, r.Context().Err())
+	})
+	fast := jrpc.HandlerFunc(func(w jrpc.ResponseWriter, r *jrpc.Request) {
+		_ = w.Send("fast", nil)
+	})
+	hedger := newTestHedger(10*time.Millisecond, 10*time.Millisecond, "eth_call")
+	c := newTestHedgeCluster(hedger, slow, fast)
+
+	_, err := serveCluster(t, c, "eth_call")
+	require.NoError(t, err)
+	// both the hedge which won, and the attempt it beat, which took at least the delay
+	m := hedger.methods["eth_call"]
+	require.EqualValues(t, 2, m.samples.Load())
+	slowest := m.latencies.Reduce(func(w rolling.Window) float64 {
+		var slowest float64
+		for _, bucket := range w[:2] {
+			for _, v := range bucket {
+				slowest = max(slowest, v)
+			}
+		}
+		return slowest
+	})
+	require.GreaterOrEqual(t, time.Duration(slowest), 10*time.Millisecond)
+}
+
+func TestCluster_HedgeFirstWins(t *testing.T) {
+	var calls atomic.Int64
+	first := jrpc.HandlerFunc(func(w jrpc.ResponseWriter, r *jrpc.Request) {
+		_ = w.Send("first", nil)
+	})
+	second := jrpc.HandlerFunc(func(w jrpc.ResponseWriter, r *jrpc.Request) {
+		calls.Add(1)
+		_ = w.Send("second", nil)
+	})
+	c := newTestHedgeCluster(newTestHedger(time.Second, time.Second, "eth_call"), first, second)
+
+	result, err := serveCluster(t, c, "eth_call")
+	require.NoError(t, err)
+	require.Equal(t, "first", result)
+	require.Zero(t, calls.Load())
+}
+
+func TestCluster_HedgeFailureMovesOn(t *testing.T) {
+	failing := jrpc.HandlerFunc(func(w jrpc.ResponseWriter, r *jrpc.Request) {
+		_ = w.Send(nil, errors.New("unavailable"))
+	})
+	ok := jrpc.HandlerFunc(func(w jrpc.ResponseWriter, r *jrpc.Request) {
+		_ = w.Send("ok", nil)
+	})
+	// the next remote is attempted as soon as the first one fails, without waiting for the hedge delay
+	c := newTestHedgeCluster(newTestHedger(time.Minute, time.Minute, "eth_call"), failing, ok)
+
+	start := time.Now()
+	result, err := serveCluster(t, c, "eth_call")
+	require.NoError(t, err)
+	require.Equal(t, "ok", result)
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestCluster_NeverHedge(t *testing.T) {
+	var calls atomic.Int64
+	slow := jrpc.HandlerFunc(func(w jrpc.ResponseWriter, r *jrpc.Request) {
+		time.Sleep(50 * time.Millisecond)
+		_ = w.Send("slow", nil)
+	})
+	other := jrpc.HandlerFunc(func(w jrpc.ResponseWriter, r *jrpc.Request) {
+		calls.Add(1)
+		_ = w.Send("other", nil)
+	})
+	c := newTestHedgeCluster(newTestHedger(time.Millisecond, time.Millisecond, "eth_call", "eth_sendRawTransaction"), slow, other)
+
+	result, err := serveCluster(t, c, "eth_sendRawTransaction")
+	require.NoError(t, err)
+	require.Equal(t, "slow", result)
+	require.Zero(t, calls.Load())
+}
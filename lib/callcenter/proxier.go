@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"strings"
+	"sync"
 
 	"gfx.cafe/open/jrpc"
 	"gfx.cafe/open/jrpc/contrib/extension/subscription"
@@ -14,6 +15,8 @@ import (
 type Proxier struct {
 	connect func(ctx context.Context) (jrpc.Conn, error)
 	conn    subscription.Conn
+	connMu  sync.Mutex
+	batcher *Batcher
 }
 
 func NewProxier(connect func(ctx context.Context) (jrpc.Conn, error)) *Proxier {
@@ -22,27 +25,51 @@ func NewProxier(connect func(ctx context.Context) (jrpc.Conn, error)) *Proxier {
 	}
 }
 
+// WithBatcher sends requests through the batcher instead of one at a time. a nil batcher disables batching.
+func (T *Proxier) WithBatcher(batcher *Batcher) *Proxier {
+	T.batcher = batcher
+	return T
+}
+
 func init() {
 	subscription.SetServiceMethodSeparator("_")
 }
 
-func (T *Proxier) ServeRPC(w jsonrpc.ResponseWriter, r *jsonrpc.Request) {
-	var ok bool
+// getConn returns the connection to the remote, connecting again if it was closed
+func (T *Proxier) getConn(ctx context.Context) (subscription.Conn, error) {
+	T.connMu.Lock()
+	defer T.connMu.Unlock()
+
 	if T.conn != nil {
 		select {
 		case <-T.conn.Closed():
 		default:
-			ok = true
+			return T.conn, nil
 		}
 	}
 
-	if !ok {
-		var err error
-		T.conn, err = subscription.UpgradeConn(T.connect(r.Context()))
-		if err != nil {
-			_ = w.Send(nil, err)
-			return
-		}
+	conn, err := subscription.UpgradeConn(T.connect(ctx))
+	if err != nil {
+		return nil, err
+	}
+	T.conn = conn
+	return conn, nil
+}
+
+// Subscribe subscribes to the remote, sending every notification to ch until the subscription is closed
+func (T *Proxier) Subscribe(ctx context.Context, namespace string, ch any, params any) (subscription.ClientSubscription, error) {
+	conn, err := T.getConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return conn.Subscribe(ctx, namespace, ch, params)
+}
+
+func (T *Proxier) ServeRPC(w jsonrpc.ResponseWriter, r *jsonrpc.Request) {
+	conn, err := T.getConn(r.Context())
+	if err != nil {
+		_ = w.Send(nil, err)
+		return
 	}
 
 	if strings.HasSuffix(r.Method, "_subscribe") {
@@ -51,7 +78,7 @@ func (T *Proxier) ServeRPC(w jsonrpc.ResponseWriter, r *jsonrpc.Request) {
 			_ = w.Send(nil, subscription.ErrNotificationsUnsupported)
 		}
 		ch := make(chan json.RawMessage)
-		sub, err := T.conn.Subscribe(r.Context(), strings.TrimSuffix(r.Method, "_subscribe"), ch, r.Params)
+		sub, err := conn.Subscribe(r.Context(), strings.TrimSuffix(r.Method, "_subscribe"), ch, r.Params)
 		if err != nil {
 			_ = w.Send(nil, err)
 			return
@@ -83,13 +110,24 @@ func (T *Proxier) ServeRPC(w jsonrpc.ResponseWriter, r *jsonrpc.Request) {
 	if len(params) == 0 {
 		params = nil
 	}
+	if T.batcher != nil {
+		result, err := T.batcher.Do(r.Context(), conn, r.Method, params)
+		_ = w.Send(result, err)
+		return
+	}
 	var result sonic.NoCopyRawMessage
-	err := T.conn.Do(r.Context(), &result, r.Method, r.Params)
+	err = conn.Do(r.Context(), &result, r.Method, r.Params)
 
 	_ = w.Send(result, err)
 }
 
 func (T *Proxier) Close() error {
+	T.connMu.Lock()
+	defer T.connMu.Unlock()
+
+	if T.conn == nil {
+		return nil
+	}
 	return T.conn.Close()
 }
 
@@ -9,6 +9,12 @@ import (
 type RemoteWithConfig struct {
 	Handler jrpc.Handler
 	Config  *config.Remote
+
+	// Collector optionally provides the latency and load of the remote to the selection strategies
+	Collector *Collector
+
+	// Behind optionally reports whether the remote is lagging the chain head, in which case the cluster will deprioritize it
+	Behind func() bool
 }
 
 // NewRemoteWithConfig creates a new RemoteWithConfig
@@ -18,3 +24,8 @@ func NewRemoteWithConfig(handler jrpc.Handler, cfg *config.Remote) *RemoteWithCo
 		Config:  cfg,
 	}
 }
+
+// IsBehind reports whether the remote is lagging the chain head
+func (T *RemoteWithConfig) IsBehind() bool {
+	return T.Behind != nil && T.Behind()
+}
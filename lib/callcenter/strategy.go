@@ -0,0 +1,128 @@
+package callcenter
+
+import (
+	"cmp"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/gfx-labs/venn/lib/config"
+)
+
+// Strategy decides the order in which the remotes of a single priority tier are attempted.
+type Strategy interface {
+	// Order reorders remotes in place. round is incremented once per request to the tier.
+	Order(remotes []*RemoteWithConfig, round int64)
+}
+
+// NewStrategy returns the selection strategy with the given name, defaulting to round-robin.
+func NewStrategy(name string) Strategy {
+	switch name {
+	case config.SelectionStrategyWeightedRandom:
+		return WeightedRandom{}
+	case config.SelectionStrategyLeastLatency:
+		return LeastLatency{}
+	case config.SelectionStrategyPowerOfTwo:
+		return PowerOfTwo{}
+	default:
+		return RoundRobin{}
+	}
+}
+
+// RoundRobin rotates through the remotes of a tier.
+type RoundRobin struct{}
+
+func (RoundRobin) Order(remotes []*RemoteWithConfig, round int64) {
+	rotate(remotes, round)
+}
+
+// WeightedRandom picks remotes at random, weighted by their configured weight and recent success rate.
+type WeightedRandom struct{}
+
+func (WeightedRandom) Order(remotes []*RemoteWithConfig, _ int64) {
+	// weighted random sampling without replacement: sort by u^(1/w)
+	keys := make(map[*RemoteWithConfig]float64, len(remotes))
+	for _, rem := range remotes {
+		keys[rem] = math.Pow(rand.Float64(), 1/remoteWeight(rem))
+	}
+	slices.SortStableFunc(remotes, func(a, b *RemoteWithConfig) int {
+		return cmp.Compare(keys[b], keys[a])
+	})
+}
+
+// LeastLatency prefers the remote with the lowest average latency. remotes without recent latency data are tried first,
+// so that they get a chance to report their latency.
+type LeastLatency struct{}
+
+func (LeastLatency) Order(remotes []*RemoteWithConfig, round int64) {
+	rotate(remotes, round)
+	latencies := make(map[*RemoteWithConfig]time.Duration, len(remotes))
+	for _, rem := range remotes {
+		latencies[rem] = remoteLatency(rem)
+	}
+	slices.SortStableFunc(remotes, func(a, b *RemoteWithConfig) int {
+		return cmp.Compare(latencies[a], latencies[b])
+	})
+}
+
+// PowerOfTwo picks two remotes at random and tries the one with the fewest in flight requests first. the rest are
+// round-robined.
+type PowerOfTwo struct{}
+
+func (PowerOfTwo) Order(remotes []*RemoteWithConfig, round int64) {
+	rotate(remotes, round)
+	if len(remotes) < 2 {
+		return
+	}
+	i := rand.IntN(len(remotes))
+	j := rand.IntN(len(remotes) - 1)
+	if j >= i {
+		j++
+	}
+	if remoteInFlight(remotes[j]) < remoteInFlight(remotes[i]) {
+		i = j
+	}
+	best := remotes[i]
+	copy(remotes[1:i+1], remotes[:i])
+	remotes[0] = best
+}
+
+func rotate(remotes []*RemoteWithConfig, round int64) {
+	if len(remotes) < 2 {
+		return
+	}
+	n := int(round % int64(len(remotes)))
+	if n < 0 {
+		n += len(remotes)
+	}
+	slices.Reverse(remotes[:n])
+	slices.Reverse(remotes[n:])
+	slices.Reverse(remotes)
+}
+
+func remoteWeight(rem *RemoteWithConfig) float64 {
+	weight := 1.0
+	if rem.Config != nil && rem.Config.Weight > 0 {
+		weight = float64(rem.Config.Weight)
+	}
+	if rem.Collector != nil {
+		// never drop to zero, so that a failing remote can still recover
+		weight *= max(rem.Collector.GetSuccessRate(), 1) / 100
+	}
+	return weight
+}
+
+func remoteLatency(rem *RemoteWithConfig) time.Duration {
+	if rem.Collector == nil {
+		return 0
+	}
+	return rem.Collector.GetLatencyEWMA()
+}
+
+func remoteInFlight(rem *RemoteWithConfig) int64 {
+	if rem.Collector == nil {
+		return 0
+	}
+	return rem.Collector.GetInFlight()
+}
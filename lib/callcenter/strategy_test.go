@@ -0,0 +1,127 @@
+package callcenter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/gfx-labs/venn/lib/config"
+)
+
+func newTestRemotes(names ...string) []*RemoteWithConfig {
+	remotes := make([]*RemoteWithConfig, 0, len(names))
+	for _, name := range names {
+		remotes = append(remotes, &RemoteWithConfig{
+			Config:    &config.Remote{Name: name},
+			Collector: NewCollector("test", name),
+		})
+	}
+	return remotes
+}
+
+func remoteNames(remotes []*RemoteWithConfig) []string {
+	names := make([]string, 0, len(remotes))
+	for _, rem := range remotes {
+		names = append(names, rem.Config.Name)
+	}
+	return names
+}
+
+func TestNewStrategy(t *testing.T) {
+	require.Equal(t, RoundRobin{}, NewStrategy(config.SelectionStrategyRoundRobin))
+	require.Equal(t, WeightedRandom{}, NewStrategy(config.SelectionStrategyWeightedRandom))
+	require.Equal(t, LeastLatency{}, NewStrategy(config.SelectionStrategyLeastLatency))
+	require.Equal(t, PowerOfTwo{}, NewStrategy(config.SelectionStrategyPowerOfTwo))
+	require.Equal(t, RoundRobin{}, NewStrategy(""))
+}
+
+func TestRoundRobin(t *testing.T) {
+	cases := []struct {
+		round int64
+		want  []string
+	}{
+		{round: 0, want: []string{"a", "b", "c"}},
+		{round: 1, want: []string{"b", "c", "a"}},
+		{round: 2, want: []string{"c", "a", "b"}},
+		{round: 3, want: []string{"a", "b", "c"}},
+		{round: -1, want: []string{"c", "a", "b"}},
+	}
+	for _, c := range cases {
+		remotes := newTestRemotes("a", "b", "c")
+		RoundRobin{}.Order(remotes, c.round)
+		require.Equal(t, c.want, remoteNames(remotes), c.round)
+	}
+}
+
+func TestLeastLatency(t *testing.T) {
+	remotes := newTestRemotes("slow", "fast", "new", "medium")
+	remotes[0].Collector.observeLatency(300*time.Millisecond, true)
+	remotes[1].Collector.observeLatency(100*time.Millisecond, true)
+	remotes[3].Collector.observeLatency(200*time.Millisecond, true)
+
+	LeastLatency{}.Order(remotes, 0)
+	// remotes without latency go first, so that they get measured
+	require.Equal(t, []string{"new", "fast", "medium", "slow"}, remoteNames(remotes))
+}
+
+func TestLeastLatency_TiesRoundRobin(t *testing.T) {
+	for round, want := range [][]string{{"a", "b"}, {"b", "a"}} {
+		remotes := newTestRemotes("a", "b")
+		LeastLatency{}.Order(remotes, int64(round))
+		require.Equal(t, want, remoteNames(remotes))
+	}
+}
+
+func TestPowerOfTwo(t *testing.T) {
+	// with two remotes both are always picked, so the least loaded one always goes first
+	for round := range int64(10) {
+		remotes := newTestRemotes("busy", "idle")
+		remotes[0].Collector.inFlight.Add(5)
+		remotes[1].Collector.inFlight.Add(1)
+		PowerOfTwo{}.Order(remotes, round)
+		require.Equal(t, []string{"idle", "busy"}, remoteNames(remotes))
+	}
+}
+
+func TestPowerOfTwo_Permutation(t *testing.T) {
+	for round := range int64(10) {
+		remotes := newTestRemotes("a", "b", "c", "d")
+		PowerOfTwo{}.Order(remotes, round)
+		require.ElementsMatch(t, []string{"a", "b", "c", "d"}, remoteNames(remotes))
+	}
+}
+
+func TestWeightedRandom_Permutation(t *testing.T) {
+	for range 10 {
+		remotes := newTestRemotes("a", "b", "c", "d")
+		WeightedRandom{}.Order(remotes, 0)
+		require.ElementsMatch(t, []string{"a", "b", "c", "d"}, remoteNames(remotes))
+	}
+}
+
+func TestRemoteWeight(t *testing.T) {
+	failing := NewCollector("test", "failing")
+	failing.requestWindow.Append(1)
+	failing.successWindow.Append(0)
+	halfway := NewCollector("test", "halfway")
+	for _, success := range []float64{1, 0} {
+		halfway.requestWindow.Append(1)
+		halfway.successWindow.Append(success)
+	}
+
+	cases := []struct {
+		name   string
+		remote *RemoteWithConfig
+		want   float64
+	}{
+		{name: "default", remote: &RemoteWithConfig{}, want: 1},
+		{name: "configured", remote: &RemoteWithConfig{Config: &config.Remote{Weight: 3}}, want: 3},
+		{name: "no requests", remote: &RemoteWithConfig{Config: &config.Remote{Weight: 3}, Collector: NewCollector("test", "idle")}, want: 3},
+		{name: "half failing", remote: &RemoteWithConfig{Config: &config.Remote{Weight: 4}, Collector: halfway}, want: 2},
+		{name: "failing", remote: &RemoteWithConfig{Config: &config.Remote{Weight: 2}, Collector: failing}, want: 0.02},
+	}
+	for _, c := range cases {
+		require.InDelta(t, c.want, remoteWeight(c.remote), 1e-9, c.name)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"gfx.cafe/open/jrpc"
@@ -22,16 +23,22 @@ import (
 
 // Validator validates that the result returned by the rpc is valid.
 type Validator struct {
-	old time.Duration
-
-	head    hexutil.Uint64
-	updated time.Time
-	mu      sync.Mutex
+	old          time.Duration
+	lagThreshold hexutil.Uint64
+
+	head      hexutil.Uint64
+	updated   time.Time
+	consensus hexutil.Uint64
+	behind    atomic.Bool
+	mu        sync.Mutex
 }
 
-func NewValidator(old time.Duration) *Validator {
+// NewValidator creates a validator. lagThreshold is the number of blocks the remote may trail the head oracle
+// consensus before it is considered behind, zero disables the check.
+func NewValidator(old time.Duration, lagThreshold int) *Validator {
 	return &Validator{
-		old: old,
+		old:          old,
+		lagThreshold: hexutil.Uint64(max(lagThreshold, 0)),
 	}
 }
 
@@ -46,6 +53,7 @@ func (T *Validator) updateHead(head hexutil.Uint64, updated time.Time) error {
 	if head > T.head {
 		T.head = head
 		T.updated = updated
+		T.checkLag()
 		return nil
 	}
 
@@ -251,3 +259,39 @@ func (T *Validator) GetHead() (hexutil.Uint64, time.Time) {
 	defer T.mu.Unlock()
 	return T.head, T.updated
 }
+
+// SetConsensus records the head reported by the chain's head oracles and returns how far behind it the remote is.
+func (T *Validator) SetConsensus(consensus hexutil.Uint64) (lag hexutil.Uint64, behind bool) {
+	T.mu.Lock()
+	defer T.mu.Unlock()
+
+	T.consensus = consensus
+	return T.checkLag(), T.behind.Load()
+}
+
+// GetLag returns the number of blocks the remote trails the head oracle consensus, along with the consensus itself
+func (T *Validator) GetLag() (lag hexutil.Uint64, consensus hexutil.Uint64) {
+	T.mu.Lock()
+	defer T.mu.Unlock()
+	return T.lag(), T.consensus
+}
+
+// IsBehind reports whether the remote trails the head oracle consensus by more than the lag threshold
+func (T *Validator) IsBehind() bool {
+	return T.behind.Load()
+}
+
+func (T *Validator) lag() hexutil.Uint64 {
+	if T.consensus <= T.head {
+		return 0
+	}
+	return T.consensus - T.head
+}
+
+// checkLag must be called with the lock held
+func (T *Validator) checkLag() hexutil.Uint64 {
+	lag := T.lag()
+	// without a threshold or a head to compare against, we can't tell if the remote is behind
+	T.behind.Store(T.lagThreshold > 0 && T.head > 0 && lag > T.lagThreshold)
+	return lag
+}
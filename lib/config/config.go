@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"log/slog"
 
 	"github.com/nats-io/nats.go/jetstream"
@@ -12,6 +13,8 @@ type NodeConfig struct {
 	Metrics   *Metrics    `json:"metrics,omitempty"`
 	Election  Election    `json:"election,omitempty"`
 	Redis     Redis       `json:"redis,omitempty"`
+	Nats      *Nats       `json:"nats,omitempty"`
+	Diskstore *Diskstore  `json:"diskstore,omitempty"`
 	Ratelimit *AbuseLimit `json:"ratelimit,omitempty"`
 	Chains    []*Chain    `json:"chains,omitempty"`
 	Filters   []*Filter   `json:"filters,omitempty"`
@@ -26,7 +29,10 @@ type GatewayConfig struct {
 	Telemetry *Telemetry `json:"telemetry,omitempty"`
 
 	Endpoint *EndpointSpec `json:"endpoint,omitempty"`
-	Security *Security     `json:"security,omitempty"`
+	// more endpoints, served by the same gateway. they are told apart by their host and prefix
+	Endpoints []*EndpointSpec `json:"endpoints,omitempty"`
+	// the security of endpoints without one of their own
+	Security *Security `json:"security,omitempty"`
 }
 
 type Telemetry struct {
@@ -52,30 +58,155 @@ type Security struct {
 
 type EndpointSpec struct {
 	Name string `json:"name"`
+	// the host and path prefix the endpoint is served on. without them, it is served on every host and at the root
+	Host   string `json:"host,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
 	// paths to proxy from gateway -> venn path
 	Paths  map[string]string `json:"paths"`
 	Limits EndpointLimits    `json:"limits,omitempty"`
 
 	Methods []string `json:"methods,omitempty"`
 
+	// api keys identifying the callers. without them, callers are identified by ip
+	Keys *ApiKeys `json:"keys,omitempty"`
+	// what requests cost against the limits. without them, every request costs one
+	Costs *MethodCosts `json:"costs,omitempty"`
+	// trusted ips and cors of the endpoint. defaults to the security of the gateway
+	Security *Security `json:"security,omitempty"`
+
 	// url to the venn to proxy to
 	VennUrl SafeUrl `json:"venn_url"`
 }
 
+// ApiKeys configures where callers pass their api key, and where the keys are stored
+type ApiKeys struct {
+	// the key is read from the header, the query param, or the path segment after the endpoint path, in that order
+	Header      string `json:"header,omitempty"`
+	Query       string `json:"query,omitempty"`
+	PathSegment bool   `json:"path_segment,omitempty"`
+	// reject requests without a key instead of identifying them by ip
+	Required bool `json:"required,omitempty"`
+
+	// redis or file. the keys are reloaded every refresh, so that added and revoked keys apply without a restart
+	Source  string   `json:"source,omitempty"`
+	File    string   `json:"file,omitempty"`
+	Refresh Duration `json:"refresh,omitempty"`
+}
+
+const (
+	ApiKeySourceRedis = "redis"
+	ApiKeySourceFile  = "file"
+)
+
+// ApiKey is an api key and what the caller using it may do
+type ApiKey struct {
+	Key string `json:"key"`
+	// identifies the caller in limits, logs and telemetry. keys with the same name share their limits
+	Name string `json:"name,omitempty"`
+	// paths of the endpoint the key may be used on. empty allows every path
+	Paths []string `json:"paths,omitempty"`
+	// methods the key may call, out of the methods of the endpoint. empty allows every method of the endpoint
+	Methods []string `json:"methods,omitempty"`
+	// replace the limits of the endpoint for the key
+	Limits  *EndpointLimits `json:"limits,omitempty"`
+	Revoked bool            `json:"revoked,omitempty"`
+}
+
 type EndpointLimits struct {
 	Abuse []AbuseLimit `json:"abuse,omitempty"`
 	Usage []UsageLimit `json:"usage,omitempty"`
-	//TODO: CustomKeyTemplate string `json:"custom_key_template,omitempty"`
 }
 
 type AbuseLimit struct {
 	Id     string   `json:"id"`
 	Total  int      `json:"total"`
 	Window Duration `json:"window"`
+	// counts the requests by the key the template builds instead of by caller. see KeyTemplate
+	KeyTemplate string `json:"key_template,omitempty"`
+
+	// what requests cost against the rate limit of the node. the limits of an endpoint are charged by its costs instead
+	Costs *MethodCosts `json:"costs,omitempty"`
 }
 
+// MethodCosts is what requests cost against the abuse and usage limits. every request costs at least one
+type MethodCosts struct {
+	// the cost of each method. methods which are not listed cost one
+	Methods map[string]int `json:"methods,omitempty"`
+	// eth_getLogs costs one more for every this many blocks its range spans. a range with a block tag on one end only
+	// is charged as LogsMaxSpan blocks, since its span is not known
+	LogsBlocks  int `json:"logs_blocks,omitempty"`
+	LogsMaxSpan int `json:"logs_max_span,omitempty"`
+	// every request sent over http in a batch costs this much more
+	Batch int `json:"batch,omitempty"`
+}
+
+// Validate returns an error if any of the costs is invalid
+func (c *MethodCosts) Validate() error {
+	for method, cost := range c.Methods {
+		if cost < 1 {
+			return fmt.Errorf("method %s costs less than one", method)
+		}
+	}
+	if c.LogsBlocks < 0 || c.LogsMaxSpan < 0 || c.Batch < 0 {
+		return fmt.Errorf("costs may not be negative")
+	}
+	return nil
+}
+
+// UsageLimit is a quota on the cost of the requests of a caller within a calendar day or month, in utc
 type UsageLimit struct {
-	Id string `json:"id"`
+	Id     string `json:"id"`
+	Period string `json:"period"`
+	// past Soft, requests are still served but reported. past Hard, they are rejected until the period is over. zero
+	// disables a threshold
+	Soft int64 `json:"soft,omitempty"`
+	Hard int64 `json:"hard,omitempty"`
+	// counts the requests by the key the template builds instead of by caller. see KeyTemplate
+	KeyTemplate string `json:"key_template,omitempty"`
+}
+
+const (
+	UsagePeriodDay   = "day"
+	UsagePeriodMonth = "month"
+)
+
+// Validate returns an error if any of the limits is invalid
+func (l *EndpointLimits) Validate() error {
+	for idx, v := range l.Abuse {
+		if v.Id == "" {
+			return fmt.Errorf("abuse limit %d has no id", idx)
+		}
+		if v.Costs != nil {
+			return fmt.Errorf("abuse limit %s has costs, which are set on the endpoint", v.Id)
+		}
+		if v.KeyTemplate != "" {
+			if _, err := ParseKeyTemplate(v.KeyTemplate); err != nil {
+				return fmt.Errorf("abuse limit %s: %w", v.Id, err)
+			}
+		}
+	}
+	for idx, v := range l.Usage {
+		if v.Id == "" {
+			return fmt.Errorf("usage limit %d has no id", idx)
+		}
+		switch v.Period {
+		case UsagePeriodDay, UsagePeriodMonth:
+		default:
+			return fmt.Errorf("usage limit %s has invalid period: %q", v.Id, v.Period)
+		}
+		if v.Soft <= 0 && v.Hard <= 0 {
+			return fmt.Errorf("usage limit %s has no soft or hard threshold", v.Id)
+		}
+		if v.Soft > 0 && v.Hard > 0 && v.Soft > v.Hard {
+			return fmt.Errorf("usage limit %s has a soft threshold above its hard threshold", v.Id)
+		}
+		if v.KeyTemplate != "" {
+			if _, err := ParseKeyTemplate(v.KeyTemplate); err != nil {
+				return fmt.Errorf("usage limit %s: %w", v.Id, err)
+			}
+		}
+	}
+	return nil
 }
 
 // possibly shared objects
@@ -103,8 +234,22 @@ type Redis struct {
 	Namespace string    `json:"namespace"`
 }
 
+// Diskstore configures the on-disk store of finalized blocks, receipts and logs.
+type Diskstore struct {
+	Path          string   `json:"path"`
+	FinalityDepth int      `json:"finality_depth,omitempty"` // blocks behind the head before entries are persisted
+	Retention     int      `json:"retention,omitempty"`      // blocks behind the head to keep, 0 keeps everything
+	MaxSizeMB     int      `json:"max_size_mb,omitempty"`    // oldest blocks are pruned when the data stored exceeds this, 0 for no limit
+	PruneInterval Duration `json:"prune_interval,omitempty"`
+}
+
 type Nats struct {
 	URI SafeUrl `json:"uri"`
+
+	// Namespace prefixes the streams of the node. it defaults to the redis namespace
+	Namespace string `json:"namespace,omitempty"`
+	// Headstore shares the heads between the replicas of the node through nats instead of redis
+	Headstore bool `json:"headstore,omitempty"`
 }
 
 type Chain struct {
@@ -115,11 +260,56 @@ type Chain struct {
 	BlockTimeSeconds float64 `json:"block_time_seconds"`
 
 	HeadOracles        []*HeadOracles `json:"head_oracles,omitempty"`
+	HeadOracleStrategy string         `json:"head_oracle_strategy,omitempty"`
+	HeadOracleInterval Duration       `json:"head_oracle_interval,omitempty"`
+	HeadLagThreshold   int            `json:"head_lag_threshold,omitempty"` // blocks behind the oracle consensus before a remote is deprioritized
+	SelectionStrategy  string         `json:"selection_strategy,omitempty"`
+	Hedge              *Hedge         `json:"hedge,omitempty"`
 	Remotes            []*Remote      `json:"remotes,omitempty"`
 	Stalk              *bool          `json:"stalk,omitempty"`
 	ParsedStalk        bool           `json:"-"`
 	ForgeBlockReceipts bool           `json:"forge_block_receipts,omitempty"`
 	MaxBlockLookback   int            `json:"max_block_lookback,omitempty"`
+	LogCache           *LogCache      `json:"log_cache,omitempty"`
+	Prefetch           *Prefetch      `json:"prefetch,omitempty"`
+}
+
+// Prefetch configures which entries of every new head the stalker puts in the caches before anyone asks for them.
+// receipts of chains which forge block receipts are built from the block and logs, so those are prefetched instead.
+type Prefetch struct {
+	Blocks   bool `json:"blocks,omitempty"`
+	Receipts bool `json:"receipts,omitempty"`
+	Logs     bool `json:"logs,omitempty"`
+}
+
+// LogCache configures how eth_getLogs ranges are served from the cache. blocks which are not cached are fetched from
+// the remotes, without any filter, in chunks of ChunkSize blocks so that they can be cached. runs of more than
+// FilteredRun missing blocks are fetched with the filter of the caller instead, and are not cached.
+type LogCache struct {
+	ChunkSize   int `json:"chunk_size,omitempty"`
+	MaxRange    int `json:"max_range,omitempty"` // larger ranges are sent to the remotes without caching
+	FilteredRun int `json:"filtered_run,omitempty"`
+}
+
+const (
+	HeadOracleStrategyMaxTrim = "maxtrim"
+	HeadOracleStrategyMedian  = "median"
+)
+
+const (
+	SelectionStrategyRoundRobin     = "roundrobin"
+	SelectionStrategyWeightedRandom = "weightedrandom"
+	SelectionStrategyLeastLatency   = "leastlatency"
+	SelectionStrategyPowerOfTwo     = "poweroftwo"
+)
+
+// Hedge configures sending slow requests to a second remote. the delay before hedging is the configured percentile of
+// recent latencies for the method, clamped between MinDelay and MaxDelay.
+type Hedge struct {
+	Methods    []string `json:"methods"`
+	Percentile float64  `json:"percentile,omitempty"`
+	MinDelay   Duration `json:"min_delay,omitempty"`
+	MaxDelay   Duration `json:"max_delay,omitempty"`
 }
 
 type HeadOracles struct {
@@ -133,11 +323,14 @@ type Filter struct {
 }
 
 type Remote struct {
-	Name     string            `json:"name"`
-	Url      SafeUrl           `json:"url"`
-	Desc     string            `help:"optional description" json:"desc,omitempty"`
-	Priority int               `json:"priority,omitempty"`
-	Headers  map[string]string `json:"headers,omitempty"`
+	Name      string            `json:"name"`
+	Url       SafeUrl           `json:"url"`
+	WsUrl     SafeUrl           `json:"ws_url,omitempty"`     // websocket url used for upstream subscriptions, defaults to url if it is a websocket url
+	PushHeads bool              `json:"push_heads,omitempty"` // subscribe to newHeads on the ws url to feed the stalker
+	Desc      string            `help:"optional description" json:"desc,omitempty"`
+	Priority  int               `json:"priority,omitempty"`
+	Weight    int               `json:"weight,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
 
 	HealthCheckIntervalMin Duration `json:"health_check_interval_min"`
 	HealthCheckIntervalMax Duration `json:"health_check_interval_max"`
@@ -148,6 +341,10 @@ type Remote struct {
 
 	ErrorBackoffMax Duration `json:"error_backoff_max"`
 
+	Circuit Circuit `json:"circuit,omitempty"`
+
+	Batch *Batch `json:"batch,omitempty"`
+
 	Filters       []string  `json:"filters,omitempty"`
 	ParsedFilters []*Filter `json:"-"`
 
@@ -157,6 +354,23 @@ type Remote struct {
 	MaxBlockLookback int  `json:"max_block_lookback,omitempty"`
 }
 
+// Circuit configures when the circuit breaker of a remote opens. once open, the remote is not used for the error
+// backoff, after which Probes requests are let through. if they all succeed the circuit closes again, otherwise the
+// backoff doubles, up to error_backoff_max.
+type Circuit struct {
+	ErrorRate   float64  `json:"error_rate,omitempty"`   // fraction of failed requests within the window which opens the circuit
+	MinRequests int      `json:"min_requests,omitempty"` // requests needed within the window before the error rate is considered
+	Window      Duration `json:"window,omitempty"`
+	Probes      int      `json:"probes,omitempty"`
+}
+
+// Batch configures coalescing of concurrent requests to a remote into a single JSON-RPC batch. a batch is sent once it
+// holds MaxSize requests, or Linger after its first request arrived.
+type Batch struct {
+	MaxSize int      `json:"max_size,omitempty"`
+	Linger  Duration `json:"linger,omitempty"`
+}
+
 type RemoteRateLimit struct {
 	EventsPerSecond float64 `json:"events_per_second"`
 	Burst           int     `json:"burst"`
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// KeyFields are the fields of a request which the key of a limit can be built from
+type KeyFields struct {
+	// the identifier of the caller, as type:slug
+	ID     string
+	IP     string
+	Origin string
+	// the name of the api key
+	Key string
+	// the path of the endpoint, and the venn path it is proxied to
+	Path   string
+	Target string
+	Method string
+}
+
+var keyTemplateFields = map[string]func(f KeyFields) string{
+	"id":     func(f KeyFields) string { return f.ID },
+	"ip":     func(f KeyFields) string { return f.IP },
+	"prefix": func(f KeyFields) string { return ipPrefix(f.IP) },
+	"origin": func(f KeyFields) string { return f.Origin },
+	"key":    func(f KeyFields) string { return f.Key },
+	"path":   func(f KeyFields) string { return f.Path },
+	"target": func(f KeyFields) string { return f.Target },
+	"method": func(f KeyFields) string { return f.Method },
+}
+
+// ipPrefix returns the /24 of an ipv4 address or the /64 of an ipv6 address, which usually belong to the same caller
+func ipPrefix(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap()
+	bits := 64
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ip
+	}
+	return prefix.String()
+}
+
+// KeyTemplate builds the key a limit counts requests by from fields of the request, such as "{origin}:{method}". the
+// fields are id, ip, prefix, origin, key, path, target and method.
+type KeyTemplate struct {
+	parts []keyTemplatePart
+}
+
+type keyTemplatePart struct {
+	literal string
+	field   func(f KeyFields) string
+}
+
+func ParseKeyTemplate(s string) (*KeyTemplate, error) {
+	if s == "" {
+		return nil, fmt.Errorf("empty key template")
+	}
+	t := &KeyTemplate{}
+	for s != "" {
+		open := strings.IndexAny(s, "{}")
+		if open == -1 {
+			t.parts = append(t.parts, keyTemplatePart{literal: s})
+			break
+		}
+		if s[open] == '}' {
+			return nil, fmt.Errorf("unexpected } in key template")
+		}
+		if open > 0 {
+			t.parts = append(t.parts, keyTemplatePart{literal: s[:open]})
+		}
+		name, rest, ok := strings.Cut(s[open+1:], "}")
+		if !ok {
+			return nil, fmt.Errorf("unclosed { in key template")
+		}
+		field, ok := keyTemplateFields[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown key template field: %q", name)
+		}
+		t.parts = append(t.parts, keyTemplatePart{field: field})
+		s = rest
+	}
+	return t, nil
+}
+
+// Execute returns the key of the request with the fields
+func (t *KeyTemplate) Execute(f KeyFields) string {
+	var b strings.Builder
+	for _, part := range t.parts {
+		if part.field != nil {
+			b.WriteString(part.field(f))
+		} else {
+			b.WriteString(part.literal)
+		}
+	}
+	return b.String()
+}
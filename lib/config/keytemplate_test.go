@@ -0,0 +1,36 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyTemplate(t *testing.T) {
+	fields := KeyFields{
+		ID:     "ip:10.1.2.3",
+		IP:     "10.1.2.3",
+		Origin: "https://oku.trade",
+		Method: "eth_call",
+	}
+	for template, want := range map[string]string{
+		"{origin}:{method}": "https://oku.trade:eth_call",
+		"prefix-{prefix}":   "prefix-10.1.2.0/24",
+		"{id}":              "ip:10.1.2.3",
+		"static":            "static",
+		"{key}{path}{ip}":   "10.1.2.3",
+	} {
+		parsed, err := ParseKeyTemplate(template)
+		require.NoError(t, err, template)
+		require.Equal(t, want, parsed.Execute(fields), template)
+	}
+
+	parsed, err := ParseKeyTemplate("{prefix}")
+	require.NoError(t, err)
+	require.Equal(t, "2001:db8:1:2::/64", parsed.Execute(KeyFields{IP: "2001:db8:1:2:3:4:5:6"}))
+
+	for _, template := range []string{"", "{origin", "origin}", "{nope}", "{}"} {
+		_, err := ParseKeyTemplate(template)
+		require.Error(t, err, template)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log/slog"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/gfx-labs/venn/lib/util"
 	"sigs.k8s.io/yaml"
@@ -22,8 +23,8 @@ type GatewayConfigResult struct {
 	Nats      *Nats
 	Telemetry *Telemetry
 
-	Endpoint *EndpointSpec
-	Security *Security
+	Endpoints []*EndpointSpec
+	Security  *Security
 
 	Log *slog.Logger
 }
@@ -85,8 +86,8 @@ func GatewayFileParser(file string) func() (GatewayConfigResult, error) {
 			Nats:      cfg.Nats,
 			Telemetry: cfg.Telemetry,
 
-			Security: cfg.Security,
-			Endpoint: cfg.Endpoint,
+			Security:  cfg.Security,
+			Endpoints: cfg.Endpoints,
 		}
 		return res, nil
 	}
@@ -105,16 +106,74 @@ func ParseGatewayConfig(file string, data []byte) (*GatewayConfig, error) {
 	if c.Security == nil {
 		c.Security = &Security{}
 	}
-	for idx, v := range c.Endpoint.Limits.Abuse {
-		if v.Id == "" {
-			return nil, fmt.Errorf("endpoint abuse limit %d has no id", idx)
-		}
+	// the endpoint is the first of the endpoints
+	if c.Endpoint != nil {
+		c.Endpoints = append([]*EndpointSpec{c.Endpoint}, c.Endpoints...)
+	}
+	if len(c.Endpoints) == 0 {
+		return nil, fmt.Errorf("no endpoints")
 	}
-	for idx, v := range c.Endpoint.Limits.Usage {
-		if v.Id == "" {
-			return nil, fmt.Errorf("endpointusage limit %d has no id", idx)
+	names := make(map[string]struct{}, len(c.Endpoints))
+	routes := make(map[string]string, len(c.Endpoints))
+	for _, e := range c.Endpoints {
+		if e == nil || e.Name == "" {
+			return nil, fmt.Errorf("endpoint without a name")
+		}
+		// the name keys the limits and usage of the endpoint
+		if _, ok := names[e.Name]; ok {
+			return nil, fmt.Errorf("duplicate endpoint %s", e.Name)
+		}
+		names[e.Name] = struct{}{}
+		if err := parseEndpoint(c, e); err != nil {
+			return nil, fmt.Errorf("endpoint %s: %w", e.Name, err)
+		}
+		route := e.Host + e.Prefix
+		if other, ok := routes[route]; ok {
+			return nil, fmt.Errorf("endpoints %s and %s have the same host and prefix", other, e.Name)
 		}
+		routes[route] = e.Name
 	}
 
 	return c, nil
 }
+
+func parseEndpoint(c *GatewayConfig, e *EndpointSpec) error {
+	e.Host = strings.ToLower(e.Host)
+	// a prefix of only slashes is the root, which is served without a prefix
+	if prefix := strings.Trim(e.Prefix, "/"); prefix != "" {
+		e.Prefix = "/" + prefix
+	} else {
+		e.Prefix = ""
+	}
+	if e.Security == nil {
+		e.Security = c.Security
+	}
+	if err := e.Limits.Validate(); err != nil {
+		return err
+	}
+	if e.Costs != nil {
+		e.Costs.LogsMaxSpan = util.Coa(e.Costs.LogsMaxSpan, 10000)
+		if err := e.Costs.Validate(); err != nil {
+			return fmt.Errorf("costs: %w", err)
+		}
+	}
+	if keys := e.Keys; keys != nil {
+		if keys.Header == "" && keys.Query == "" && !keys.PathSegment {
+			keys.Header = "X-Api-Key"
+		}
+		keys.Source = util.Coa(keys.Source, ApiKeySourceRedis)
+		switch keys.Source {
+		case ApiKeySourceRedis:
+		case ApiKeySourceFile:
+			if keys.File == "" {
+				return fmt.Errorf("api keys are read from a file, but no file is set")
+			}
+		default:
+			return fmt.Errorf("invalid api key source: %s", keys.Source)
+		}
+		if keys.Refresh.Duration <= 0 {
+			keys.Refresh.Duration = 10 * time.Second
+		}
+	}
+	return nil
+}
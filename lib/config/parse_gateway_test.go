@@ -0,0 +1,23 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEndpoint_Prefix(t *testing.T) {
+	for prefix, want := range map[string]string{
+		"":           "",
+		"/":          "",
+		"//":         "",
+		"public":     "/public",
+		"/public/":   "/public",
+		"/public/v2": "/public/v2",
+	} {
+		e := &EndpointSpec{Name: "test", Host: "RPC.example.com", Prefix: prefix}
+		require.NoError(t, parseEndpoint(&GatewayConfig{}, e), prefix)
+		require.Equal(t, want, e.Prefix, prefix)
+		require.Equal(t, "rpc.example.com", e.Host)
+	}
+}
@@ -19,6 +19,8 @@ type NodeConfigResult struct {
 
 	HTTP      *HTTP
 	Redis     *Redis
+	Nats      *Nats      `optional:"true"`
+	Diskstore *Diskstore `optional:"true"`
 	Ratelimit *AbuseLimit
 	Election  *Election
 	Chains    map[string]*Chain
@@ -83,6 +85,8 @@ func NodeFileParser(file string) func() (NodeConfigResult, error) {
 		res := NodeConfigResult{
 			HTTP:      &cfg.HTTP,
 			Redis:     &cfg.Redis,
+			Nats:      cfg.Nats,
+			Diskstore: cfg.Diskstore,
 			Ratelimit: cfg.Ratelimit,
 			Chains:    make(map[string]*Chain, len(cfg.Chains)),
 			Remotes:   remotes,
@@ -118,9 +122,27 @@ func ParseNodeConfig(file string, data []byte) (*NodeConfig, error) {
 	c.Redis.Namespace = util.Coa(c.Redis.Namespace, "venn-undefined")
 	c.Redis.URI = util.Coa(c.Redis.URI, "embedded")
 
+	if c.Nats != nil {
+		c.Nats.Namespace = util.Coa(c.Nats.Namespace, c.Redis.Namespace)
+	}
+
+	if c.Diskstore != nil {
+		if c.Diskstore.Path == "" {
+			return nil, fmt.Errorf("diskstore: path is required")
+		}
+		c.Diskstore.FinalityDepth = util.Coa(c.Diskstore.FinalityDepth, 128)
+		c.Diskstore.PruneInterval = util.Coa(c.Diskstore.PruneInterval, Duration{time.Minute})
+	}
+
 	if c.Ratelimit != nil {
 		c.Ratelimit.Total = util.Coa(c.Ratelimit.Total, 2000)
 		c.Ratelimit.Window = util.Coa(c.Ratelimit.Window, Duration{time.Second * 10})
+		if c.Ratelimit.Costs != nil {
+			c.Ratelimit.Costs.LogsMaxSpan = util.Coa(c.Ratelimit.Costs.LogsMaxSpan, 10000)
+			if err := c.Ratelimit.Costs.Validate(); err != nil {
+				return nil, fmt.Errorf("ratelimit costs: %w", err)
+			}
+		}
 	}
 
 	// add all the filters from the presets block to the remotes
@@ -133,6 +155,48 @@ func ParseNodeConfig(file string, data []byte) (*NodeConfig, error) {
 			return nil, err
 		}
 
+		if len(v.HeadOracles) > 0 {
+			v.HeadOracleStrategy = util.Coa(v.HeadOracleStrategy, HeadOracleStrategyMaxTrim)
+			switch v.HeadOracleStrategy {
+			case HeadOracleStrategyMaxTrim, HeadOracleStrategyMedian:
+			default:
+				return nil, fmt.Errorf("chain %s: unknown head oracle strategy %q", v.Name, v.HeadOracleStrategy)
+			}
+			v.HeadOracleInterval = util.Coa(v.HeadOracleInterval, Duration{15 * time.Second})
+			v.HeadLagThreshold = util.Coa(v.HeadLagThreshold, 10)
+		}
+
+		v.SelectionStrategy = util.Coa(v.SelectionStrategy, SelectionStrategyRoundRobin)
+		switch v.SelectionStrategy {
+		case SelectionStrategyRoundRobin, SelectionStrategyWeightedRandom, SelectionStrategyLeastLatency, SelectionStrategyPowerOfTwo:
+		default:
+			return nil, fmt.Errorf("chain %s: unknown selection strategy %q", v.Name, v.SelectionStrategy)
+		}
+
+		if v.LogCache != nil {
+			v.LogCache.ChunkSize = util.Coa(v.LogCache.ChunkSize, 20)
+			v.LogCache.MaxRange = util.Coa(v.LogCache.MaxRange, 5000)
+			v.LogCache.FilteredRun = util.Coa(v.LogCache.FilteredRun, 100)
+		}
+
+		if v.Hedge != nil {
+			v.Hedge.Percentile = util.Coa(v.Hedge.Percentile, 95)
+			if v.Hedge.Percentile <= 0 || v.Hedge.Percentile > 100 {
+				return nil, fmt.Errorf("chain %s: hedge percentile must be between 0 and 100", v.Name)
+			}
+			v.Hedge.MinDelay = util.Coa(v.Hedge.MinDelay, Duration{50 * time.Millisecond})
+			v.Hedge.MaxDelay = util.Coa(v.Hedge.MaxDelay, Duration{2 * time.Second})
+			if v.Hedge.MaxDelay.Duration < v.Hedge.MinDelay.Duration {
+				return nil, fmt.Errorf("chain %s: hedge max_delay must not be less than min_delay", v.Name)
+			}
+			for _, method := range v.Hedge.Methods {
+				switch method {
+				case "eth_sendRawTransaction", "eth_sendTransaction":
+					return nil, fmt.Errorf("chain %s: %s cannot be hedged", v.Name, method)
+				}
+			}
+		}
+
 		for _, vv := range v.Remotes {
 			if v.Name == "health" {
 				return nil, fmt.Errorf(`chain name cannot be "%s"`, v.Name)
@@ -142,6 +206,16 @@ func ParseNodeConfig(file string, data []byte) (*NodeConfig, error) {
 				vv.Headers[key] = os.ExpandEnv(value)
 			}
 
+			if vv.WsUrl == "" && (strings.HasPrefix(string(vv.Url), "ws://") || strings.HasPrefix(string(vv.Url), "wss://")) {
+				vv.WsUrl = vv.Url
+			}
+			if vv.WsUrl != "" && !strings.HasPrefix(string(vv.WsUrl), "ws://") && !strings.HasPrefix(string(vv.WsUrl), "wss://") {
+				return nil, fmt.Errorf("remote %s: ws_url must be a websocket url", vv.Name)
+			}
+			if vv.PushHeads && vv.WsUrl == "" {
+				return nil, fmt.Errorf("remote %s: push_heads requires a websocket url", vv.Name)
+			}
+
 			if vv.HealthCheckIntervalMin.Duration == 0 {
 				vv.HealthCheckIntervalMin = Duration{time.Minute}
 			}
@@ -155,7 +229,24 @@ func ParseNodeConfig(file string, data []byte) (*NodeConfig, error) {
 				vv.ErrorBackoffMin = Duration{5 * time.Second}
 			}
 			if vv.ErrorBackoffMax.Duration == 0 {
-				vv.ErrorBackoffMax = Duration{5 * time.Second}
+				vv.ErrorBackoffMax = Duration{time.Minute}
+			}
+			vv.ErrorBackoffMax.Duration = max(vv.ErrorBackoffMax.Duration, vv.ErrorBackoffMin.Duration)
+
+			vv.Circuit.ErrorRate = util.Coa(vv.Circuit.ErrorRate, 0.5)
+			if vv.Circuit.ErrorRate <= 0 || vv.Circuit.ErrorRate > 1 {
+				return nil, fmt.Errorf("remote %s: circuit error_rate must be between 0 and 1", vv.Name)
+			}
+			vv.Circuit.MinRequests = util.Coa(vv.Circuit.MinRequests, 10)
+			vv.Circuit.Window = util.Coa(vv.Circuit.Window, Duration{30 * time.Second})
+			vv.Circuit.Probes = util.Coa(vv.Circuit.Probes, 3)
+
+			if vv.Batch != nil {
+				vv.Batch.MaxSize = util.Coa(vv.Batch.MaxSize, 20)
+				vv.Batch.Linger = util.Coa(vv.Batch.Linger, Duration{2 * time.Millisecond})
+				if vv.Batch.MaxSize < 2 {
+					return nil, fmt.Errorf("remote %s: batch max_size must be at least 2", vv.Name)
+				}
 			}
 
 			vv.ParsedFilters = make([]*Filter, 0, len(vv.Filters))
@@ -0,0 +1,319 @@
+package election
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gfx.cafe/util/go/fxplus"
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	// leaseTTL is how long a lease lasts without being extended. leases are extended every second
+	leaseTTL = 5 * time.Second
+	// leaderShard is the shard of the lease handed out by AcquireLease, which every member runs for
+	leaderShard = "leader"
+)
+
+// NatsKVStrategy runs the election on a jetstream key value bucket. a lease is a key which is created by the member
+// taking it and then only updated at the revision it last saw, so two members can never both think they hold it. keys
+// which are not updated expire with the ttl of the bucket. the revision a lease was created at is its fencing token.
+type NatsKVStrategy struct {
+	log  *slog.Logger
+	kv   jetstream.KeyValue
+	name string
+
+	isLeader atomic.Bool
+
+	mu     sync.Mutex
+	shards map[string]*shardState
+}
+
+func NewNatsKVStrategy(
+	namespace string,
+	conn *nats.Conn,
+	logger *slog.Logger,
+) (*NatsKVStrategy, error) {
+	js, err := jetstream.New(conn)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      kvToken(namespace) + "_election",
+		Description: "venn leader election",
+		History:     1,
+		TTL:         leaseTTL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create election bucket: %w", err)
+	}
+
+	m := &NatsKVStrategy{
+		log: logger,
+		kv:  kv,
+		shards: map[string]*shardState{
+			leaderShard: {},
+		},
+	}
+	// the hostname tells the members apart when looking at who holds which shard
+	id := uuid.New().String()
+	m.name = id
+	if host, err := os.Hostname(); err == nil && host != "" {
+		m.name = kvToken(host) + "-" + id[:8]
+	}
+	return m, nil
+}
+
+// kvToken returns s with every character which may not be part of a key token replaced
+func kvToken(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '=':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
+
+func (m *NatsKVStrategy) shardKey(shard string) string {
+	return "shards." + kvToken(shard)
+}
+
+func (m *NatsKVStrategy) candidateKey(shard string) string {
+	return "candidates." + kvToken(shard) + "." + m.name
+}
+
+func (m *NatsKVStrategy) IsLeader() bool {
+	return m.isLeader.Load()
+}
+
+func (m *NatsKVStrategy) ID() string {
+	return m.name
+}
+
+// Join will join the election and error if it cannot
+// it will run until ctx is cancelled, and then release every lease it holds
+func (m *NatsKVStrategy) Join(ctx context.Context) error {
+	if _, err := m.kv.Status(ctx); err != nil {
+		return err
+	}
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			if err := m.loop(ctx); err != nil && !fxplus.IsShutdownOrCancel(err) {
+				m.log.Error("leader election errored", "err", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				rctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+				m.release(rctx)
+				cancel()
+				m.log.Info("election loop shutdown", "name", m.name)
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (m *NatsKVStrategy) AcquireLease(ctx context.Context) <-chan context.Context {
+	return m.AcquireShardLease(ctx, leaderShard)
+}
+
+func (m *NatsKVStrategy) AcquireShardLease(ctx context.Context, shard string) <-chan context.Context {
+	o := make(chan context.Context, 1)
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state, ok := m.shards[shard]
+	if !ok {
+		state = &shardState{}
+		m.shards[shard] = state
+	}
+	state.ctxs = append(state.ctxs, spawnedCtx{
+		ctx: ctx,
+		ch:  o,
+	})
+	notifyShard(state)
+	return o
+}
+
+func (m *NatsKVStrategy) Owners(ctx context.Context, shards []string) (map[string]string, error) {
+	owners := make(map[string]string, len(shards))
+	for _, shard := range shards {
+		entry, err := m.kv.Get(ctx, m.shardKey(shard))
+		if errors.Is(err, jetstream.ErrKeyNotFound) || errors.Is(err, jetstream.ErrKeyDeleted) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		owners[shard] = string(entry.Value())
+	}
+	return owners, nil
+}
+
+// candidates returns the members asking for each shard, by key token of the shard
+func (m *NatsKVStrategy) candidates(ctx context.Context) (map[string][]string, error) {
+	lister, err := m.kv.ListKeysFiltered(ctx, "candidates.>")
+	if err != nil {
+		return nil, err
+	}
+	defer lister.Stop()
+	candidates := make(map[string][]string)
+	for key := range lister.Keys() {
+		shard, member, ok := strings.Cut(strings.TrimPrefix(key, "candidates."), ".")
+		if !ok {
+			continue
+		}
+		candidates[shard] = append(candidates[shard], member)
+	}
+	return candidates, nil
+}
+
+// loop is a single loop of the election. it is not safe to run in more than one thread
+func (m *NatsKVStrategy) loop(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// the leases are released on shutdown instead
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	var errs []error
+	// every member asking for a shard is a candidate for it. the candidate keys expire with the ttl of the bucket
+	for name := range m.shards {
+		if name == leaderShard {
+			continue
+		}
+		if _, err := m.kv.Put(ctx, m.candidateKey(name), nil); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	candidates, err := m.candidates(ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	for name, shard := range m.shards {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := m.updateShard(ctx, name, shard, candidates[kvToken(name)]); err != nil {
+			errs = append(errs, fmt.Errorf("shard %s: %w", name, err))
+		}
+		notifyShard(shard)
+		if name != leaderShard && len(shard.ctxs) == 0 {
+			if shard.held {
+				if err := m.kv.Delete(ctx, m.shardKey(name), jetstream.LastRevision(shard.rev)); err != nil {
+					errs = append(errs, fmt.Errorf("shard %s: %w", name, err))
+				}
+			}
+			_ = m.kv.Delete(ctx, m.candidateKey(name))
+			delete(m.shards, name)
+		}
+	}
+
+	isLeader := m.shards[leaderShard].held
+	if wasLeader := m.isLeader.Swap(isLeader); wasLeader != isLeader {
+		m.log.Info("leadership changed", "name", m.name, "leader", isLeader)
+	}
+	return errors.Join(errs...)
+}
+
+func (m *NatsKVStrategy) updateShard(ctx context.Context, name string, shard *shardState, candidates []string) error {
+	key := m.shardKey(name)
+	// anybody may take the leader lease, the other shards belong to one of their candidates
+	preferred := m.name
+	if name != leaderShard {
+		preferred = preferredMember(name, append(candidates, m.name))
+	}
+	if shard.held {
+		// hand the shard over to the member it belongs to, which takes it on its next loop
+		if preferred != m.name {
+			m.log.Info("handing over shard", "shard", name, "to", preferred)
+			shard.held = false
+			return m.kv.Delete(ctx, key, jetstream.LastRevision(shard.rev))
+		}
+		// the update fails if anybody else wrote the key since, which means the lease expired and was taken over
+		rev, err := m.kv.Update(ctx, key, []byte(m.name), shard.rev)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			shard.held = false
+			m.log.Warn("lost shard lease", "shard", name, "err", err)
+			return err
+		}
+		shard.rev = rev
+		return nil
+	}
+
+	_, err := m.kv.Get(ctx, key)
+	if err == nil {
+		shard.unheldSince = time.Time{}
+		return nil
+	}
+	if !errors.Is(err, jetstream.ErrKeyNotFound) && !errors.Is(err, jetstream.ErrKeyDeleted) {
+		return err
+	}
+	if shard.unheldSince.IsZero() {
+		shard.unheldSince = time.Now()
+	}
+	// the member the shard belongs to takes it right away. the others give it a chance to do so first
+	if preferred != m.name && time.Since(shard.unheldSince) < shardGrace {
+		return nil
+	}
+	rev, err := m.kv.Create(ctx, key, []byte(m.name))
+	if errors.Is(err, jetstream.ErrKeyExists) {
+		// somebody else was faster
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	shard.held = true
+	shard.rev = rev
+	shard.token = rev
+	shard.unheldSince = time.Time{}
+	m.log.Info("obtained shard lease", "shard", name, "token", rev)
+	return nil
+}
+
+// release releases every held lease and leaves the candidates of every shard, so that the other members take them
+// over without waiting for the leases to expire
+func (m *NatsKVStrategy) release(ctx context.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, shard := range m.shards {
+		if shard.held {
+			if err := m.kv.Delete(ctx, m.shardKey(name), jetstream.LastRevision(shard.rev)); err != nil {
+				m.log.Error("failed to release shard lease", "shard", name, "err", err)
+			}
+		}
+		shard.held = false
+		notifyShard(shard)
+		if name != leaderShard {
+			_ = m.kv.Delete(ctx, m.candidateKey(name))
+		}
+	}
+	m.isLeader.Store(false)
+}
+
+var _ Strategy = (*NatsKVStrategy)(nil)
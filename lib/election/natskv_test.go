@@ -0,0 +1,101 @@
+package election
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func runServer(t *testing.T) *server.Server {
+	ns, err := server.NewServer(&server.Options{
+		Port:      server.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+	})
+	require.NoError(t, err)
+	ns.Start()
+	require.True(t, ns.ReadyForConnections(5*time.Second))
+	t.Cleanup(func() {
+		ns.Shutdown()
+		ns.WaitForShutdown()
+	})
+	return ns
+}
+
+func newNatsKV(t *testing.T, ctx context.Context, ns *server.Server, name string) *NatsKVStrategy {
+	conn, err := nats.Connect(ns.ClientURL())
+	require.NoError(t, err)
+	t.Cleanup(conn.Close)
+	m, err := NewNatsKVStrategy("test", conn, slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	m.name = name
+	require.NoError(t, m.Join(ctx))
+	return m
+}
+
+func TestNatsKVStrategy_Failover(t *testing.T) {
+	ns := runServer(t)
+	ctx := context.Background()
+	actx, stopA := context.WithCancel(ctx)
+	defer stopA()
+	bctx, stopB := context.WithCancel(ctx)
+	defer stopB()
+
+	a := newNatsKV(t, actx, ns, "a")
+	b := newNatsKV(t, bctx, ns, "b")
+
+	shards := []string{"one", "two", "three", "four", "five", "six"}
+	leases := make(map[string]map[string]<-chan context.Context)
+	for _, m := range []*NatsKVStrategy{a, b} {
+		leases[m.name] = make(map[string]<-chan context.Context)
+		for _, shard := range shards {
+			leases[m.name][shard] = m.AcquireShardLease(ctx, shard)
+		}
+	}
+
+	// every shard ends up with the member it belongs to
+	require.Eventually(t, func() bool {
+		owners, err := a.Owners(ctx, shards)
+		if err != nil || len(owners) != len(shards) {
+			return false
+		}
+		for _, shard := range shards {
+			if owners[shard] != preferredMember(shard, []string{"a", "b"}) {
+				return false
+			}
+		}
+		return true
+	}, 15*time.Second, 100*time.Millisecond)
+	require.True(t, a.IsLeader() != b.IsLeader())
+
+	// the shards of a member which leaves are taken over, under a higher fencing token
+	tokens := make(map[string]uint64)
+	for _, shard := range shards {
+		if preferredMember(shard, []string{"a", "b"}) != "a" {
+			continue
+		}
+		lease := <-leases["a"][shard]
+		token, ok := Fence(lease)
+		require.True(t, ok)
+		tokens[shard] = token
+	}
+	require.NotEmpty(t, tokens)
+	stopA()
+	for shard, token := range tokens {
+		select {
+		case lease := <-b.AcquireShardLease(ctx, shard):
+			next, ok := Fence(lease)
+			require.True(t, ok)
+			require.Greater(t, next, token)
+		case <-time.After(15 * time.Second):
+			t.Fatalf("shard %s was not taken over", shard)
+		}
+	}
+	require.Eventually(t, b.IsLeader, 15*time.Second, 100*time.Millisecond)
+}
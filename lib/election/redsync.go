@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"os"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -19,6 +20,7 @@ import (
 type spawnedCtx struct {
 	ctx    context.Context
 	ch     chan context.Context
+	lease  context.Context
 	cancel context.CancelCauseFunc
 }
 
@@ -28,13 +30,17 @@ type RedilockStrategy struct {
 	namespace string
 	redis     redis.UniversalClient
 
-	id uuid.UUID
+	id   uuid.UUID
+	name string
 
 	isLeader   atomic.Bool
 	leaderLock *redsync.Mutex
 
 	mu   sync.Mutex
 	ctxs []spawnedCtx
+
+	shardMu sync.Mutex
+	shards  map[string]*shardState
 }
 
 // Join will join the election and error if it cannot
@@ -48,6 +54,7 @@ func (m *RedilockStrategy) Join(ctx context.Context) error {
 		return err
 	}
 	m.log.Info("i think the leader is", "knownLeader", knownLeader)
+	go m.runShards(ctx)
 	go func() {
 		ticker := time.NewTicker(1 * time.Second)
 		defer func() {
@@ -85,13 +92,19 @@ func NewRedilockStrategy(
 	logger *slog.Logger,
 ) *RedilockStrategy {
 	m := &RedilockStrategy{
-		log:   logger,
-		redis: client,
+		log:    logger,
+		redis:  client,
+		shards: make(map[string]*shardState),
 	}
 	rs := redsync.New(goredis.NewPool(client))
 	m.leaderLock = rs.NewMutex(fmt.Sprintf("%s:leader:redsync", namespacePrefix))
 	m.namespace = namespacePrefix
 	m.id = uuid.New()
+	// the hostname tells the members apart when looking at who holds which shard
+	m.name = m.id.String()
+	if host, err := os.Hostname(); err == nil && host != "" {
+		m.name = host + "-" + m.name[:8]
+	}
 	return m
 }
 
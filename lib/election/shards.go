@@ -0,0 +1,303 @@
+package election
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"gfx.cafe/util/go/fxplus"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// shardTTL is how long a shard lease lasts without being extended. leases are extended every second
+	shardTTL = 5 * time.Second
+	// shardGrace is how long a shard may go without an owner before members other than the one it belongs to take it
+	shardGrace = 3 * time.Second
+	// candidateTTL is how long a member stays a candidate for a shard after it last asked for it
+	candidateTTL = 5 * time.Second
+)
+
+var (
+	// extendShard extends the lease of a shard, if it is still held by the member
+	extendShard = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+	// releaseShard deletes the lease of a shard, if it is still held by the member
+	releaseShard = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+	// joinCandidates makes the member a candidate for a shard, expires the candidates which stopped asking for it, and
+	// returns the ones left. it goes by the clock of redis, so that the clocks of the members do not have to agree
+	joinCandidates = redis.NewScript(`
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local ttl = tonumber(ARGV[2])
+redis.call("ZADD", KEYS[1], now, ARGV[1])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - ttl)
+redis.call("PEXPIRE", KEYS[1], 2 * ttl)
+return redis.call("ZRANGE", KEYS[1], 0, -1)
+`)
+)
+
+type shardState struct {
+	ctxs        []spawnedCtx
+	held        bool
+	unheldSince time.Time
+
+	// rev is the revision of the lease, and token its fencing token, for strategies which have them
+	rev   uint64
+	token uint64
+}
+
+// preferredMember returns the member a shard belongs to. rendezvous hashing spreads the shards evenly across the
+// members, and only moves the shards of a member when it joins or leaves.
+func preferredMember(shard string, members []string) string {
+	var best string
+	var bestScore uint64
+	for _, member := range members {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(shard))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(member))
+		if score := h.Sum64(); best == "" || score > bestScore {
+			best, bestScore = member, score
+		}
+	}
+	return best
+}
+
+// notifyShard hands out the lease of the shard to everybody waiting for it while it is held, and cancels the leases
+// which were handed out once it is not
+func notifyShard(shard *shardState) {
+	ctxs := make([]spawnedCtx, 0, len(shard.ctxs))
+	for _, v := range shard.ctxs {
+		switch {
+		case v.cancel != nil:
+			if !shard.held {
+				v.cancel(ErrLostLeadership)
+				continue
+			}
+			// the holder of the lease is done with it
+			if v.lease.Err() != nil {
+				continue
+			}
+		case v.ctx.Err() != nil:
+			// gave up waiting for the lease
+			continue
+		case shard.held:
+			parent := v.ctx
+			if shard.token != 0 {
+				parent = context.WithValue(parent, fenceKey{}, shard.token)
+			}
+			lease, cancel := context.WithCancelCause(parent)
+			v.ctx = nil
+			v.lease = lease
+			v.cancel = cancel
+			v.ch <- lease
+			close(v.ch)
+		}
+		ctxs = append(ctxs, v)
+	}
+	shard.ctxs = ctxs
+}
+
+func (m *RedilockStrategy) shardKey(shard string) string {
+	return fmt.Sprintf("%s:shard:%s", m.namespace, shard)
+}
+
+func (m *RedilockStrategy) candidatesKey(shard string) string {
+	return fmt.Sprintf("%s:shard:%s:candidates", m.namespace, shard)
+}
+
+func (m *RedilockStrategy) ID() string {
+	return m.name
+}
+
+func (m *RedilockStrategy) AcquireShardLease(ctx context.Context, shard string) <-chan context.Context {
+	o := make(chan context.Context, 1)
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	m.shardMu.Lock()
+	defer m.shardMu.Unlock()
+	state, ok := m.shards[shard]
+	if !ok {
+		state = &shardState{}
+		m.shards[shard] = state
+	}
+	state.ctxs = append(state.ctxs, spawnedCtx{
+		ctx: ctx,
+		ch:  o,
+	})
+	notifyShard(state)
+	return o
+}
+
+func (m *RedilockStrategy) Owners(ctx context.Context, shards []string) (map[string]string, error) {
+	owners := make(map[string]string, len(shards))
+	if len(shards) == 0 {
+		return owners, nil
+	}
+	keys := make([]string, 0, len(shards))
+	for _, shard := range shards {
+		keys = append(keys, m.shardKey(shard))
+	}
+	values, err := m.redis.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, value := range values {
+		if owner, ok := value.(string); ok {
+			owners[shards[i]] = owner
+		}
+	}
+	return owners, nil
+}
+
+// runShards keeps the shard leases up to date until ctx is cancelled, and then releases the held ones so that the
+// other members can take them over right away
+func (m *RedilockStrategy) runShards(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		if err := m.shardLoop(ctx); err != nil && !fxplus.IsShutdownOrCancel(err) {
+			m.log.Error("shard election errored", "err", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			rctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			m.releaseShards(rctx)
+			cancel()
+			return
+		}
+	}
+}
+
+// shardLoop is a single loop of the shard election. it is not safe to run in more than one thread
+func (m *RedilockStrategy) shardLoop(ctx context.Context) error {
+	m.shardMu.Lock()
+	defer m.shardMu.Unlock()
+	// the leases are released on shutdown instead
+	if len(m.shards) == 0 || ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	// every member asking for a shard is a candidate for it
+	pipe := m.redis.Pipeline()
+	candidates := make(map[string]*redis.Cmd, len(m.shards))
+	for name := range m.shards {
+		candidates[name] = joinCandidates.Eval(ctx, pipe, []string{m.candidatesKey(name)}, m.name, candidateTTL.Milliseconds())
+	}
+	_, err := pipe.Exec(ctx)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	var errs []error
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for name, shard := range m.shards {
+		if ctx.Err() != nil {
+			break
+		}
+		if err == nil {
+			members, serr := candidates[name].StringSlice()
+			if serr == nil {
+				serr = m.updateShard(ctx, name, shard, members)
+			}
+			if serr != nil {
+				errs = append(errs, fmt.Errorf("shard %s: %w", name, serr))
+			}
+		} else if shard.held {
+			// the lease can not be extended without redis, so it must be assumed lost
+			shard.held = false
+			m.log.Warn("lost shard lease", "shard", name, "err", err)
+		}
+		notifyShard(shard)
+		if len(shard.ctxs) == 0 {
+			if shard.held {
+				if err := releaseShard.Run(ctx, m.redis, []string{m.shardKey(name)}, m.name).Err(); err != nil {
+					errs = append(errs, fmt.Errorf("shard %s: %w", name, err))
+				}
+			}
+			delete(m.shards, name)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m *RedilockStrategy) updateShard(ctx context.Context, name string, shard *shardState, candidates []string) error {
+	key := m.shardKey(name)
+	preferred := preferredMember(name, candidates)
+	if shard.held {
+		// hand the shard over to the member it belongs to, which takes it on its next loop
+		if preferred != m.name {
+			m.log.Info("handing over shard", "shard", name, "to", preferred)
+			shard.held = false
+			return releaseShard.Run(ctx, m.redis, []string{key}, m.name).Err()
+		}
+		extended, err := extendShard.Run(ctx, m.redis, []string{key}, m.name, shardTTL.Milliseconds()).Int()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil || extended == 0 {
+			shard.held = false
+			m.log.Warn("lost shard lease", "shard", name, "err", err)
+		}
+		return err
+	}
+
+	owner, err := m.redis.Get(ctx, key).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+	if owner != "" {
+		shard.unheldSince = time.Time{}
+		return nil
+	}
+	if shard.unheldSince.IsZero() {
+		shard.unheldSince = time.Now()
+	}
+	// the member the shard belongs to takes it right away. the others give it a chance to do so first
+	if preferred != m.name && time.Since(shard.unheldSince) < shardGrace {
+		return nil
+	}
+	ok, err := m.redis.SetNX(ctx, key, m.name, shardTTL).Result()
+	if err != nil {
+		return err
+	}
+	if ok {
+		shard.held = true
+		shard.unheldSince = time.Time{}
+		m.log.Info("obtained shard lease", "shard", name)
+	}
+	return nil
+}
+
+// releaseShards releases the shard leases and leaves the candidates of every shard, so that the other members take
+// them over without waiting for the leases to expire
+func (m *RedilockStrategy) releaseShards(ctx context.Context) {
+	m.shardMu.Lock()
+	defer m.shardMu.Unlock()
+	for name, shard := range m.shards {
+		shard.held = false
+		notifyShard(shard)
+		if err := m.redis.ZRem(ctx, m.candidatesKey(name), m.name).Err(); err != nil {
+			m.log.Error("failed to leave shard candidates", "shard", name, "err", err)
+		}
+		if err := releaseShard.Run(ctx, m.redis, []string{m.shardKey(name)}, m.name).Err(); err != nil {
+			m.log.Error("failed to release shard lease", "shard", name, "err", err)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package election
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreferredMember(t *testing.T) {
+	members := []string{"a", "b", "c"}
+	counts := make(map[string]int)
+	for i := range 300 {
+		shard := fmt.Sprintf("shard-%d", i)
+		preferred := preferredMember(shard, members)
+		counts[preferred]++
+
+		// the order of the members does not matter
+		require.Equal(t, preferred, preferredMember(shard, []string{"c", "a", "b"}))
+		// and a member leaving only moves its own shards
+		if preferred != "c" {
+			require.Equal(t, preferred, preferredMember(shard, []string{"a", "b"}))
+		}
+	}
+	// the shards are spread across the members
+	for _, member := range members {
+		require.Greater(t, counts[member], 60, member)
+	}
+	require.Empty(t, preferredMember("shard", nil))
+}
+
+// testShards are members sharing a redis, which run the shard election by hand
+type testShards struct {
+	mr      *miniredis.Miniredis
+	members map[string]*RedilockStrategy
+	now     time.Time
+}
+
+func newTestShards(t *testing.T, names ...string) *testShards {
+	mr := miniredis.RunT(t)
+	// the candidates go by the clock of redis, which is moved along by step
+	now := time.Now()
+	mr.SetTime(now)
+	s := &testShards{
+		mr:      mr,
+		members: make(map[string]*RedilockStrategy),
+		now:     now,
+	}
+	for _, name := range names {
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() {
+			_ = client.Close()
+		})
+		m := NewRedilockStrategy("test", client, slog.New(slog.NewJSONHandler(io.Discard, nil)))
+		m.name = name
+		s.members[name] = m
+	}
+	return s
+}
+
+// loop runs a loop of the shard election for the members, in order
+func (T *testShards) loop(t *testing.T, names ...string) {
+	for _, name := range names {
+		require.NoError(t, T.members[name].shardLoop(context.Background()))
+	}
+}
+
+// step moves the clocks of redis forward by a loop
+func (T *testShards) step() {
+	T.now = T.now.Add(time.Second)
+	T.mr.SetTime(T.now)
+	T.mr.FastForward(time.Second)
+}
+
+func (T *testShards) owners(t *testing.T, shards []string) map[string]string {
+	owners, err := T.members["a"].Owners(context.Background(), shards)
+	require.NoError(t, err)
+	return owners
+}
+
+// shardOf returns a shard which belongs to the member, out of the members
+func shardOf(member string, members ...string) string {
+	for i := 0; ; i++ {
+		shard := fmt.Sprintf("shard-%d", i)
+		if preferredMember(shard, members) == member {
+			return shard
+		}
+	}
+}
+
+func testShardNames(n int) []string {
+	shards := make([]string, n)
+	for i := range shards {
+		shards[i] = fmt.Sprintf("shard-%d", i)
+	}
+	return shards
+}
+
+func TestShards_Assignment(t *testing.T) {
+	s := newTestShards(t, "a", "b", "c")
+	shards := testShardNames(12)
+	members := []string{"a", "b", "c"}
+	leases := make(map[string]map[string]<-chan context.Context)
+	for _, name := range members {
+		leases[name] = make(map[string]<-chan context.Context)
+		for _, shard := range shards {
+			leases[name][shard] = s.members[name].AcquireShardLease(context.Background(), shard)
+		}
+	}
+
+	// a asks first, so it takes every shard
+	s.loop(t, "a", "b", "c")
+	for shard, owner := range s.owners(t, shards) {
+		require.Equal(t, "a", owner, shard)
+	}
+	first := make(map[string]context.Context)
+	for _, shard := range shards {
+		first[shard] = <-leases["a"][shard]
+	}
+
+	// and then hands the shards of the others over to them
+	s.step()
+	s.loop(t, "a", "b", "c")
+	owners := s.owners(t, shards)
+	for _, shard := range shards {
+		preferred := preferredMember(shard, members)
+		require.Equal(t, preferred, owners[shard], shard)
+		if preferred == "a" {
+			require.NoError(t, first[shard].Err(), shard)
+			continue
+		}
+		require.ErrorIs(t, context.Cause(first[shard]), ErrLostLeadership, shard)
+		select {
+		case lease := <-leases[preferred][shard]:
+			require.NoError(t, lease.Err())
+		default:
+			t.Fatalf("%s did not get shard %s", preferred, shard)
+		}
+	}
+
+	// the leases are held from then on
+	for range 10 {
+		s.step()
+		s.loop(t, "a", "b", "c")
+	}
+	require.Equal(t, owners, s.owners(t, shards))
+}
+
+func TestShards_Failover(t *testing.T) {
+	s := newTestShards(t, "a", "b", "c")
+	shards := testShardNames(12)
+	leases := make(map[string]map[string]<-chan context.Context)
+	for _, name := range []string{"a", "b", "c"} {
+		leases[name] = make(map[string]<-chan context.Context)
+		for _, shard := range shards {
+			leases[name][shard] = s.members[name].AcquireShardLease(context.Background(), shard)
+		}
+	}
+	s.loop(t, "a", "b", "c")
+	s.step()
+	s.loop(t, "a", "b", "c")
+
+	// c goes away without releasing its shards. they are taken over once its leases expire, by the members they belong
+	// to among the ones left, and c is no longer a candidate by then
+	for range int(shardTTL / time.Second) {
+		s.step()
+		s.loop(t, "a", "b")
+	}
+	s.step()
+	s.loop(t, "a", "b")
+	owners := s.owners(t, shards)
+	for _, shard := range shards {
+		require.Equal(t, preferredMember(shard, []string{"a", "b"}), owners[shard], shard)
+	}
+	candidates, err := s.mr.ZMembers(s.members["a"].candidatesKey(shards[0]))
+	require.NoError(t, err)
+	slices.Sort(candidates)
+	require.Equal(t, []string{"a", "b"}, candidates)
+}
+
+func TestShards_Release(t *testing.T) {
+	s := newTestShards(t, "a", "b")
+	shards := testShardNames(8)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var leases []<-chan context.Context
+	for _, shard := range shards {
+		s.members["a"].AcquireShardLease(context.Background(), shard)
+		leases = append(leases, s.members["b"].AcquireShardLease(ctx, shard))
+	}
+	s.loop(t, "a", "b")
+	s.step()
+	s.loop(t, "a", "b")
+
+	// b shutting down releases its shards and leaves the candidates, so a takes them right away
+	s.members["b"].releaseShards(context.Background())
+	for i, shard := range shards {
+		if preferredMember(shard, []string{"a", "b"}) == "b" {
+			require.ErrorIs(t, context.Cause(<-leases[i]), ErrLostLeadership, shard)
+		}
+	}
+	// a lost the leases it handed over to b, so it asks for them again
+	var taken []<-chan context.Context
+	for _, shard := range shards {
+		if preferredMember(shard, []string{"a", "b"}) == "b" {
+			taken = append(taken, s.members["a"].AcquireShardLease(context.Background(), shard))
+		}
+	}
+	s.step()
+	s.loop(t, "a")
+	owners := s.owners(t, shards)
+	require.Len(t, owners, len(shards))
+	for shard, owner := range owners {
+		require.Equal(t, "a", owner, shard)
+	}
+	for _, lease := range taken {
+		require.NoError(t, (<-lease).Err())
+	}
+}
+
+func TestShards_Grace(t *testing.T) {
+	s := newTestShards(t, "a", "b")
+	shard := shardOf("b", "a", "b")
+	ctx := context.Background()
+	key := s.members["a"].shardKey(shard)
+
+	// b is a candidate, but does not take the shard while somebody else holds it
+	require.NoError(t, s.mr.Set(key, "z"))
+	s.members["b"].AcquireShardLease(ctx, shard)
+	s.loop(t, "b")
+	s.mr.Del(key)
+
+	// so a gives b the chance to take the shard which belongs to it first
+	lease := s.members["a"].AcquireShardLease(ctx, shard)
+	s.loop(t, "a")
+	require.Empty(t, s.owners(t, []string{shard}))
+
+	// and only takes it once the grace period is over
+	s.members["a"].shards[shard].unheldSince = time.Now().Add(-shardGrace)
+	s.loop(t, "a")
+	require.Equal(t, map[string]string{shard: "a"}, s.owners(t, []string{shard}))
+	require.NoError(t, (<-lease).Err())
+
+	// until b asks for it again, which hands it over
+	s.step()
+	s.loop(t, "b", "a", "b")
+	require.Equal(t, map[string]string{shard: "b"}, s.owners(t, []string{shard}))
+}
+
+func TestShards_Done(t *testing.T) {
+	s := newTestShards(t, "a")
+	ctx, cancel := context.WithCancel(context.Background())
+	lease := s.members["a"].AcquireShardLease(ctx, "shard")
+	s.loop(t, "a")
+	held := <-lease
+	require.NoError(t, held.Err())
+
+	// once nobody asks for the shard, it is released for the others
+	cancel()
+	require.Error(t, held.Err())
+	s.loop(t, "a")
+	require.Empty(t, s.owners(t, []string{"shard"}))
+	require.Empty(t, s.members["a"].shards)
+}
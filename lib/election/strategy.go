@@ -9,6 +9,15 @@ import (
 
 var ErrLostLeadership = errors.New("lost leadership")
 
+type fenceKey struct{}
+
+// Fence returns the fencing token of the lease the context was handed out for. tokens grow with every new lease of a
+// shard, so work done under a lease which was since taken over can be told apart. not every strategy has them.
+func Fence(ctx context.Context) (uint64, bool) {
+	token, ok := ctx.Value(fenceKey{}).(uint64)
+	return token, ok
+}
+
 type Announcement struct {
 	Id      uuid.UUID `gtrs:"id"`
 	Command string    `gtrs:"command"`
@@ -32,6 +41,14 @@ type Strategy interface {
 	// the context will close if either the parent context is cancelled, or leadership is lost
 	// if leadership is lost, context should error with ErrLostLeadership
 	AcquireLease(ctx context.Context) <-chan context.Context
+
+	// AcquireShardLease is AcquireLease for a single shard of the work, such as a chain
+	// every shard is leased to at most one member at a time, and the shards are spread across the members
+	AcquireShardLease(ctx context.Context, shard string) <-chan context.Context
+	// Owners returns the member holding the lease of each of the shards. shards which are not leased are left out
+	Owners(ctx context.Context, shards []string) (map[string]string, error)
+	// ID returns the name of this member, as returned by Owners
+	ID() string
 }
 
 type AlwaysLeader struct {
@@ -69,8 +86,26 @@ func (a *AlwaysLeader) AcquireLease(ctx context.Context) <-chan context.Context
 			return
 		}
 	}()
-	out := make(chan context.Context)
+	out := make(chan context.Context, 1)
 	out <- sctx
 	close(out)
 	return out
 }
+
+// AcquireShardLease returns a lease for the shard, which is always held
+func (a *AlwaysLeader) AcquireShardLease(ctx context.Context, shard string) <-chan context.Context {
+	return a.AcquireLease(ctx)
+}
+
+// Owners returns this member as the owner of every shard
+func (a *AlwaysLeader) Owners(ctx context.Context, shards []string) (map[string]string, error) {
+	owners := make(map[string]string, len(shards))
+	for _, shard := range shards {
+		owners[shard] = a.ID()
+	}
+	return owners, nil
+}
+
+func (a *AlwaysLeader) ID() string {
+	return "local"
+}
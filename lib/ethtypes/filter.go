@@ -131,44 +131,44 @@ type FilterQuery struct {
 	Topics    FilterQueryTopics          `json:"topics,omitempty"`
 }
 
-/*
+// SplitBlockRange splits the block range of the filter into size filters with the same addresses and topics. block
+// tags are replaced by bestBlock. ranges of less than 16 blocks are not split.
 func (filter *FilterQuery) SplitBlockRange(bestBlock int, size int) []*FilterQuery {
 	if filter.BlockHash != nil {
 		// blockhash provided, return self
 		return []*FilterQuery{filter}
 	}
 	// otherwise, it's a range query. see if from and to block are populated
-	if filter.FromBlock == nil {
-		filter.FromBlock = big.NewInt(int64(bestBlock))
-	}
-	if filter.ToBlock == nil {
-		filter.ToBlock = big.NewInt(int64(bestBlock))
-	}
-	from := filter.FromBlock.Int64()
-	to := filter.ToBlock.Int64()
-	if from <= 0 {
-		from = int64(bestBlock)
+	from := int64(bestBlock)
+	if filter.FromBlock != nil && *filter.FromBlock >= 0 {
+		from = filter.FromBlock.Int64()
 	}
-	if to <= 0 {
-		to = int64(bestBlock)
+	to := int64(bestBlock)
+	if filter.ToBlock != nil && *filter.ToBlock >= 0 {
+		to = filter.ToBlock.Int64()
 	}
 	// bad query,
 	if to-from < 0 {
 		from, to = to, from
 	}
-	if to-from < 16 {
+	newFilter := func(from, to int64) *FilterQuery {
+		fromBlock := BlockNumber(from)
+		toBlock := BlockNumber(to)
+		return &FilterQuery{
+			FromBlock: &fromBlock,
+			ToBlock:   &toBlock,
+			Addresses: filter.Addresses,
+			Topics:    filter.Topics,
+		}
+	}
+	if to-from < 16 || size <= 1 {
 		// too small, so forward.
-		thisFilter := &FilterQuery{}
-		thisFilter.Addresses = filter.Addresses
-		thisFilter.Topics = filter.Topics
-		thisFilter.FromBlock = big.NewInt(from)
-		thisFilter.ToBlock = big.NewInt(to)
-		return []*FilterQuery{thisFilter}
+		return []*FilterQuery{newFilter(from, to)}
 	}
 	// otherwise, iterate through in chunks of up to size (to - from) / size
 	chunkSize := (to - from) / int64(size)
 
-	filters := make([]*FilterQuery, 0, size)
+	filters := make([]*FilterQuery, 0, size+1)
 	curFrom := from
 	curTo := curFrom + chunkSize
 	done := false
@@ -177,18 +177,12 @@ func (filter *FilterQuery) SplitBlockRange(bestBlock int, size int) []*FilterQue
 			done = true
 			curTo = to
 		}
-		thisFilter := &FilterQuery{}
-		thisFilter.Addresses = filter.Addresses
-		thisFilter.Topics = filter.Topics
-		thisFilter.FromBlock = big.NewInt(curFrom)
-		thisFilter.ToBlock = big.NewInt(curTo)
-		filters = append(filters, thisFilter)
+		filters = append(filters, newFilter(curFrom, curTo))
 		curFrom = curTo + 1
 		curTo = curTo + 1 + chunkSize
 	}
 	return filters
 }
-*/
 
 /*
 type filterQueryMarshaling struct {
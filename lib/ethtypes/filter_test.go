@@ -1,6 +1,11 @@
 package ethtypes
 
-/*
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
 func TestFilterSplit(t *testing.T) {
 
 	type testCase struct {
@@ -11,9 +16,11 @@ func TestFilterSplit(t *testing.T) {
 	}
 
 	runTest := func(c *testCase) {
+		fromBlock := BlockNumber(c.orig[0])
+		toBlock := BlockNumber(c.orig[1])
 		toSplit := &FilterQuery{
-			FromBlock: BlockNumber(c.orig[0]),
-			ToBlock:   BlockNumber(c.orig[1]),
+			FromBlock: &fromBlock,
+			ToBlock:   &toBlock,
 		}
 		for _, splt := range toSplit.SplitBlockRange(c.orig[1], c.amt) {
 			c.res = append(c.res,
@@ -59,4 +66,3 @@ func TestFilterSplit(t *testing.T) {
 	}
 
 }
-*/
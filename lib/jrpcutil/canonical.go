@@ -0,0 +1,54 @@
+package jrpcutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+)
+
+// CanonicalJSON returns the json with insignificant differences removed: whitespace, the order of object keys and the
+// case of hex strings
+func CanonicalJSON(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 {
+		return "", nil
+	}
+	// numbers are kept as they are written, as float64 would merge large numbers which differ
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	var v any
+	if err := d.Decode(&v); err != nil {
+		return "", err
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return "", errors.New("invalid json: data after the value")
+	}
+	b, err := json.Marshal(lowerHex(v))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func lowerHex(v any) any {
+	switch vv := v.(type) {
+	case string:
+		if strings.HasPrefix(vv, "0x") || strings.HasPrefix(vv, "0X") {
+			return strings.ToLower(vv)
+		}
+		return vv
+	case []any:
+		for i := range vv {
+			vv[i] = lowerHex(vv[i])
+		}
+		return vv
+	case map[string]any:
+		for k := range vv {
+			vv[k] = lowerHex(vv[k])
+		}
+		return vv
+	default:
+		return v
+	}
+}
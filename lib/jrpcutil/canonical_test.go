@@ -0,0 +1,48 @@
+package jrpcutil
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{name: "whitespace", a: `[ {"a": 1} ]`, b: `[{"a":1}]`, same: true},
+		{name: "key order", a: `{"a":1,"b":2}`, b: `{"b":2,"a":1}`, same: true},
+		{name: "hex case", a: `["0xABCDEF"]`, b: `["0xabcdef"]`, same: true},
+		{name: "other strings keep their case", a: `["latest"]`, b: `["LATEST"]`},
+		{name: "different values", a: `{"a":1}`, b: `{"a":2}`},
+		// both round to the same float64
+		{name: "large numbers", a: `[9007199254740993]`, b: `[9007199254740992]`},
+		{name: "large numbers in objects", a: `{"gas":18446744073709551615}`, b: `{"gas":18446744073709551614}`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			a, err := CanonicalJSON(json.RawMessage(c.a))
+			require.NoError(t, err)
+			b, err := CanonicalJSON(json.RawMessage(c.b))
+			require.NoError(t, err)
+			if c.same {
+				require.Equal(t, a, b)
+			} else {
+				require.NotEqual(t, a, b)
+			}
+		})
+	}
+}
+
+func TestCanonicalJSON_Invalid(t *testing.T) {
+	for _, raw := range []string{`{`, `[1] [2]`, `nope`} {
+		_, err := CanonicalJSON(json.RawMessage(raw))
+		require.Error(t, err, raw)
+	}
+	got, err := CanonicalJSON(nil)
+	require.NoError(t, err)
+	require.Empty(t, got)
+}
@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"gfx.cafe/open/jrpc"
+	"gfx.cafe/open/jrpc/pkg/jsonrpc"
+
+	"github.com/gfx-labs/venn/lib/config"
+	"github.com/gfx-labs/venn/lib/ethtypes"
+)
+
+// Coster charges requests by the costs of their methods, by setting the ExtraCost of their identifier
+type Coster struct {
+	costs *config.MethodCosts
+}
+
+func NewCoster(costs *config.MethodCosts) *Coster {
+	return &Coster{
+		costs: costs,
+	}
+}
+
+// Cost returns what the request costs against the limits
+func (T *Coster) Cost(r *jsonrpc.Request) int {
+	cost := 1
+	if v, ok := T.costs.Methods[r.Method]; ok {
+		cost = v
+	}
+	if r.Method == "eth_getLogs" && T.costs.LogsBlocks > 0 {
+		cost += T.logsSpan(r.Params) / T.costs.LogsBlocks
+	}
+	if n := batchSize(r.Context()); n > 1 {
+		cost += T.costs.Batch
+	}
+	return cost
+}
+
+// logsSpan returns the number of blocks the range of the eth_getLogs params spans
+func (T *Coster) logsSpan(params json.RawMessage) int {
+	var filters []ethtypes.FilterQuery
+	if err := json.Unmarshal(params, &filters); err != nil || len(filters) == 0 {
+		return 0
+	}
+	filter := filters[0]
+	if filter.BlockHash != nil {
+		return 1
+	}
+	// a missing bound is the latest block
+	from, to := ethtypes.LatestBlockNumber, ethtypes.LatestBlockNumber
+	if filter.FromBlock != nil {
+		from = *filter.FromBlock
+	}
+	if filter.ToBlock != nil {
+		to = *filter.ToBlock
+	}
+	switch {
+	case from >= 0 && to >= 0:
+		return int(max(to-from, from-to)) + 1
+	case from < 0 && to < 0:
+		return 1
+	default:
+		return T.costs.LogsMaxSpan
+	}
+}
+
+// Middleware sets the ExtraCost of the identifier of the request. it must run after the identifier is set, and before
+// the limits
+func (T *Coster) Middleware(next jrpc.Handler) jrpc.Handler {
+	return jsonrpc.HandlerFunc(func(w jsonrpc.ResponseWriter, r *jsonrpc.Request) {
+		id, err := IdentifierFromContext(r.Context())
+		if err != nil {
+			w.Send(nil, err)
+			return
+		}
+		id.ExtraCost = T.Cost(r) - 1
+		next.ServeRPC(w, r)
+	})
+}
+
+type batchSizeKey struct{}
+
+func batchSize(ctx context.Context) int {
+	n, _ := ctx.Value(batchSizeKey{}).(int)
+	return n
+}
+
+// BatchSize counts the requests of http batches, so that the requests of a batch can be charged for it. it reads the
+// whole body, so bodies larger than maxBody are rejected
+func BatchSize(maxBody int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost || r.Body == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+			if err != nil {
+				var maxErr *http.MaxBytesError
+				if errors.As(err, &maxErr) {
+					http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+					return
+				}
+				http.Error(w, "failed to read body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			if trimmed := bytes.TrimLeft(body, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '[' {
+				var batch []json.RawMessage
+				if err := json.Unmarshal(trimmed, &batch); err == nil {
+					r = r.WithContext(context.WithValue(r.Context(), batchSizeKey{}, len(batch)))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
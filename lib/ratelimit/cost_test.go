@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gfx.cafe/open/jrpc/pkg/jsonrpc"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gfx-labs/venn/lib/config"
+)
+
+func TestCoster_LogsSpan(t *testing.T) {
+	coster := NewCoster(&config.MethodCosts{LogsMaxSpan: 5000})
+	cases := []struct {
+		name   string
+		params string
+		want   int
+	}{
+		{name: "range", params: `[{"fromBlock":"0x10","toBlock":"0x1f"}]`, want: 16},
+		{name: "single block", params: `[{"fromBlock":"0x10","toBlock":"0x10"}]`, want: 1},
+		{name: "reversed range", params: `[{"fromBlock":"0x1f","toBlock":"0x10"}]`, want: 16},
+		{name: "earliest", params: `[{"fromBlock":"earliest","toBlock":"0x9"}]`, want: 10},
+		{name: "block hash", params: `[{"blockHash":"0x0000000000000000000000000000000000000000000000000000000000000001"}]`, want: 1},
+		{name: "tags only", params: `[{"fromBlock":"latest","toBlock":"latest"}]`, want: 1},
+		{name: "no range", params: `[{}]`, want: 1},
+		{name: "tag on the end", params: `[{"fromBlock":"0x10","toBlock":"latest"}]`, want: 5000},
+		{name: "tag on the start", params: `[{"fromBlock":"safe","toBlock":"0x10"}]`, want: 5000},
+		{name: "missing end", params: `[{"fromBlock":"0x10"}]`, want: 5000},
+		{name: "no filter", params: `[]`},
+		{name: "invalid", params: `{}`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.want, coster.logsSpan([]byte(c.params)))
+		})
+	}
+}
+
+func TestCoster_Cost(t *testing.T) {
+	coster := NewCoster(&config.MethodCosts{
+		Methods: map[string]int{
+			"eth_call":    2,
+			"eth_getLogs": 3,
+		},
+		LogsBlocks:  100,
+		LogsMaxSpan: 5000,
+		Batch:       1,
+	})
+	cases := []struct {
+		name   string
+		method string
+		params any
+		batch  int
+		want   int
+	}{
+		{name: "unlisted", method: "eth_chainId", want: 1},
+		{name: "listed", method: "eth_call", want: 2},
+		{name: "small range", method: "eth_getLogs", params: []any{map[string]any{"fromBlock": "0x0", "toBlock": "0x62"}}, want: 3},
+		{name: "large range", method: "eth_getLogs", params: []any{map[string]any{"fromBlock": "0x0", "toBlock": "0x3e7"}}, want: 13},
+		{name: "block hash", method: "eth_getLogs", params: []any{map[string]any{"blockHash": "0x0000000000000000000000000000000000000000000000000000000000000001"}}, want: 3},
+		{name: "tag on one end", method: "eth_getLogs", params: []any{map[string]any{"fromBlock": "0x0", "toBlock": "latest"}}, want: 53},
+		{name: "batch", method: "eth_call", batch: 10, want: 3},
+		{name: "batch of one", method: "eth_call", batch: 1, want: 2},
+		{name: "batched logs", method: "eth_getLogs", params: []any{map[string]any{"fromBlock": "0x0", "toBlock": "0x3e7"}}, batch: 2, want: 14},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := context.Background()
+			if c.batch > 0 {
+				ctx = context.WithValue(ctx, batchSizeKey{}, c.batch)
+			}
+			r, err := jsonrpc.NewRequest(ctx, jsonrpc.NewNullIDPtr(), c.method, c.params)
+			require.NoError(t, err)
+			require.Equal(t, c.want, coster.Cost(r))
+		})
+	}
+}
+
+func TestCoster_CostWithoutLogsBlocks(t *testing.T) {
+	coster := NewCoster(&config.MethodCosts{LogsMaxSpan: 5000})
+	r, err := jsonrpc.NewRequest(context.Background(), jsonrpc.NewNullIDPtr(), "eth_getLogs", []any{map[string]any{"fromBlock": "0x0", "toBlock": "latest"}})
+	require.NoError(t, err)
+	require.Equal(t, 1, coster.Cost(r))
+}
+
+func TestBatchSize(t *testing.T) {
+	cases := []struct {
+		name   string
+		method string
+		body   string
+		code   int
+		want   int
+	}{
+		{name: "single", method: http.MethodPost, body: `{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`, code: http.StatusOK},
+		{name: "batch", method: http.MethodPost, body: ` [{"id":1,"method":"eth_chainId"},{"id":2,"method":"eth_chainId"}]`, code: http.StatusOK, want: 2},
+		{name: "invalid batch", method: http.MethodPost, body: `[{"id":1`, code: http.StatusOK},
+		{name: "too large", method: http.MethodPost, body: `[` + strings.Repeat(" ", 200) + `]`, code: http.StatusRequestEntityTooLarge},
+		{name: "get", method: http.MethodGet, code: http.StatusOK},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var got int
+			var body string
+			h := BatchSize(128)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = batchSize(r.Context())
+				b, _ := io.ReadAll(r.Body)
+				body = string(b)
+			}))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(c.method, "/", strings.NewReader(c.body)))
+			require.Equal(t, c.code, w.Code)
+			require.Equal(t, c.want, got)
+			if c.code == http.StatusOK {
+				// the body is still there to be served
+				require.Equal(t, c.body, body)
+			}
+		})
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"gfx.cafe/open/jrpc"
 	"gfx.cafe/open/jrpc/pkg/jsonrpc"
 	"github.com/redis/rueidis/rueidislimiter"
+
+	"github.com/gfx-labs/venn/lib/config"
 )
 
 type Identifier struct {
@@ -16,6 +18,9 @@ type Identifier struct {
 	Slug     string
 
 	ExtraCost int
+
+	// Fields are the fields of the request which limits with a key template count it by
+	Fields config.KeyFields
 }
 
 func (i *Identifier) String() string {
@@ -26,6 +31,23 @@ func (i *Identifier) Key() string {
 	return i.Endpoint + ":" + i.Type + ":" + i.Slug
 }
 
+// KeyFor returns the key of the request for a limit with the key template. a nil template keys it by the identifier
+func (i *Identifier) KeyFor(t *config.KeyTemplate) string {
+	if t == nil {
+		return i.Key()
+	}
+	fields := i.Fields
+	fields.ID = i.Type + ":" + i.Slug
+	return i.Endpoint + ":" + t.Execute(fields)
+}
+
+// KeyedLimiter is a limiter, and the template of the keys it counts requests by. a nil template counts them by
+// identifier
+type KeyedLimiter struct {
+	Limiter  rueidislimiter.RateLimiterClient
+	Template *config.KeyTemplate
+}
+
 type identifierContextKeyType string
 
 var identifierContextKey identifierContextKeyType = "rl_identifier"
@@ -64,6 +86,15 @@ func WithIdentifier(idFunc func(r *jrpc.Request) (*Identifier, error)) func(jrpc
 }
 
 func RuedisRatelimiter(rl rueidislimiter.RateLimiterClient) func(jrpc.Handler) jrpc.Handler {
+	return RuedisRatelimiters(func(*jsonrpc.Request) ([]KeyedLimiter, error) {
+		return []KeyedLimiter{{Limiter: rl}}, nil
+	})
+}
+
+// RuedisRatelimiters is RuedisRatelimiter with the limiters picked for every request. the request must be allowed by
+// all of them. every limiter is checked before any is charged, so that a request rejected by one limiter costs nothing
+// against the others
+func RuedisRatelimiters(pick func(r *jsonrpc.Request) ([]KeyedLimiter, error)) func(jrpc.Handler) jrpc.Handler {
 	return func(next jrpc.Handler) jrpc.Handler {
 		return jsonrpc.HandlerFunc(func(w jsonrpc.ResponseWriter, r *jsonrpc.Request) {
 			id, err := IdentifierFromContext(r.Context())
@@ -71,31 +102,60 @@ func RuedisRatelimiter(rl rueidislimiter.RateLimiterClient) func(jrpc.Handler) j
 				w.Send(nil, err)
 				return
 			}
-			rateLimitKey := id.Key()
-			wait, err := rl.AllowN(r.Context(), rateLimitKey, int64(1+id.ExtraCost))
+			limiters, err := pick(r)
 			if err != nil {
-				w.Send(nil, &jsonrpc.JsonError{
-					Code:    500,
-					Message: "Internal Server Error",
-					Data: map[string]any{
-						"Error": err.Error(),
-					},
-				})
+				w.Send(nil, err)
 				return
 			}
-			if !wait.Allowed {
-				waitTime := time.UnixMilli(wait.ResetAtMs).Sub(time.Now())
-				w.Send(nil, &jsonrpc.JsonError{
-					Code:    429,
-					Message: "Rate Limit Hit",
-					Data: map[string]any{
-						"Wait": waitTime / time.Millisecond,
-						"Key":  rateLimitKey,
-					},
-				})
-				return
+			cost := int64(1 + id.ExtraCost)
+			keys := make([]string, len(limiters))
+			for i, rl := range limiters {
+				keys[i] = id.KeyFor(rl.Template)
+				res, err := rl.Limiter.Check(r.Context(), keys[i])
+				if err != nil {
+					w.Send(nil, limiterError(err))
+					return
+				}
+				if res.Remaining < cost {
+					w.Send(nil, rateLimitHit(keys[i], res))
+					return
+				}
+			}
+			for i, rl := range limiters {
+				res, err := rl.Limiter.AllowN(r.Context(), keys[i], cost)
+				if err != nil {
+					w.Send(nil, limiterError(err))
+					return
+				}
+				// another request took the tokens since the check
+				if !res.Allowed {
+					w.Send(nil, rateLimitHit(keys[i], res))
+					return
+				}
 			}
 			next.ServeRPC(w, r)
 		})
 	}
 }
+
+func limiterError(err error) *jsonrpc.JsonError {
+	return &jsonrpc.JsonError{
+		Code:    500,
+		Message: "Internal Server Error",
+		Data: map[string]any{
+			"Error": err.Error(),
+		},
+	}
+}
+
+func rateLimitHit(key string, res rueidislimiter.Result) *jsonrpc.JsonError {
+	waitTime := time.UnixMilli(res.ResetAtMs).Sub(time.Now())
+	return &jsonrpc.JsonError{
+		Code:    429,
+		Message: "Rate Limit Hit",
+		Data: map[string]any{
+			"Wait": waitTime / time.Millisecond,
+			"Key":  key,
+		},
+	}
+}
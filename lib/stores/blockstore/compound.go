@@ -1,12 +1,17 @@
 package blockstore
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
+	"slices"
 
 	"github.com/gfx-labs/venn/lib/config"
 
+	"github.com/ethereum/go-ethereum/common"
 	"go.uber.org/multierr"
 )
 
@@ -97,4 +102,143 @@ func (c *CompoundStore) Get(ctx context.Context, chain *config.Chain, typ EntryT
 	return entries, nil
 }
 
+// GetPartial returns the entries within the range which are held by any of the stores that support partial queries.
+// every store is only asked for the ranges which the stores before it are missing, and the entries found are put in
+// the stores before the one they were found in.
+func (c *CompoundStore) GetPartial(ctx context.Context, chain *config.Chain, typ EntryType, query QueryRange) ([]*Entry, error) {
+	if query.End < query.Start {
+		return nil, nil
+	}
+
+	var entries []*Entry
+	missing := []QueryRange{query}
+	for i, v := range c.stores {
+		partial, ok := v.store.(PartialStore)
+		if !ok {
+			continue
+		}
+
+		var found []*Entry
+		for _, q := range missing {
+			res, err := partial.GetPartial(ctx, chain, typ, q)
+			if err != nil {
+				if !(errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+					c.log.Warn("cache partial get fail", "chain", chain.Name, "cache_type", v.name, "query", q, "err", err)
+				}
+				continue
+			}
+			found = append(found, res...)
+		}
+		if len(found) == 0 {
+			continue
+		}
+
+		for j := 0; j < i; j++ {
+			if err := c.stores[j].store.Put(ctx, chain, typ, found...); err != nil {
+				if !(errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+					c.log.Warn("cache store fail", "chain", chain.Name, "cache_type", c.stores[j].name, "query", query, "err", err)
+				}
+			}
+		}
+
+		entries = append(entries, found...)
+		slices.SortFunc(entries, func(a, b *Entry) int {
+			return cmp.Compare(a.BlockNumber, b.BlockNumber)
+		})
+		missing = MissingRanges(query, entries)
+		if len(missing) == 0 {
+			break
+		}
+	}
+
+	return entries, nil
+}
+
+// Invalidate drops the range from every store which supports it
+func (c *CompoundStore) Invalidate(ctx context.Context, chain *config.Chain, query QueryRange) error {
+	var merr error
+	for _, v := range c.stores {
+		invalidator, ok := v.store.(Invalidator)
+		if !ok {
+			continue
+		}
+		if err := invalidator.Invalidate(ctx, chain, query); err != nil {
+			merr = multierr.Append(merr, fmt.Errorf("%s: %w", v.name, err))
+		}
+	}
+	return merr
+}
+
+// GetState returns the result from the first store which holds it, and puts it in the stores before that one
+func (c *CompoundStore) GetState(ctx context.Context, chain *config.Chain, block Query, key string) (json.RawMessage, error) {
+	var merr error
+	for i, v := range c.stores {
+		state, ok := v.store.(StateStore)
+		if !ok {
+			continue
+		}
+		value, err := state.GetState(ctx, chain, block, key)
+		if err != nil {
+			merr = multierr.Append(merr, err)
+			continue
+		}
+		for j := 0; j < i; j++ {
+			prev, ok := c.stores[j].store.(StateStore)
+			if !ok {
+				continue
+			}
+			if err := prev.PutState(ctx, chain, block, key, value); err != nil {
+				if !(errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+					c.log.Warn("cache state store fail", "chain", chain.Name, "cache_type", c.stores[j].name, "err", err)
+				}
+			}
+		}
+		return value, nil
+	}
+	if merr == nil {
+		return nil, errors.New("compound handler could not find state")
+	}
+	return nil, merr
+}
+
+// PutState puts the result in every store which supports it
+func (c *CompoundStore) PutState(ctx context.Context, chain *config.Chain, block Query, key string, value json.RawMessage) error {
+	var merr error
+	for _, v := range c.stores {
+		state, ok := v.store.(StateStore)
+		if !ok {
+			continue
+		}
+		if err := state.PutState(ctx, chain, block, key, value); err != nil {
+			merr = multierr.Append(merr, fmt.Errorf("%s: %w", v.name, err))
+		}
+	}
+	return merr
+}
+
+// GetTx returns the location from the first store which has the transaction indexed
+func (c *CompoundStore) GetTx(ctx context.Context, chain *config.Chain, hash common.Hash) (*TxLocation, error) {
+	var merr error
+	for _, v := range c.stores {
+		index, ok := v.store.(TxIndex)
+		if !ok {
+			continue
+		}
+		location, err := index.GetTx(ctx, chain, hash)
+		if err != nil {
+			merr = multierr.Append(merr, err)
+			continue
+		}
+		return location, nil
+	}
+	if merr == nil {
+		return nil, errors.New("compound handler could not find transaction")
+	}
+	return nil, merr
+}
+
 var _ Store = (*CompoundStore)(nil)
+var _ PartialStore = (*CompoundStore)(nil)
+var _ Invalidator = (*CompoundStore)(nil)
+var _ StateStore = (*CompoundStore)(nil)
+var _ TxIndex = (*CompoundStore)(nil)
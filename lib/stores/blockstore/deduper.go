@@ -2,6 +2,8 @@ package blockstore
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/gfx-labs/venn/lib/config"
@@ -43,8 +45,52 @@ func (T *SingleFlight) Get(ctx context.Context, chain *config.Chain, typ EntryTy
 	}
 }
 
+func (T *SingleFlight) GetPartial(ctx context.Context, chain *config.Chain, typ EntryType, query QueryRange) ([]*Entry, error) {
+	partial, ok := T.underlying.(PartialStore)
+	if !ok {
+		return nil, nil
+	}
+	return partial.GetPartial(ctx, chain, typ, query)
+}
+
 func (T *SingleFlight) Put(ctx context.Context, chain *config.Chain, typ EntryType, entries ...*Entry) error {
 	return T.underlying.Put(ctx, chain, typ, entries...)
 }
 
+func (T *SingleFlight) Invalidate(ctx context.Context, chain *config.Chain, query QueryRange) error {
+	invalidator, ok := T.underlying.(Invalidator)
+	if !ok {
+		return nil
+	}
+	return invalidator.Invalidate(ctx, chain, query)
+}
+
+func (T *SingleFlight) GetState(ctx context.Context, chain *config.Chain, block Query, key string) (json.RawMessage, error) {
+	state, ok := T.underlying.(StateStore)
+	if !ok {
+		return nil, errors.New("state not supported")
+	}
+	return state.GetState(ctx, chain, block, key)
+}
+
+func (T *SingleFlight) PutState(ctx context.Context, chain *config.Chain, block Query, key string, value json.RawMessage) error {
+	state, ok := T.underlying.(StateStore)
+	if !ok {
+		return nil
+	}
+	return state.PutState(ctx, chain, block, key, value)
+}
+
+func (T *SingleFlight) GetTx(ctx context.Context, chain *config.Chain, hash common.Hash) (*TxLocation, error) {
+	index, ok := T.underlying.(TxIndex)
+	if !ok {
+		return nil, errors.New("transaction index not supported")
+	}
+	return index.GetTx(ctx, chain, hash)
+}
+
 var _ Store = (*SingleFlight)(nil)
+var _ PartialStore = (*SingleFlight)(nil)
+var _ Invalidator = (*SingleFlight)(nil)
+var _ StateStore = (*SingleFlight)(nil)
+var _ TxIndex = (*SingleFlight)(nil)
@@ -19,6 +19,19 @@ const (
 	EntryTypeCount
 )
 
+func (t EntryType) String() string {
+	switch t {
+	case EntryBlockHeader:
+		return "block"
+	case EntryLogs:
+		return "logs"
+	case EntryReceipts:
+		return "receipts"
+	default:
+		return "unknown"
+	}
+}
+
 type Entry struct {
 	BlockHash   common.Hash    `json:"blockHash"`
 	BlockNumber hexutil.Uint64 `json:"blockNumber"`
@@ -58,3 +71,48 @@ type Store interface {
 	Get(ctx context.Context, chain *config.Chain, typ EntryType, query Query) ([]*Entry, error)
 	Put(ctx context.Context, chain *config.Chain, typ EntryType, entries ...*Entry) error
 }
+
+// PartialStore is implemented by stores which can return the entries they hold within a range, skipping the blocks
+// which they do not have instead of failing the whole query. entries are returned in order of block number.
+type PartialStore interface {
+	GetPartial(ctx context.Context, chain *config.Chain, typ EntryType, query QueryRange) ([]*Entry, error)
+}
+
+// Invalidator is implemented by stores which can drop the entries of every type they hold for a range of blocks, so
+// that orphaned blocks are not served after a reorg.
+type Invalidator interface {
+	Invalidate(ctx context.Context, chain *config.Chain, query QueryRange) error
+}
+
+// StateStore is implemented by stores which can hold the results of state queries, such as eth_call, made at a block.
+// block is either a QueryHash or a QueryNumber, and key identifies the query. results held for a block number are
+// dropped when the block is invalidated, while results held for a block hash never change.
+type StateStore interface {
+	GetState(ctx context.Context, chain *config.Chain, block Query, key string) (json.RawMessage, error)
+	PutState(ctx context.Context, chain *config.Chain, block Query, key string, value json.RawMessage) error
+}
+
+// MissingRanges returns the ranges within query which are not covered by entries. entries must be in order.
+func MissingRanges(query QueryRange, entries []*Entry) []QueryRange {
+	var missing []QueryRange
+	next := query.Start
+	for _, entry := range entries {
+		if entry.BlockNumber < next || entry.BlockNumber > query.End {
+			continue
+		}
+		if entry.BlockNumber > next {
+			missing = append(missing, QueryRange{
+				Start: next,
+				End:   entry.BlockNumber - 1,
+			})
+		}
+		next = entry.BlockNumber + 1
+	}
+	if next <= query.End {
+		missing = append(missing, QueryRange{
+			Start: next,
+			End:   query.End,
+		})
+	}
+	return missing
+}
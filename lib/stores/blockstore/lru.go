@@ -2,6 +2,7 @@ package blockstore
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"github.com/gfx-labs/venn/lib/config"
 	"sync"
@@ -24,20 +25,101 @@ type lruHashKey struct {
 	Chain     string
 }
 
+// lruStateKey is the key of a state query result. BlockHash is empty for results held by block number.
+type lruStateKey struct {
+	BlockNumber hexutil.Uint64
+	BlockHash   common.Hash
+	Chain       string
+	Key         string
+}
+
+// lruBlockKey is a block of a chain by number
+type lruBlockKey struct {
+	BlockNumber hexutil.Uint64
+	Chain       string
+}
+
+type lruTxKey struct {
+	Hash  common.Hash
+	Chain string
+}
+
 type LruStore struct {
 	size int
 
 	byHash   *simplelru.LRU[lruHashKey, *Entry]
 	byNumber *simplelru.LRU[lruNumberKey, *Entry]
+	state    *simplelru.LRU[lruStateKey, json.RawMessage]
+	// stateByNumber indexes the keys of the state held by block number, so that reorgs only touch the orphaned blocks
+	stateByNumber map[lruBlockKey]map[lruStateKey]struct{}
+	// txs indexes the transactions of the entries held by hash, and is pruned as they leave
+	txs map[lruTxKey]TxLocation
 
 	mu sync.Mutex
 }
 
 func NewLruStore(size int) *LruStore {
-	return &LruStore{
-		size:     size,
-		byNumber: generic.Must(simplelru.NewLRU[lruNumberKey, *Entry](size, nil)),
-		byHash:   generic.Must(simplelru.NewLRU[lruHashKey, *Entry](size, nil)),
+	o := &LruStore{
+		size:          size,
+		byNumber:      generic.Must(simplelru.NewLRU[lruNumberKey, *Entry](size, nil)),
+		txs:           make(map[lruTxKey]TxLocation),
+		stateByNumber: make(map[lruBlockKey]map[lruStateKey]struct{}),
+	}
+	o.byHash = generic.Must(simplelru.NewLRU[lruHashKey, *Entry](size, o.evictTxs))
+	o.state = generic.Must(simplelru.NewLRU[lruStateKey, json.RawMessage](size, o.evictState))
+	return o
+}
+
+func lruBlockKeyOf(key lruStateKey) (lruBlockKey, bool) {
+	return lruBlockKey{
+		BlockNumber: key.BlockNumber,
+		Chain:       key.Chain,
+	}, key.BlockHash == (common.Hash{})
+}
+
+// evictState drops state which left the store from the index by number. T.mu must be held
+func (T *LruStore) evictState(key lruStateKey, _ json.RawMessage) {
+	block, ok := lruBlockKeyOf(key)
+	if !ok {
+		return
+	}
+	keys := T.stateByNumber[block]
+	delete(keys, key)
+	if len(keys) == 0 {
+		delete(T.stateByNumber, block)
+	}
+}
+
+// removeState removes the state held by number for the block. T.mu must be held
+func (T *LruStore) removeState(block lruBlockKey) {
+	for key := range T.stateByNumber[block] {
+		T.state.Remove(key)
+	}
+	delete(T.stateByNumber, block)
+}
+
+// evictTxs drops the transactions of an entry which left the store from the index, unless another entry of the block
+// still holds them. T.mu must be held
+func (T *LruStore) evictTxs(key lruHashKey, entry *Entry) {
+	for _, typ := range []EntryType{EntryBlockHeader, EntryReceipts} {
+		if typ != key.Type && T.byHash.Contains(lruHashKey{
+			Type:      typ,
+			BlockHash: key.BlockHash,
+			Chain:     key.Chain,
+		}) {
+			return
+		}
+	}
+	hashes, _ := EntryTxHashes(key.Type, entry)
+	for _, hash := range hashes {
+		k := lruTxKey{
+			Hash:  hash,
+			Chain: key.Chain,
+		}
+		// the transaction may have been included again in a block of another fork since
+		if location, ok := T.txs[k]; ok && location.BlockHash == key.BlockHash {
+			delete(T.txs, k)
+		}
 	}
 }
 
@@ -77,20 +159,37 @@ func (T *LruStore) Get(_ context.Context, chain *config.Chain, typ EntryType, qu
 	}
 }
 
+func (T *LruStore) GetPartial(_ context.Context, chain *config.Chain, typ EntryType, query QueryRange) ([]*Entry, error) {
+	T.mu.Lock()
+	defer T.mu.Unlock()
+
+	var entries []*Entry
+	for i := query.Start; i <= query.End; i++ {
+		entry, ok := T.byNumber.Get(lruNumberKey{
+			Type:        typ,
+			BlockNumber: i,
+			Chain:       chain.Name,
+		})
+		if ok {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, nil
+}
+
 func (T *LruStore) Put(_ context.Context, chain *config.Chain, typ EntryType, entries ...*Entry) error {
 	T.mu.Lock()
 	defer T.mu.Unlock()
 	for _, entry := range entries {
-		if entry.ParentHash != nil {
-			// get prev
+		// the stalker invalidates orphaned blocks of stalked chains
+		if !chain.ParsedStalk && entry.ParentHash != nil {
 			if prev, ok := T.byNumber.Get(lruNumberKey{
 				Type:        typ,
 				BlockNumber: entry.BlockNumber - 1,
 				Chain:       chain.Name,
-			}); ok {
-				if prev.BlockHash != *entry.ParentHash {
-					T.byNumber.Purge()
-				}
+			}); ok && prev.BlockHash != *entry.ParentHash {
+				T.purgeNumbers(chain)
 			}
 		}
 
@@ -104,9 +203,146 @@ func (T *LruStore) Put(_ context.Context, chain *config.Chain, typ EntryType, en
 			BlockNumber: entry.BlockNumber,
 			Chain:       chain.Name,
 		}, entry)
+
+		// the index is best effort, entries which can not be decoded are still stored
+		hashes, _ := EntryTxHashes(typ, entry)
+		for i, hash := range hashes {
+			T.txs[lruTxKey{
+				Hash:  hash,
+				Chain: chain.Name,
+			}] = TxLocation{
+				BlockHash:   entry.BlockHash,
+				BlockNumber: entry.BlockNumber,
+				Index:       i,
+			}
+		}
+	}
+
+	return nil
+}
+
+// purgeNumbers removes every entry and state of the chain held by number. it is the fallback for chains which are not
+// stalked, where the depth of a reorg is not known. T.mu must be held
+func (T *LruStore) purgeNumbers(chain *config.Chain) {
+	for _, key := range T.byNumber.Keys() {
+		if key.Chain == chain.Name {
+			T.byNumber.Remove(key)
+		}
+	}
+	for block := range T.stateByNumber {
+		if block.Chain == chain.Name {
+			T.removeState(block)
+		}
+	}
+}
+
+func (T *LruStore) GetTx(_ context.Context, chain *config.Chain, hash common.Hash) (*TxLocation, error) {
+	T.mu.Lock()
+	defer T.mu.Unlock()
+
+	location, ok := T.txs[lruTxKey{
+		Hash:  hash,
+		Chain: chain.Name,
+	}]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return &location, nil
+}
+
+func (T *LruStore) Invalidate(_ context.Context, chain *config.Chain, query QueryRange) error {
+	T.mu.Lock()
+	defer T.mu.Unlock()
+
+	for typ := EntryType(0); typ < EntryTypeCount; typ++ {
+		for i := query.Start; i <= query.End; i++ {
+			key := lruNumberKey{
+				Type:        typ,
+				BlockNumber: i,
+				Chain:       chain.Name,
+			}
+			entry, ok := T.byNumber.Peek(key)
+			if !ok {
+				continue
+			}
+			T.byNumber.Remove(key)
+			T.byHash.Remove(lruHashKey{
+				Type:      typ,
+				BlockHash: entry.BlockHash,
+				Chain:     chain.Name,
+			})
+		}
 	}
 
+	for i := query.Start; i <= query.End; i++ {
+		T.removeState(lruBlockKey{
+			BlockNumber: i,
+			Chain:       chain.Name,
+		})
+	}
+
+	return nil
+}
+
+func lruStateKeyOf(chain *config.Chain, block Query, key string) (lruStateKey, error) {
+	switch q := block.(type) {
+	case QueryHash:
+		return lruStateKey{
+			BlockHash: common.Hash(q),
+			Chain:     chain.Name,
+			Key:       key,
+		}, nil
+	case QueryRange:
+		if q.Start != q.End {
+			return lruStateKey{}, errors.New("state is held for a single block")
+		}
+		return lruStateKey{
+			BlockNumber: q.Start,
+			Chain:       chain.Name,
+			Key:         key,
+		}, nil
+	default:
+		return lruStateKey{}, errors.New("unknown query")
+	}
+}
+
+func (T *LruStore) GetState(_ context.Context, chain *config.Chain, block Query, key string) (json.RawMessage, error) {
+	k, err := lruStateKeyOf(chain, block, key)
+	if err != nil {
+		return nil, err
+	}
+
+	T.mu.Lock()
+	defer T.mu.Unlock()
+
+	value, ok := T.state.Get(k)
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return value, nil
+}
+
+func (T *LruStore) PutState(_ context.Context, chain *config.Chain, block Query, key string, value json.RawMessage) error {
+	k, err := lruStateKeyOf(chain, block, key)
+	if err != nil {
+		return err
+	}
+
+	T.mu.Lock()
+	defer T.mu.Unlock()
+
+	T.state.Add(k, value)
+	if block, ok := lruBlockKeyOf(k); ok {
+		if T.stateByNumber[block] == nil {
+			T.stateByNumber[block] = make(map[lruStateKey]struct{})
+		}
+		T.stateByNumber[block][k] = struct{}{}
+	}
 	return nil
 }
 
 var _ Store = (*LruStore)(nil)
+var _ PartialStore = (*LruStore)(nil)
+var _ Invalidator = (*LruStore)(nil)
+var _ StateStore = (*LruStore)(nil)
+var _ TxIndex = (*LruStore)(nil)
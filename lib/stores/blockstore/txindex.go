@@ -0,0 +1,135 @@
+package blockstore
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/go-faster/jx"
+
+	"github.com/gfx-labs/venn/lib/config"
+)
+
+// TxLocation is the block and index a transaction was included at
+type TxLocation struct {
+	BlockHash   common.Hash    `json:"blockHash"`
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	Index       int            `json:"index"`
+}
+
+// TxIndex is implemented by stores which index the transactions of the block headers and receipts put into them by
+// transaction hash. the index is not invalidated along with the entries, so the entry a location points to must be
+// checked to still be held for the block hash.
+type TxIndex interface {
+	GetTx(ctx context.Context, chain *config.Chain, hash common.Hash) (*TxLocation, error)
+}
+
+// EntryTxHashes returns the hashes of the transactions of a block header or receipts entry, in order of index. other
+// entry types have no transactions.
+func EntryTxHashes(typ EntryType, entry *Entry) ([]common.Hash, error) {
+	switch typ {
+	case EntryBlockHeader:
+		return blockTxHashes(entry.Value)
+	case EntryReceipts:
+		return receiptTxHashes(entry.Value)
+	default:
+		return nil, nil
+	}
+}
+
+// blockTxHashes returns the transaction hashes of a block, which may hold either full transactions or only hashes
+func blockTxHashes(block []byte) ([]common.Hash, error) {
+	var hashes []common.Hash
+	d := jx.DecodeBytes(block)
+	if d.Next() == jx.Null {
+		return nil, nil
+	}
+	fields, err := d.ObjIter()
+	if err != nil {
+		return nil, err
+	}
+	for fields.Next() {
+		if !bytes.Equal(fields.Key(), []byte("transactions")) {
+			if err := d.Skip(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		txs, err := d.ArrIter()
+		if err != nil {
+			return nil, err
+		}
+		for txs.Next() {
+			if d.Next() == jx.String {
+				hash, err := decodeHash(d)
+				if err != nil {
+					return nil, err
+				}
+				hashes = append(hashes, hash)
+				continue
+			}
+			hash, err := objectHash(d, "hash")
+			if err != nil {
+				return nil, err
+			}
+			hashes = append(hashes, hash)
+		}
+		if err := txs.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return hashes, fields.Err()
+}
+
+// receiptTxHashes returns the transaction hashes of the receipts of a block
+func receiptTxHashes(receipts []byte) ([]common.Hash, error) {
+	var hashes []common.Hash
+	d := jx.DecodeBytes(receipts)
+	if d.Next() == jx.Null {
+		return nil, nil
+	}
+	arr, err := d.ArrIter()
+	if err != nil {
+		return nil, err
+	}
+	for arr.Next() {
+		hash, err := objectHash(d, "transactionHash")
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, arr.Err()
+}
+
+// objectHash decodes the object and returns the hash held by the field
+func objectHash(d *jx.Decoder, field string) (common.Hash, error) {
+	var hash common.Hash
+	fields, err := d.ObjIter()
+	if err != nil {
+		return hash, err
+	}
+	for fields.Next() {
+		if !bytes.Equal(fields.Key(), []byte(field)) {
+			if err := d.Skip(); err != nil {
+				return hash, err
+			}
+			continue
+		}
+		if hash, err = decodeHash(d); err != nil {
+			return hash, err
+		}
+	}
+	return hash, fields.Err()
+}
+
+func decodeHash(d *jx.Decoder) (common.Hash, error) {
+	var hash common.Hash
+	raw, err := d.StrBytes()
+	if err != nil {
+		return hash, err
+	}
+	err = hash.UnmarshalText(raw)
+	return hash, err
+}
@@ -0,0 +1,89 @@
+package blockstore
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testTx0 = common.HexToHash("0x01")
+	testTx1 = common.HexToHash("0x02")
+)
+
+func TestBlockTxHashes(t *testing.T) {
+	cases := []struct {
+		name  string
+		block string
+		want  []common.Hash
+		err   bool
+	}{
+		{
+			name:  "full transactions",
+			block: `{"number":"0x1","transactions":[{"hash":"` + testTx0.Hex() + `","input":"0x"},{"from":"0x00","hash":"` + testTx1.Hex() + `"}]}`,
+			want:  []common.Hash{testTx0, testTx1},
+		},
+		{
+			name:  "hashes only",
+			block: `{"transactions":["` + testTx0.Hex() + `","` + testTx1.Hex() + `"],"number":"0x1"}`,
+			want:  []common.Hash{testTx0, testTx1},
+		},
+		{name: "no transactions", block: `{"number":"0x1","transactions":[]}`},
+		{name: "null", block: `null`},
+		{name: "invalid hash", block: `{"transactions":["0xzz"]}`, err: true},
+		{name: "not an object", block: `[]`, err: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := blockTxHashes([]byte(c.block))
+			if c.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.want, got)
+		})
+	}
+}
+
+func TestReceiptTxHashes(t *testing.T) {
+	cases := []struct {
+		name     string
+		receipts string
+		want     []common.Hash
+		err      bool
+	}{
+		{
+			name:     "receipts",
+			receipts: `[{"status":"0x1","transactionHash":"` + testTx0.Hex() + `"},{"transactionHash":"` + testTx1.Hex() + `","logs":[]}]`,
+			want:     []common.Hash{testTx0, testTx1},
+		},
+		{name: "empty", receipts: `[]`},
+		{name: "null", receipts: `null`},
+		{name: "not an array", receipts: `{}`, err: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := receiptTxHashes([]byte(c.receipts))
+			if c.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.want, got)
+		})
+	}
+}
+
+func TestEntryTxHashes(t *testing.T) {
+	entry := &Entry{Value: []byte(`[{"transactionHash":"` + testTx0.Hex() + `"}]`)}
+	got, err := EntryTxHashes(EntryReceipts, entry)
+	require.NoError(t, err)
+	require.Equal(t, []common.Hash{testTx0}, got)
+
+	// logs have no transactions of their own
+	got, err = EntryTxHashes(EntryLogs, entry)
+	require.NoError(t, err)
+	require.Empty(t, got)
+}
@@ -9,31 +9,43 @@ import (
 )
 
 type Atomic struct {
-	heads map[string]hexutil.Uint64
-	subs  map[string]map[int]chan<- hexutil.Uint64
-	next  int
-	mu    sync.RWMutex
+	heads  map[string]Heads
+	fences map[string]uint64
+	subs   map[string]map[int]chan<- hexutil.Uint64
+	next   int
+	mu     sync.RWMutex
+
+	reorgs ReorgFeed
 }
 
 func NewAtomic() *Atomic {
-	return new(Atomic)
+	return &Atomic{
+		heads:  make(map[string]Heads),
+		fences: make(map[string]uint64),
+	}
 }
 
 func (T *Atomic) Get(_ context.Context, chain *config.Chain) (hexutil.Uint64, error) {
 	T.mu.RLock()
 	defer T.mu.RUnlock()
-	val, ok := T.heads[chain.Name]
-	if !ok {
-		return 0, nil
-	}
-	return val, nil
+	return T.heads[chain.Name].Latest, nil
 }
 
-func (T *Atomic) Put(_ context.Context, chain *config.Chain, head hexutil.Uint64) (prev hexutil.Uint64, err error) {
+func (T *Atomic) GetHeads(_ context.Context, chain *config.Chain) (Heads, error) {
+	T.mu.RLock()
+	defer T.mu.RUnlock()
+	return T.heads[chain.Name], nil
+}
+
+func (T *Atomic) Put(ctx context.Context, chain *config.Chain, head hexutil.Uint64) (prev hexutil.Uint64, err error) {
 	T.mu.Lock()
 	defer T.mu.Unlock()
 
-	cur := T.heads[chain.Name]
+	heads := T.heads[chain.Name]
+	cur := heads.Latest
+	if !T.fence(ctx, chain) {
+		return cur, ErrFenced
+	}
 
 	if cur >= head {
 		return cur, nil
@@ -47,10 +59,36 @@ func (T *Atomic) Put(_ context.Context, chain *config.Chain, head hexutil.Uint64
 			}
 		}
 	}
-	T.heads[chain.Name] = head
+	heads.Latest = head
+	T.heads[chain.Name] = heads
 	return cur, nil
 }
 
+func (T *Atomic) PutFinality(ctx context.Context, chain *config.Chain, safe, finalized hexutil.Uint64) error {
+	T.mu.Lock()
+	defer T.mu.Unlock()
+
+	if !T.fence(ctx, chain) {
+		return ErrFenced
+	}
+
+	T.heads[chain.Name] = T.heads[chain.Name].Merge(Heads{
+		Safe:      safe,
+		Finalized: finalized,
+	})
+	return nil
+}
+
+// fence returns false if the fencing token of ctx was taken over, and otherwise remembers it. T.mu must be held
+func (T *Atomic) fence(ctx context.Context, chain *config.Chain) bool {
+	token := FenceFrom(ctx)
+	if Fenced(token, T.fences[chain.Name]) {
+		return false
+	}
+	T.fences[chain.Name] = max(token, T.fences[chain.Name])
+	return true
+}
+
 func (T *Atomic) On(chain *config.Chain) (<-chan hexutil.Uint64, func()) {
 	T.mu.Lock()
 	defer T.mu.Unlock()
@@ -78,4 +116,12 @@ func (T *Atomic) On(chain *config.Chain) (<-chan hexutil.Uint64, func()) {
 	}
 }
 
+func (T *Atomic) PutReorg(ctx context.Context, chain *config.Chain, reorg Reorg) error {
+	return T.reorgs.Publish(ctx, chain.Name, reorg)
+}
+
+func (T *Atomic) OnReorg(chain *config.Chain) (<-chan Reorg, func()) {
+	return T.reorgs.Subscribe(chain.Name)
+}
+
 var _ Store = (*Atomic)(nil)
@@ -0,0 +1,73 @@
+package headstore
+
+import (
+	"context"
+	"sync"
+)
+
+// reorgBuffer is the number of reorgs which may be queued for a subscriber before publishing waits for it
+const reorgBuffer = 8
+
+// ReorgFeed hands out the reorgs of every chain to its subscribers. reorgs are never dropped: Publish waits for every
+// subscriber to take the reorg or unsubscribe. the zero value is ready to use.
+type ReorgFeed struct {
+	subs map[string]map[int]*reorgSub
+	next int
+	mu   sync.Mutex
+}
+
+type reorgSub struct {
+	ch   chan Reorg
+	done chan struct{}
+}
+
+// Publish sends the reorg to every subscriber of the chain. it only fails if ctx is done before they all took it
+func (T *ReorgFeed) Publish(ctx context.Context, chain string, reorg Reorg) error {
+	T.mu.Lock()
+	defer T.mu.Unlock()
+
+	for _, sub := range T.subs[chain] {
+		select {
+		case sub.ch <- reorg:
+		case <-sub.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Subscribe returns the reorgs of the chain, and a function which unsubscribes and closes the channel
+func (T *ReorgFeed) Subscribe(chain string) (<-chan Reorg, func()) {
+	T.mu.Lock()
+	defer T.mu.Unlock()
+
+	id := T.next
+	T.next++
+
+	if T.subs == nil {
+		T.subs = make(map[string]map[int]*reorgSub)
+	}
+	if T.subs[chain] == nil {
+		T.subs[chain] = make(map[int]*reorgSub)
+	}
+	sub := &reorgSub{
+		ch:   make(chan Reorg, reorgBuffer),
+		done: make(chan struct{}),
+	}
+	T.subs[chain][id] = sub
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			// stops a Publish waiting for the subscriber, which holds the lock
+			close(sub.done)
+
+			T.mu.Lock()
+			defer T.mu.Unlock()
+
+			delete(T.subs[chain], id)
+			close(sub.ch)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package headstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReorgFeed(t *testing.T) {
+	var feed ReorgFeed
+	a, doneA := feed.Subscribe("a")
+	defer doneA()
+	b, doneB := feed.Subscribe("b")
+	defer doneB()
+
+	require.NoError(t, feed.Publish(context.Background(), "a", Reorg{Start: 1, End: 2, Head: 3}))
+	require.Equal(t, Reorg{Start: 1, End: 2, Head: 3}, <-a)
+	select {
+	case reorg := <-b:
+		t.Fatalf("reorg of another chain %v", reorg)
+	default:
+	}
+}
+
+func TestReorgFeed_WaitsForSubscriber(t *testing.T) {
+	var feed ReorgFeed
+	sub, done := feed.Subscribe("a")
+	defer done()
+	for i := range reorgBuffer {
+		require.NoError(t, feed.Publish(context.Background(), "a", Reorg{Head: 1}))
+		require.Len(t, sub, i+1)
+	}
+
+	// a full subscriber is waited for instead of missing the reorg
+	published := make(chan error, 1)
+	go func() {
+		published <- feed.Publish(context.Background(), "a", Reorg{Head: 2})
+	}()
+	select {
+	case err := <-published:
+		t.Fatalf("published to a full subscriber: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	<-sub
+	require.NoError(t, <-published)
+	for range reorgBuffer - 1 {
+		<-sub
+	}
+	require.Equal(t, Reorg{Head: 2}, <-sub)
+
+	// or until ctx is done
+	for range reorgBuffer {
+		require.NoError(t, feed.Publish(context.Background(), "a", Reorg{Head: 1}))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, feed.Publish(ctx, "a", Reorg{Head: 3}), context.DeadlineExceeded)
+}
+
+func TestReorgFeed_Unsubscribe(t *testing.T) {
+	var feed ReorgFeed
+	sub, done := feed.Subscribe("a")
+	for range reorgBuffer {
+		require.NoError(t, feed.Publish(context.Background(), "a", Reorg{Head: 1}))
+	}
+
+	// unsubscribing releases a publish waiting for the subscriber
+	published := make(chan error, 1)
+	go func() {
+		published <- feed.Publish(context.Background(), "a", Reorg{Head: 2})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	done()
+	require.NoError(t, <-published)
+	done()
+
+	for range sub {
+	}
+	require.NoError(t, feed.Publish(context.Background(), "a", Reorg{Head: 3}))
+}
@@ -0,0 +1,30 @@
+package headstore
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrFenced is returned when heads are put under a fencing token lower than one the store has already seen for the chain
+var ErrFenced = errors.New("heads put under a lease which was taken over")
+
+type fenceKey struct{}
+
+// WithFence attaches the fencing token of the lease the heads are put under. stores drop heads put under a lower token
+// than the highest they have seen for the chain, so a stalker which lost its lease without noticing can not overwrite
+// the heads of the one which took over.
+func WithFence(ctx context.Context, token uint64) context.Context {
+	return context.WithValue(ctx, fenceKey{}, token)
+}
+
+// FenceFrom returns the fencing token attached to the context, or zero if there is none
+func FenceFrom(ctx context.Context) uint64 {
+	token, _ := ctx.Value(fenceKey{}).(uint64)
+	return token
+}
+
+// Fenced returns whether heads put under token must be dropped, given the highest token seen for the chain. heads put
+// without a token are never dropped.
+func Fenced(token, highest uint64) bool {
+	return token != 0 && token < highest
+}
@@ -4,11 +4,55 @@ import (
 	"context"
 	"github.com/gfx-labs/venn/lib/config"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 )
 
+// Reorg describes blocks which are no longer part of the canonical chain
+type Reorg struct {
+	// Start is the number of the first orphaned block, End the number of the last
+	Start hexutil.Uint64 `json:"start"`
+	End   hexutil.Uint64 `json:"end"`
+	// Orphaned holds the hashes of the orphaned blocks, in order starting at Start
+	Orphaned []common.Hash `json:"orphaned"`
+	// Head is the new head of the canonical chain
+	Head hexutil.Uint64 `json:"head"`
+}
+
+// Depth returns the number of orphaned blocks
+func (r Reorg) Depth() int {
+	return int(r.End-r.Start) + 1
+}
+
+// Heads are the heads of a chain. Safe and Finalized are zero until they are known, or if the chain does not have them
+type Heads struct {
+	Latest    hexutil.Uint64 `json:"latest"`
+	Safe      hexutil.Uint64 `json:"safe"`
+	Finalized hexutil.Uint64 `json:"finalized"`
+}
+
+// Merge returns the heads with every head of o which is ahead of its own. heads never move backwards.
+func (h Heads) Merge(o Heads) Heads {
+	return Heads{
+		Latest:    max(h.Latest, o.Latest),
+		Safe:      max(h.Safe, o.Safe),
+		Finalized: max(h.Finalized, o.Finalized),
+	}
+}
+
 type Store interface {
+	// Get returns the latest head of the chain
 	Get(ctx context.Context, chain *config.Chain) (hexutil.Uint64, error)
+	// Put sets the latest head of the chain, and notifies the subscribers if it moved forward
 	Put(ctx context.Context, chain *config.Chain, head hexutil.Uint64) (prev hexutil.Uint64, err error)
 	On(chain *config.Chain) (<-chan hexutil.Uint64, func())
+
+	// GetHeads returns the latest, safe and finalized heads of the chain
+	GetHeads(ctx context.Context, chain *config.Chain) (Heads, error)
+	// PutFinality sets the safe and finalized heads of the chain. zero leaves a head unchanged.
+	PutFinality(ctx context.Context, chain *config.Chain, safe, finalized hexutil.Uint64) error
+
+	// PutReorg publishes a reorg to every subscriber of the chain
+	PutReorg(ctx context.Context, chain *config.Chain, reorg Reorg) error
+	OnReorg(chain *config.Chain) (<-chan Reorg, func())
 }
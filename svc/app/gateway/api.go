@@ -7,14 +7,13 @@ import (
 	"net"
 	"net/http"
 	"net/netip"
+	"slices"
 	"strings"
 	"time"
 
 	"go4.org/netipx"
 
 	"gfx.cafe/util/go/gotel"
-	"github.com/redis/rueidis"
-	"github.com/redis/rueidis/rueidislimiter"
 	"github.com/riandyrn/otelchi"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -37,6 +36,7 @@ import (
 	"github.com/gfx-labs/venn/lib/subctx"
 	"github.com/gfx-labs/venn/lib/util"
 	"github.com/gfx-labs/venn/lib/util/origin"
+	"github.com/gfx-labs/venn/svc/gateway/quarks/apikeys"
 	"github.com/gfx-labs/venn/svc/gateway/quarks/telemetry"
 	"github.com/gfx-labs/venn/svc/shared/services/prom"
 	"github.com/gfx-labs/venn/svc/shared/services/redi"
@@ -47,12 +47,12 @@ type Params struct {
 
 	Lc           fx.Lifecycle
 	Subscription *subscription.Engine `optional:"true"`
-	Endpoint     *config.EndpointSpec
-	Security     *config.Security
+	Endpoints    []*config.EndpointSpec
 	Logger       *slog.Logger
 	Redi         *redi.Redis
 
 	Telemetry *telemetry.Telemetry
+	Keys      *apikeys.Keyring
 
 	// head following for even faster access to the latest block.
 
@@ -65,10 +65,10 @@ type Result struct {
 	Route func(r chi.Router) `group:"route"`
 }
 
-func createBaseHandler(p Params) (jrpc.Handler, error) {
+func createBaseHandler(logger *slog.Logger, endpoint *config.EndpointSpec) (jrpc.Handler, error) {
 	endpointProxies := make(map[string]jrpc.Handler)
-	hybridProxy := callcenter.NewHybridProxy(p.Logger, string(p.Endpoint.VennUrl))
-	for _, to := range p.Endpoint.Paths {
+	hybridProxy := callcenter.NewHybridProxy(logger, string(endpoint.VennUrl))
+	for _, to := range endpoint.Paths {
 		_, ok := endpointProxies[to]
 		if ok {
 			continue
@@ -98,6 +98,92 @@ func createBaseHandler(p Params) (jrpc.Handler, error) {
 }
 
 func New(p Params) (r Result, err error) {
+	routes := make([]*endpointRoute, 0, len(p.Endpoints))
+	for _, endpoint := range p.Endpoints {
+		handler, err := newEndpoint(p, endpoint)
+		if err != nil {
+			return r, fmt.Errorf("endpoint %s: %w", endpoint.Name, err)
+		}
+		routes = append(routes, &endpointRoute{
+			host:    endpoint.Host,
+			prefix:  endpoint.Prefix,
+			handler: handler,
+		})
+	}
+	handler := routeEndpoints(routes)
+
+	// mount the http server
+	r.Route = func(r chi.Router) {
+		// health check
+		r.Mount("/health", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("OK"))
+		}))
+		r.Handle("/*", handler)
+		// TODO: eventually stats/dashboard will be here.
+	}
+	return
+}
+
+// routeEndpoints serves each request with the most specific route which matches it. routes with a host come first,
+// then longer prefixes
+func routeEndpoints(routes []*endpointRoute) http.Handler {
+	slices.SortStableFunc(routes, func(a, b *endpointRoute) int {
+		if (a.host == "") != (b.host == "") {
+			if a.host != "" {
+				return -1
+			}
+			return 1
+		}
+		return len(b.prefix) - len(a.prefix)
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, route := range routes {
+			if route.match(r) {
+				route.ServeHTTP(w, r)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+}
+
+// endpointRoute serves an endpoint on its host and below its prefix
+type endpointRoute struct {
+	host    string
+	prefix  string
+	handler http.Handler
+}
+
+func (T *endpointRoute) match(r *http.Request) bool {
+	if T.host != "" {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if !strings.EqualFold(host, T.host) {
+			return false
+		}
+	}
+	if T.prefix == "" {
+		return true
+	}
+	rest, ok := strings.CutPrefix(r.URL.Path, T.prefix)
+	return ok && (rest == "" || rest[0] == '/')
+}
+
+func (T *endpointRoute) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// the router of the endpoint routes the request from scratch, below the prefix
+	r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, nil))
+	if T.prefix == "" {
+		T.handler.ServeHTTP(w, r)
+		return
+	}
+	http.StripPrefix(T.prefix, T.handler).ServeHTTP(w, r)
+}
+
+// newEndpoint builds the handler of an endpoint, which serves its paths from the root
+func newEndpoint(p Params, endpoint *config.EndpointSpec) (http.Handler, error) {
+	keys := p.Keys.Keys(endpoint.Name)
 	maxRequestBodySize := 5 * 1024 * 1024
 
 	mux := jmux.NewMux()
@@ -119,7 +205,7 @@ func New(p Params) (r Result, err error) {
 
 	// whitelist methods
 	whitelist := map[string]struct{}{}
-	for _, v := range p.Endpoint.Methods {
+	for _, v := range endpoint.Methods {
 		whitelist[v] = struct{}{}
 	}
 	// Method validation middleware
@@ -140,6 +226,11 @@ func New(p Params) (r Result, err error) {
 		})
 	})
 
+	// api keys, and the paths and methods they allow
+	if keys != nil {
+		mux.Use(keys.RPCMiddleware())
+	}
+
 	// tracing
 	mux.Use(func(next jrpc.Handler) jrpc.Handler {
 		tracer := otel.Tracer("jrpc")
@@ -176,28 +267,82 @@ func New(p Params) (r Result, err error) {
 		if err != nil {
 			slug = r.Peer.RemoteAddr
 		}
-		return &ratelimit.Identifier{
+		target, _ := subctx.GetEndpointPath(r.Context())
+		hf, _ := r.Context().Value(httpFieldsKey{}).(httpFields)
+		id := &ratelimit.Identifier{
 			Endpoint: endpoint.Name,
 			Type:     "ip",
 			Slug:     slug,
-		}, nil
+			Fields: config.KeyFields{
+				IP:     slug,
+				Origin: hf.origin,
+				Path:   hf.path,
+				Target: target,
+				Method: r.Method,
+			},
+		}
+		if key := apikeys.FromContext(r.Context()); key != nil {
+			id.Type = "key"
+			id.Slug = key.Name
+			id.Fields.Key = key.Name
+		}
+		return id, nil
 	}))
 
-	for _, v := range p.Endpoint.Limits.Abuse {
-		rc, err := rueidislimiter.NewRateLimiter(rueidislimiter.RateLimiterOption{
-			ClientBuilder: func(option rueidis.ClientOption) (rueidis.Client, error) {
-				return p.Redi.R(), nil
-			},
-			KeyPrefix: fmt.Sprintf("%s:gateway:abuse:%s:%s", p.Redi.Namespace(), p.Endpoint.Name, v.Id),
-			Limit:     v.Total,
-			Window:    v.Window.Duration,
-		})
-		if err != nil {
-			return r, err
+	if endpoint.Costs != nil {
+		mux.Use(ratelimit.NewCoster(endpoint.Costs).Middleware)
+	}
+
+	// api keys with limits of their own are limited by them instead of the limits of the endpoint
+	limiters := newAbuseLimiters(p.Redi, endpoint.Name)
+	if _, err := limiters.get(endpoint.Limits.Abuse); err != nil {
+		return nil, err
+	}
+	mux.Use(ratelimit.RuedisRatelimiters(func(r *jsonrpc.Request) ([]ratelimit.KeyedLimiter, error) {
+		if key := apikeys.FromContext(r.Context()); key != nil && key.Limits != nil {
+			return limiters.get(key.Limits.Abuse)
 		}
+		return limiters.get(endpoint.Limits.Abuse)
+	}))
 
-		mux.Use(ratelimit.RuedisRatelimiter(rc))
+	// usage quotas. they are counted after the abuse limits, so that requests rejected by those are not billed
+	usage := &usageLimiter{
+		log:      p.Logger,
+		redi:     p.Redi,
+		endpoint: endpoint.Name,
 	}
+	mux.Use(usage.Middleware(func(r *jsonrpc.Request) []config.UsageLimit {
+		if key := apikeys.FromContext(r.Context()); key != nil && key.Limits != nil {
+			return key.Limits.Usage
+		}
+		return endpoint.Limits.Usage
+	}))
+	// what every api key spent, for the requests which passed the limits
+	mux.Use(func(next jrpc.Handler) jrpc.Handler {
+		return jsonrpc.HandlerFunc(func(w jsonrpc.ResponseWriter, r *jsonrpc.Request) {
+			if id, err := ratelimit.IdentifierFromContext(r.Context()); err == nil && id.Type == "key" {
+				prom.Gateway.KeyCost(prom.GatewayKeyLabel{
+					Endpoint: id.Endpoint,
+					Key:      id.Slug,
+				}).Add(float64(1 + id.ExtraCost))
+			}
+			next.ServeRPC(w, r)
+		})
+	})
+	// the usage is served next to the metrics, away from the callers
+	p.Lc.Append(fx.Hook{
+		OnStart: func(_ context.Context) error {
+			http.Handle("/usage/"+endpoint.Name, usage.Handler(func(idType, slug string) []config.UsageLimit {
+				if idType == "key" && keys != nil {
+					if key, ok := keys.Named(slug); ok && key.Limits != nil {
+						return key.Limits.Usage
+					}
+				}
+				return endpoint.Limits.Usage
+			}))
+			return nil
+		},
+	})
 
 	mux.Use(func(fn jrpc.Handler) jrpc.Handler {
 		return jrpc.HandlerFunc(func(w jsonrpc.ResponseWriter, r *jsonrpc.Request) {
@@ -284,9 +429,9 @@ func New(p Params) (r Result, err error) {
 		})
 	})
 
-	baseHandler, err := createBaseHandler(p)
+	baseHandler, err := createBaseHandler(p.Logger, endpoint)
 	if err != nil {
-		return r, err
+		return nil, err
 	}
 
 	mux.Handle("*", baseHandler)
@@ -295,28 +440,29 @@ func New(p Params) (r Result, err error) {
 	serverHandler := codecs.HttpWebsocketHandler(mux, []string{"*"})
 
 	b := &netipx.IPSetBuilder{}
-	if p.Security != nil {
-		for _, v := range p.Security.TrustedOrigins {
+	if endpoint.Security != nil {
+		for _, v := range endpoint.Security.TrustedOrigins {
 			parsedPrefix, err := netip.ParsePrefix(v)
 			if err != nil {
-				return r, fmt.Errorf("invalid trusted origin %s: %w", v, err)
+				return nil, fmt.Errorf("invalid trusted origin %s: %w", v, err)
 			}
 			b.AddPrefix(parsedPrefix)
 		}
 	}
 	ipset, err := b.IPSet()
 	if err != nil {
-		return r, err
+		return nil, err
 	}
 	// mount the http server
-	r.Route = func(r chi.Router) {
-		if p.Security != nil {
+	router := chi.NewRouter()
+	router.Group(func(r chi.Router) {
+		if endpoint.Security != nil {
 			r.Use(func(next http.Handler) http.Handler {
 				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 					parsedRemote, err := netip.ParseAddr(util.HostFromRemoteAddr(r.RemoteAddr))
 					// if remote is in the trusted ipset, trust the headers that come from it
 					if err == nil && ipset.Contains(parsedRemote) {
-						for _, h := range p.Security.TrustedIpHeaders {
+						for _, h := range endpoint.Security.TrustedIpHeaders {
 							val := r.Header.Get(h)
 							p.Logger.Debug("checking ip header", "header", h, "value", val)
 							if val != "" && net.ParseIP(val) != nil {
@@ -329,12 +475,12 @@ func New(p Params) (r Result, err error) {
 					}
 
 					// Origin validation and CORS handling
-					if len(p.Security.AllowedOrigins) > 0 {
+					if len(endpoint.Security.AllowedOrigins) > 0 {
 						o := r.Header.Get("Origin")
 						matched := false
 						matchedOrigin := ""
 
-						for _, v := range p.Security.AllowedOrigins {
+						for _, v := range endpoint.Security.AllowedOrigins {
 							match, err := origin.Match(o, v)
 							if err != nil {
 								http.Error(w, "invalid origin", http.StatusForbidden)
@@ -353,24 +499,24 @@ func New(p Params) (r Result, err error) {
 						}
 
 						// If CORS is enabled and origin matched, set CORS headers
-						if p.Security.CorsEnabled && matchedOrigin != "" {
+						if endpoint.Security.CorsEnabled && matchedOrigin != "" {
 							// Set Access-Control-Allow-Origin
 							w.Header().Set("Access-Control-Allow-Origin", matchedOrigin)
 
 							// Set Access-Control-Allow-Credentials if configured
-							if p.Security.CorsAllowCredentials {
+							if endpoint.Security.CorsAllowCredentials {
 								w.Header().Set("Access-Control-Allow-Credentials", "true")
 							}
 
 							// Set Access-Control-Expose-Headers if configured
-							if len(p.Security.CorsExposeHeaders) > 0 {
-								w.Header().Set("Access-Control-Expose-Headers", strings.Join(p.Security.CorsExposeHeaders, ", "))
+							if len(endpoint.Security.CorsExposeHeaders) > 0 {
+								w.Header().Set("Access-Control-Expose-Headers", strings.Join(endpoint.Security.CorsExposeHeaders, ", "))
 							}
 
 							// Handle preflight OPTIONS request
 							if r.Method == "OPTIONS" {
 								// Set Access-Control-Allow-Methods
-								allowedMethods := p.Security.CorsAllowedMethods
+								allowedMethods := endpoint.Security.CorsAllowedMethods
 								if len(allowedMethods) == 0 {
 									// Default to common methods for JSON-RPC
 									allowedMethods = []string{"POST", "GET", "OPTIONS"}
@@ -378,7 +524,7 @@ func New(p Params) (r Result, err error) {
 								w.Header().Set("Access-Control-Allow-Methods", strings.Join(allowedMethods, ", "))
 
 								// Set Access-Control-Allow-Headers
-								allowedHeaders := p.Security.CorsAllowedHeaders
+								allowedHeaders := endpoint.Security.CorsAllowedHeaders
 								if len(allowedHeaders) == 0 {
 									// Default to common headers
 									allowedHeaders = []string{"Content-Type", "Accept", "Authorization"}
@@ -405,7 +551,7 @@ func New(p Params) (r Result, err error) {
 								w.Header().Set("Access-Control-Allow-Headers", strings.Join(allowedHeaders, ", "))
 
 								// Set Access-Control-Max-Age
-								maxAge := p.Security.CorsMaxAge
+								maxAge := endpoint.Security.CorsMaxAge
 								if maxAge == 0 {
 									maxAge = 86400 // Default to 24 hours
 								}
@@ -436,21 +582,35 @@ func New(p Params) (r Result, err error) {
 			func(r *http.Request) bool {
 				return r.Header.Get("upgrade") == ""
 			})))
-		for from, to := range p.Endpoint.Paths {
-			r.Mount("/"+from, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for from, to := range endpoint.Paths {
+			var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				// add the endpoint spec and target here!
 				r = r.WithContext(subctx.WithEndpointPath(r.Context(), to))
-				r = r.WithContext(subctx.WithEndpointSpec(r.Context(), p.Endpoint))
+				r = r.WithContext(subctx.WithEndpointSpec(r.Context(), endpoint))
+				r = r.WithContext(context.WithValue(r.Context(), httpFieldsKey{}, httpFields{
+					origin: r.Header.Get("Origin"),
+					path:   from,
+				}))
 				serverHandler.ServeHTTP(w, r)
-			}))
+			})
+			if endpoint.Costs != nil && endpoint.Costs.Batch > 0 {
+				handler = ratelimit.BatchSize(int64(maxRequestBodySize))(handler)
+			}
+			if keys != nil {
+				handler = keys.Middleware(from)(handler)
+			}
+			r.Mount("/"+from, handler)
 		}
-		// health check
-		r.Mount("/health", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.Write([]byte("OK"))
-		}))
-		// TODO: eventually stats/dashboard will be here.
-	}
-	return
+	})
+	return router, nil
+}
+
+type httpFieldsKey struct{}
+
+// httpFields are the fields of the http request which limits with a key template can count requests by
+type httpFields struct {
+	origin string
+	path   string
 }
 
 func getTraceID(ctx context.Context) string {
@@ -0,0 +1,68 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouteEndpoints(t *testing.T) {
+	// each endpoint answers with its name, and the path it was given below its prefix
+	route := func(name, host, prefix string) *endpointRoute {
+		return &endpointRoute{
+			host:   host,
+			prefix: prefix,
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(name + " " + r.URL.Path))
+			}),
+		}
+	}
+	handler := routeEndpoints([]*endpointRoute{
+		route("root", "", ""),
+		route("public", "", "/public"),
+		route("public-v2", "", "/public/v2"),
+		route("host", "rpc.example.com", ""),
+		route("host-public", "rpc.example.com", "/public"),
+	})
+
+	cases := []struct {
+		host string
+		path string
+		want string
+	}{
+		{host: "venn.local", path: "/eip155-1", want: "root /eip155-1"},
+		{host: "venn.local", path: "/public/eip155-1", want: "public /eip155-1"},
+		{host: "venn.local", path: "/public", want: "public "},
+		{host: "venn.local", path: "/public/v2/eip155-1", want: "public-v2 /eip155-1"},
+		// a prefix only matches whole segments
+		{host: "venn.local", path: "/publicity", want: "root /publicity"},
+		// a route with a host wins over a longer prefix without one
+		{host: "rpc.example.com", path: "/public/v2/eip155-1", want: "host-public /v2/eip155-1"},
+		{host: "RPC.example.com:8545", path: "/eip155-1", want: "host /eip155-1"},
+	}
+	for _, c := range cases {
+		t.Run(c.host+c.path, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, c.path, nil)
+			r.Host = c.host
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			require.Equal(t, http.StatusOK, w.Code)
+			require.Equal(t, c.want, w.Body.String())
+		})
+	}
+}
+
+func TestRouteEndpoints_NotFound(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := routeEndpoints([]*endpointRoute{
+		{host: "rpc.example.com", handler: ok},
+		{prefix: "/public", handler: ok},
+	})
+	r := httptest.NewRequest(http.MethodPost, "/eip155-1", nil)
+	r.Host = "venn.local"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,69 @@
+package gateway
+
+import (
+	"fmt"
+	"sync"
+
+	"gfx.cafe/util/go/generic"
+	"github.com/hashicorp/golang-lru/v2/simplelru"
+	"github.com/redis/rueidis"
+	"github.com/redis/rueidis/rueidislimiter"
+
+	"github.com/gfx-labs/venn/lib/config"
+	"github.com/gfx-labs/venn/lib/ratelimit"
+	"github.com/gfx-labs/venn/svc/shared/services/redi"
+)
+
+// maxAbuseLimiters is the number of limiters kept around. the limits of api keys change as the keys are refreshed, so
+// the limiters of limits nobody uses any more are evicted. the counts live in redis, so an evicted limiter which is
+// needed again loses nothing
+const maxAbuseLimiters = 1024
+
+// abuseLimiters creates the limiter of every abuse limit once, whether it is a limit of the endpoint or of an api key
+type abuseLimiters struct {
+	redi     *redi.Redis
+	endpoint string
+
+	limiters *simplelru.LRU[config.AbuseLimit, ratelimit.KeyedLimiter]
+	mu       sync.Mutex
+}
+
+func newAbuseLimiters(r *redi.Redis, endpoint string) *abuseLimiters {
+	return &abuseLimiters{
+		redi:     r,
+		endpoint: endpoint,
+		limiters: generic.Must(simplelru.NewLRU[config.AbuseLimit, ratelimit.KeyedLimiter](maxAbuseLimiters, nil)),
+	}
+}
+
+func (T *abuseLimiters) get(limits []config.AbuseLimit) ([]ratelimit.KeyedLimiter, error) {
+	T.mu.Lock()
+	defer T.mu.Unlock()
+	o := make([]ratelimit.KeyedLimiter, 0, len(limits))
+	for _, v := range limits {
+		rc, ok := T.limiters.Get(v)
+		if !ok {
+			limiter, err := rueidislimiter.NewRateLimiter(rueidislimiter.RateLimiterOption{
+				ClientBuilder: func(option rueidis.ClientOption) (rueidis.Client, error) {
+					return T.redi.R(), nil
+				},
+				KeyPrefix: fmt.Sprintf("%s:gateway:abuse:%s:%s", T.redi.Namespace(), T.endpoint, v.Id),
+				Limit:     v.Total,
+				Window:    v.Window.Duration,
+			})
+			if err != nil {
+				return nil, err
+			}
+			rc.Limiter = limiter
+			if v.KeyTemplate != "" {
+				rc.Template, err = config.ParseKeyTemplate(v.KeyTemplate)
+				if err != nil {
+					return nil, fmt.Errorf("abuse limit %s: %w", v.Id, err)
+				}
+			}
+			T.limiters.Add(v, rc)
+		}
+		o = append(o, rc)
+	}
+	return o, nil
+}
@@ -0,0 +1,255 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"gfx.cafe/open/jrpc"
+	"gfx.cafe/open/jrpc/pkg/jsonrpc"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/gfx-labs/venn/lib/config"
+	"github.com/gfx-labs/venn/lib/ratelimit"
+	"github.com/gfx-labs/venn/svc/shared/services/prom"
+	"github.com/gfx-labs/venn/svc/shared/services/redi"
+)
+
+// usageRetention is how long the usage of a period can still be read after the period is over
+const usageRetention = 62 * 24 * time.Hour
+
+// spendUsage adds the cost to the usage of every limit, unless that would take any of them past its hard threshold, in
+// which case none of them is charged. ARGV holds the cost, and then the hard threshold and expiry of every key. it
+// returns 1 and the usage of every key after, or 0, the index of the first key past its threshold and its usage.
+var spendUsage = redis.NewScript(`
+local cost = tonumber(ARGV[1])
+for i, key in ipairs(KEYS) do
+	local used = tonumber(redis.call("GET", key) or "0")
+	local hard = tonumber(ARGV[2 * i])
+	if hard > 0 and used + cost > hard then
+		return {0, i, used}
+	end
+end
+local res = {1}
+for i, key in ipairs(KEYS) do
+	res[i + 1] = redis.call("INCRBY", key, cost)
+	redis.call("EXPIREAT", key, ARGV[2 * i + 1])
+end
+return res
+`)
+
+// usagePeriod returns the calendar period containing at, in utc
+func usagePeriod(period string, at time.Time) (start, end time.Time) {
+	at = at.UTC()
+	switch period {
+	case config.UsagePeriodMonth:
+		start = time.Date(at.Year(), at.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0)
+	default:
+		start = time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 0, 1)
+	}
+}
+
+// usageLimiter counts the cost of the requests of every identifier within the periods of the usage limits in redis
+type usageLimiter struct {
+	log      *slog.Logger
+	redi     *redi.Redis
+	endpoint string
+
+	templates map[string]*config.KeyTemplate
+	mu        sync.Mutex
+}
+
+func (T *usageLimiter) key(limit config.UsageLimit, start time.Time, id string) string {
+	return fmt.Sprintf("%s:gateway:usage:%s:%s:%s:%s", T.redi.Namespace(), T.endpoint, limit.Id, start.Format(time.DateOnly), id)
+}
+
+// template returns the parsed key template of the limit, or nil if it has none
+func (T *usageLimiter) template(limit config.UsageLimit) (*config.KeyTemplate, error) {
+	if limit.KeyTemplate == "" {
+		return nil, nil
+	}
+	T.mu.Lock()
+	defer T.mu.Unlock()
+	if t, ok := T.templates[limit.KeyTemplate]; ok {
+		return t, nil
+	}
+	t, err := config.ParseKeyTemplate(limit.KeyTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("usage limit %s: %w", limit.Id, err)
+	}
+	if T.templates == nil {
+		T.templates = make(map[string]*config.KeyTemplate)
+	}
+	T.templates[limit.KeyTemplate] = t
+	return t, nil
+}
+
+// Middleware rejects requests once the usage of the identifier is past a hard threshold. pick returns the usage
+// limits of the request.
+//
+// requests are charged when they are let through, before they are served, and are not refunded if they fail. the
+// charge and the check are one atomic step, so concurrent requests can not overshoot a hard threshold, and an error
+// from the chain, such as a reverted call, is work done all the same. only requests rejected before this point, by
+// the abuse limits or a hard threshold, are free.
+func (T *usageLimiter) Middleware(pick func(r *jsonrpc.Request) []config.UsageLimit) func(jrpc.Handler) jrpc.Handler {
+	return func(next jrpc.Handler) jrpc.Handler {
+		return jsonrpc.HandlerFunc(func(w jsonrpc.ResponseWriter, r *jsonrpc.Request) {
+			id, err := ratelimit.IdentifierFromContext(r.Context())
+			if err != nil {
+				w.Send(nil, err)
+				return
+			}
+			cost := int64(1 + id.ExtraCost)
+			now := time.Now()
+			limits := pick(r)
+			if len(limits) == 0 {
+				next.ServeRPC(w, r)
+				return
+			}
+			keys := make([]string, len(limits))
+			redisKeys := make([]string, len(limits))
+			ends := make([]time.Time, len(limits))
+			args := []any{cost}
+			for i, limit := range limits {
+				template, err := T.template(limit)
+				if err != nil {
+					w.Send(nil, err)
+					return
+				}
+				keys[i] = id.KeyFor(template)
+				var start time.Time
+				start, ends[i] = usagePeriod(limit.Period, now)
+				redisKeys[i] = T.key(limit, start, keys[i])
+				args = append(args, limit.Hard, ends[i].Add(usageRetention).Unix())
+			}
+			// charged up front, whatever the outcome of the request. see above
+			res, err := spendUsage.Run(r.Context(), T.redi.C(), redisKeys, args...).Int64Slice()
+			if err != nil {
+				w.Send(nil, &jsonrpc.JsonError{
+					Code:    500,
+					Message: "Internal Server Error",
+					Data: map[string]any{
+						"Error": err.Error(),
+					},
+				})
+				return
+			}
+			if res[0] == 0 {
+				i := res[1] - 1
+				prom.Gateway.UsageRejected(prom.GatewayUsageLabel{
+					Endpoint: T.endpoint,
+					Limit:    limits[i].Id,
+				}).Inc()
+				w.Send(nil, &jsonrpc.JsonError{
+					Code:    429,
+					Message: "Usage Limit Hit",
+					Data: map[string]any{
+						"Limit": limits[i].Id,
+						"Used":  res[2],
+						"Reset": ends[i],
+						"Key":   keys[i],
+					},
+				})
+				return
+			}
+			for i, limit := range limits {
+				used := res[i+1]
+				if limit.Soft > 0 && used > limit.Soft {
+					prom.Gateway.UsageOverSoft(prom.GatewayUsageLabel{
+						Endpoint: T.endpoint,
+						Limit:    limit.Id,
+					}).Inc()
+					// only once, when the threshold is crossed
+					if used-cost <= limit.Soft {
+						T.log.Warn("usage past soft limit", "endpoint", T.endpoint, "limit", limit.Id, "key", keys[i], "used", used, "soft", limit.Soft)
+					}
+				}
+			}
+			next.ServeRPC(w, r)
+		})
+	}
+}
+
+// Usage is the usage of an identifier within the current period of a usage limit
+type Usage struct {
+	Limit  string    `json:"limit"`
+	Key    string    `json:"key"`
+	Period string    `json:"period"`
+	Start  time.Time `json:"start"`
+	Reset  time.Time `json:"reset"`
+	Used   int64     `json:"used"`
+	Soft   int64     `json:"soft,omitempty"`
+	Hard   int64     `json:"hard,omitempty"`
+}
+
+// Handler serves the usage of an identifier, given by the type and slug query params. pick returns its usage limits.
+// limits with a key template are read by the fields of their template instead, given by query params of the same
+// name. the at query param, a date, reads the periods containing it instead of the current ones.
+func (T *usageLimiter) Handler(pick func(idType, slug string) []config.UsageLimit) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		id := &ratelimit.Identifier{
+			Endpoint: T.endpoint,
+			Type:     q.Get("type"),
+			Slug:     q.Get("slug"),
+			Fields: config.KeyFields{
+				IP:     q.Get("ip"),
+				Origin: q.Get("origin"),
+				Key:    q.Get("key"),
+				Path:   q.Get("path"),
+				Target: q.Get("target"),
+				Method: q.Get("method"),
+			},
+		}
+		at := time.Now()
+		if v := q.Get("at"); v != "" {
+			var err error
+			at, err = time.Parse(time.DateOnly, v)
+			if err != nil {
+				http.Error(w, "invalid at", http.StatusBadRequest)
+				return
+			}
+		}
+
+		limits := pick(id.Type, id.Slug)
+		usages := make([]Usage, 0, len(limits))
+		for _, limit := range limits {
+			template, err := T.template(limit)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			// limits by caller can not be read without one
+			if template == nil && (id.Type == "" || id.Slug == "") {
+				continue
+			}
+			key := id.KeyFor(template)
+			start, end := usagePeriod(limit.Period, at)
+			used, err := T.redi.C().Get(r.Context(), T.key(limit, start, key)).Int64()
+			if err != nil && !errors.Is(err, redis.Nil) {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			usages = append(usages, Usage{
+				Limit:  limit.Id,
+				Key:    key,
+				Period: limit.Period,
+				Start:  start,
+				Reset:  end,
+				Used:   used,
+				Soft:   limit.Soft,
+				Hard:   limit.Hard,
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"usage": usages,
+		})
+	})
+}
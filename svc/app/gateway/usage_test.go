@@ -0,0 +1,209 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gfx.cafe/open/jrpc"
+	"gfx.cafe/open/jrpc/pkg/jsonrpc"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx/fxtest"
+
+	"github.com/gfx-labs/venn/lib/config"
+	"github.com/gfx-labs/venn/lib/jrpcutil"
+	"github.com/gfx-labs/venn/lib/ratelimit"
+	"github.com/gfx-labs/venn/svc/shared/services/redi"
+)
+
+func newTestUsageLimiter(t *testing.T) *usageLimiter {
+	lc := fxtest.NewLifecycle(t)
+	log := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	res, err := redi.New(redi.RedisParams{
+		Log: log,
+		Config: &config.Redis{
+			Namespace: "test",
+		},
+		Lc: lc,
+	})
+	require.NoError(t, err)
+	lc.RequireStart()
+	t.Cleanup(lc.RequireStop)
+	return &usageLimiter{
+		log:      log,
+		redi:     res.Redis,
+		endpoint: "public",
+	}
+}
+
+// serveUsage sends a request through the usage middleware with the limits, and returns the error it was answered with
+func serveUsage(t *testing.T, usage *usageLimiter, limits []config.UsageLimit) error {
+	h := ratelimit.WithIdentifier(func(r *jrpc.Request) (*ratelimit.Identifier, error) {
+		return &ratelimit.Identifier{
+			Endpoint: "public",
+			Type:     "ip",
+			Slug:     "127.0.0.1",
+		}, nil
+	})(usage.Middleware(func(*jsonrpc.Request) []config.UsageLimit {
+		return limits
+	})(jrpc.HandlerFunc(func(w jrpc.ResponseWriter, r *jrpc.Request) {
+		_ = w.Send("ok", nil)
+	})))
+	r, err := jsonrpc.NewRequest(context.Background(), jsonrpc.NewNullIDPtr(), "eth_chainId", nil)
+	require.NoError(t, err)
+	var icept jrpcutil.Interceptor
+	h.ServeRPC(&icept, r)
+	return icept.Error
+}
+
+func TestUsageLimiter_RejectChargesNothing(t *testing.T) {
+	usage := newTestUsageLimiter(t)
+	limits := []config.UsageLimit{
+		{Id: "daily", Period: config.UsagePeriodDay, Hard: 10},
+		{Id: "monthly", Period: config.UsagePeriodMonth, Hard: 3},
+	}
+	for range 3 {
+		require.NoError(t, serveUsage(t, usage, limits))
+	}
+
+	err := serveUsage(t, usage, limits)
+	var jerr *jsonrpc.JsonError
+	require.True(t, errors.As(err, &jerr))
+	require.Equal(t, 429, jerr.Code)
+	require.Equal(t, "monthly", jerr.Data.(map[string]any)["Limit"])
+
+	// the daily limit is not charged for the rejected request
+	id := &ratelimit.Identifier{Endpoint: "public", Type: "ip", Slug: "127.0.0.1"}
+	for _, limit := range limits {
+		start, _ := usagePeriod(limit.Period, time.Now())
+		used, err := usage.redi.C().Get(context.Background(), usage.key(limit, start, id.Key())).Int64()
+		require.NoError(t, err)
+		require.EqualValues(t, 3, used, limit.Id)
+	}
+}
+
+func TestUsagePeriod(t *testing.T) {
+	date := func(year int, month time.Month, day, hour int, loc *time.Location) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, loc)
+	}
+	east := time.FixedZone("east", 5*60*60)
+	cases := []struct {
+		name   string
+		period string
+		at     time.Time
+		start  time.Time
+		end    time.Time
+	}{
+		{name: "day", period: config.UsagePeriodDay, at: date(2024, 5, 10, 13, time.UTC), start: date(2024, 5, 10, 0, time.UTC), end: date(2024, 5, 11, 0, time.UTC)},
+		{name: "day at midnight", period: config.UsagePeriodDay, at: date(2024, 5, 10, 0, time.UTC), start: date(2024, 5, 10, 0, time.UTC), end: date(2024, 5, 11, 0, time.UTC)},
+		{name: "day in utc", period: config.UsagePeriodDay, at: date(2024, 3, 1, 1, east), start: date(2024, 2, 29, 0, time.UTC), end: date(2024, 3, 1, 0, time.UTC)},
+		{name: "unknown period is a day", period: "", at: date(2024, 5, 10, 13, time.UTC), start: date(2024, 5, 10, 0, time.UTC), end: date(2024, 5, 11, 0, time.UTC)},
+		{name: "month", period: config.UsagePeriodMonth, at: date(2024, 2, 10, 13, time.UTC), start: date(2024, 2, 1, 0, time.UTC), end: date(2024, 3, 1, 0, time.UTC)},
+		{name: "month end of year", period: config.UsagePeriodMonth, at: date(2024, 12, 31, 23, time.UTC), start: date(2024, 12, 1, 0, time.UTC), end: date(2025, 1, 1, 0, time.UTC)},
+		{name: "month in utc", period: config.UsagePeriodMonth, at: date(2024, 4, 1, 1, east), start: date(2024, 3, 1, 0, time.UTC), end: date(2024, 4, 1, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			start, end := usagePeriod(c.period, c.at)
+			require.Equal(t, c.start, start)
+			require.Equal(t, c.end, end)
+		})
+	}
+}
+
+func TestUsageLimiter_Handler(t *testing.T) {
+	usage := newTestUsageLimiter(t)
+	limits := []config.UsageLimit{
+		{Id: "daily", Period: config.UsagePeriodDay, Soft: 5, Hard: 10},
+		{Id: "monthly", Period: config.UsagePeriodMonth, Hard: 100},
+		{Id: "origin", Period: config.UsagePeriodDay, KeyTemplate: "{origin}"},
+	}
+	var picked []string
+	h := usage.Handler(func(idType, slug string) []config.UsageLimit {
+		picked = append(picked, idType+":"+slug)
+		return limits
+	})
+
+	ctx := context.Background()
+	at := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	set := func(limit config.UsageLimit, at time.Time, key string, used int64) {
+		start, _ := usagePeriod(limit.Period, at)
+		require.NoError(t, usage.redi.C().Set(ctx, usage.key(limit, start, key), used, 0).Err())
+	}
+	set(limits[0], time.Now(), "public:ip:127.0.0.1", 3)
+	set(limits[1], time.Now(), "public:ip:127.0.0.1", 30)
+	set(limits[2], time.Now(), "public:example.com", 7)
+	set(limits[0], at, "public:ip:127.0.0.1", 9)
+
+	serve := func(query string) (int, []Usage) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/usage?"+query, nil))
+		if w.Code != http.StatusOK {
+			return w.Code, nil
+		}
+		var res struct {
+			Usage []Usage `json:"usage"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		return w.Code, res.Usage
+	}
+	used := func(usages []Usage) map[string]int64 {
+		o := make(map[string]int64, len(usages))
+		for _, u := range usages {
+			o[u.Limit+" "+u.Key] = u.Used
+		}
+		return o
+	}
+
+	code, usages := serve("type=ip&slug=127.0.0.1&origin=example.com")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, map[string]int64{
+		"daily public:ip:127.0.0.1":   3,
+		"monthly public:ip:127.0.0.1": 30,
+		"origin public:example.com":   7,
+	}, used(usages))
+	start, end := usagePeriod(config.UsagePeriodDay, time.Now())
+	require.Equal(t, Usage{
+		Limit:  "daily",
+		Key:    "public:ip:127.0.0.1",
+		Period: config.UsagePeriodDay,
+		Start:  start,
+		Reset:  end,
+		Used:   3,
+		Soft:   5,
+		Hard:   10,
+	}, usages[0])
+	require.Equal(t, []string{"ip:127.0.0.1"}, picked)
+
+	// limits by caller are skipped without one
+	_, usages = serve("origin=example.com")
+	require.Equal(t, map[string]int64{
+		"origin public:example.com": 7,
+	}, used(usages))
+
+	// nothing used yet
+	_, usages = serve("type=ip&slug=10.0.0.1&origin=other.com")
+	require.Equal(t, map[string]int64{
+		"daily public:ip:10.0.0.1":   0,
+		"monthly public:ip:10.0.0.1": 0,
+		"origin public:other.com":    0,
+	}, used(usages))
+
+	// a past period
+	_, usages = serve("type=ip&slug=127.0.0.1&origin=example.com&at=2024-05-10")
+	require.Equal(t, map[string]int64{
+		"daily public:ip:127.0.0.1":   9,
+		"monthly public:ip:127.0.0.1": 0,
+		"origin public:example.com":   0,
+	}, used(usages))
+	require.Equal(t, at, usages[0].Start)
+
+	code, _ = serve("type=ip&slug=127.0.0.1&at=yesterday")
+	require.Equal(t, http.StatusBadRequest, code)
+}
@@ -32,11 +32,13 @@ import (
 	"github.com/gfx-labs/venn/lib/subctx"
 	"github.com/gfx-labs/venn/lib/util"
 	"github.com/gfx-labs/venn/svc/node/atoms/cacher"
+	"github.com/gfx-labs/venn/svc/node/atoms/headoracle"
 	"github.com/gfx-labs/venn/svc/node/atoms/stalker"
 	"github.com/gfx-labs/venn/svc/node/atoms/subcenter"
 	"github.com/gfx-labs/venn/svc/node/quarks/cluster"
 
 	"github.com/gfx-labs/venn/dashboard"
+	"github.com/gfx-labs/venn/svc/node/middlewares/deduper"
 	"github.com/gfx-labs/venn/svc/node/middlewares/headreplacer"
 	"github.com/gfx-labs/venn/svc/node/middlewares/promcollect"
 )
@@ -63,10 +65,16 @@ type Params struct {
 	// result caching for certain methods
 	Cacher *cacher.Cacher
 
+	// shares the result of identical requests which are in flight at the same time
+	Deduper *deduper.Deduper
+
 	// provides direct jsonrpc
 	Clusters  *cluster.Clusters
 	HeadStore headstore.Store
 
+	// head oracle consensus, shown on the dashboard
+	HeadOracle *headoracle.HeadOracle `optional:"true"`
+
 	// provide subscriptions like eth_subscribe
 	Subcenter     *subcenter.Subcenter
 	TraceProvider *gotel.TraceProvider `optional:"true"`
@@ -84,6 +92,8 @@ func New(p Params) (r Result, err error) {
 	waiter := util.NewWaiter()
 	middlewares := []jrpc.Middleware{
 		p.Cacher.Middleware,
+		// after the head replacer, so that requests for latest are keyed by the block number
+		p.Deduper.Middleware,
 		p.HeadReplacer.Middleware,
 		(&forger.Forger{Chains: p.Chains}).Middleware,
 		p.Subcenter.Middleware,
@@ -114,6 +124,11 @@ func New(p Params) (r Result, err error) {
 		middlewares = append(middlewares, p.Subscription.Middleware())
 	}
 
+	// the cost of the request is set on its identifier before the rate limit is charged
+	if p.AbuseLimit != nil && p.AbuseLimit.Costs != nil {
+		middlewares = append(middlewares, ratelimit.NewCoster(p.AbuseLimit.Costs).Middleware)
+	}
+
 	middlewares = append(middlewares, ratelimit.WithIdentifier(func(r *jrpc.Request) (*ratelimit.Identifier, error) {
 		slug, _, err := net.SplitHostPort(r.Peer.RemoteAddr)
 		if err == nil {
@@ -181,7 +196,11 @@ func New(p Params) (r Result, err error) {
 	})
 
 	// bind the jrpc handler to a http+websocket codec to host on the http server
-	serverHandler := codecs.HttpWebsocketHandler(handler, nil)
+	var serverHandler http.Handler = codecs.HttpWebsocketHandler(handler, nil)
+	if p.AbuseLimit != nil && p.AbuseLimit.Costs != nil && p.AbuseLimit.Costs.Batch > 0 {
+		// the same bound as the gateway puts on bodies
+		serverHandler = ratelimit.BatchSize(5 * 1024 * 1024)(serverHandler)
+	}
 	// mount the http server
 	r.Route = func(r chi.Router) {
 		r.Use(otelchi.Middleware("venn", otelchi.WithChiRoutes(r), otelchi.WithFilter(
@@ -205,7 +224,7 @@ func New(p Params) (r Result, err error) {
 		}))
 
 		// Mount dashboard
-		dashboardHandler := dashboard.NewHandler(p.Chains, p.Clusters, p.HeadStore)
+		dashboardHandler := dashboard.NewHandler(p.Chains, p.Clusters, p.HeadStore, p.HeadOracle, p.Stalker)
 		dashboardHandler.Mount(r)
 	}
 	return
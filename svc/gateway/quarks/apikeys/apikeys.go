@@ -0,0 +1,344 @@
+package apikeys
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gfx.cafe/open/jrpc"
+	"gfx.cafe/open/jrpc/pkg/jsonrpc"
+	"go.uber.org/fx"
+	"sigs.k8s.io/yaml"
+
+	"github.com/gfx-labs/venn/lib/config"
+	"github.com/gfx-labs/venn/svc/shared/services/redi"
+)
+
+var (
+	ErrKeyRequired     = &jsonrpc.JsonError{Code: 401, Message: "api key required"}
+	ErrKeyInvalid      = &jsonrpc.JsonError{Code: 401, Message: "invalid api key"}
+	ErrPathForbidden   = &jsonrpc.JsonError{Code: 403, Message: "api key not allowed on this path"}
+	ErrMethodForbidden = &jsonrpc.JsonError{Code: 403, Message: "api key not allowed to call this method"}
+)
+
+type Params struct {
+	fx.In
+
+	Endpoints []*config.EndpointSpec
+	Redi      *redi.Redis `optional:"true"`
+
+	Ctx context.Context
+	Log *slog.Logger
+}
+
+type Result struct {
+	fx.Out
+
+	Output *Keyring
+}
+
+// Keyring holds the api keys of every endpoint which has them
+type Keyring struct {
+	keys map[string]*Keys
+}
+
+// Keys returns the api keys of the endpoint, or nil if it has none
+func (T *Keyring) Keys(endpoint string) *Keys {
+	if T == nil {
+		return nil
+	}
+	return T.keys[endpoint]
+}
+
+// Keys holds the api keys of the endpoint. they are reloaded from their source periodically, so that added and
+// revoked keys apply without a restart.
+type Keys struct {
+	log    *slog.Logger
+	config *config.ApiKeys
+	load   func(ctx context.Context) ([]*config.ApiKey, error)
+
+	keys atomic.Pointer[map[string]*config.ApiKey]
+}
+
+func New(p Params) (r Result, err error) {
+	r.Output = &Keyring{
+		keys: make(map[string]*Keys),
+	}
+	for _, endpoint := range p.Endpoints {
+		if endpoint.Keys == nil {
+			continue
+		}
+		keys, err := newKeys(p, endpoint)
+		if err != nil {
+			return r, fmt.Errorf("endpoint %s: %w", endpoint.Name, err)
+		}
+		r.Output.keys[endpoint.Name] = keys
+	}
+	return
+}
+
+func newKeys(p Params, endpoint *config.EndpointSpec) (*Keys, error) {
+	o := &Keys{
+		log:    p.Log.With("endpoint", endpoint.Name),
+		config: endpoint.Keys,
+	}
+	switch o.config.Source {
+	case config.ApiKeySourceRedis:
+		if p.Redi == nil {
+			return nil, errors.New("api keys are stored in redis, but there is no redis")
+		}
+		o.load = redisLoader(p.Redi, fmt.Sprintf("%s:gateway:keys:%s", p.Redi.Namespace(), endpoint.Name))
+	case config.ApiKeySourceFile:
+		o.load = fileLoader(o.config.File)
+	default:
+		return nil, fmt.Errorf("invalid api key source: %s", o.config.Source)
+	}
+
+	// requests can not be identified without the keys, so the gateway does not start without them
+	ctx, cancel := context.WithTimeout(p.Ctx, 10*time.Second)
+	defer cancel()
+	if err := o.refresh(ctx); err != nil {
+		return nil, fmt.Errorf("load api keys: %w", err)
+	}
+	go o.run(p.Ctx)
+	return o, nil
+}
+
+// redisLoader loads the keys from a hash of key to the json encoded key
+func redisLoader(r *redi.Redis, hash string) func(ctx context.Context) ([]*config.ApiKey, error) {
+	return func(ctx context.Context) ([]*config.ApiKey, error) {
+		values, err := r.C().HGetAll(ctx, hash).Result()
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]*config.ApiKey, 0, len(values))
+		for field, value := range values {
+			key := &config.ApiKey{}
+			if err := json.Unmarshal([]byte(value), key); err != nil {
+				return nil, fmt.Errorf("decode key %s: %w", keyName(field), err)
+			}
+			key.Key = field
+			keys = append(keys, key)
+		}
+		return keys, nil
+	}
+}
+
+// fileLoader loads the keys from a yaml or json file holding a list of keys
+func fileLoader(file string) func(ctx context.Context) ([]*config.ApiKey, error) {
+	return func(ctx context.Context) ([]*config.ApiKey, error) {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var keys []*config.ApiKey
+		if err := yaml.Unmarshal(data, &keys); err != nil {
+			return nil, err
+		}
+		return keys, nil
+	}
+}
+
+// keyName is the name of a key without one, which identifies it without giving it away in logs and telemetry
+func keyName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "key-" + hex.EncodeToString(sum[:6])
+}
+
+func (T *Keys) refresh(ctx context.Context) error {
+	loaded, err := T.load(ctx)
+	if err != nil {
+		return err
+	}
+	keys := make(map[string]*config.ApiKey, len(loaded))
+	for _, key := range loaded {
+		if key == nil || key.Key == "" {
+			continue
+		}
+		if key.Name == "" {
+			key.Name = keyName(key.Key)
+		}
+		if key.Limits != nil {
+			if err := key.Limits.Validate(); err != nil {
+				T.log.Error("skipping api key with invalid limits", "name", key.Name, "err", err)
+				continue
+			}
+		}
+		keys[key.Key] = key
+	}
+	T.keys.Store(&keys)
+	return nil
+}
+
+func (T *Keys) run(ctx context.Context) {
+	ticker := time.NewTicker(T.config.Refresh.Duration)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// the keys which were loaded last stay in use until the source is back
+		if err := T.refresh(ctx); err != nil && ctx.Err() == nil {
+			T.log.Error("failed to refresh api keys", "source", T.config.Source, "err", err)
+		}
+	}
+}
+
+// Lookup returns the key, unless it is unknown or revoked
+func (T *Keys) Lookup(key string) (*config.ApiKey, bool) {
+	o, ok := (*T.keys.Load())[key]
+	if !ok || o.Revoked {
+		return nil, false
+	}
+	return o, true
+}
+
+// Named returns the first key with the name which is not revoked. keys with the same name share their limits
+func (T *Keys) Named(name string) (*config.ApiKey, bool) {
+	for _, key := range *T.keys.Load() {
+		if key.Name == name && !key.Revoked {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// extract returns the key the request carries, or an empty string. path is the endpoint path the request was sent to
+func (T *Keys) extract(r *http.Request, path string) string {
+	if T.config.Header != "" {
+		if key := r.Header.Get(T.config.Header); key != "" {
+			return key
+		}
+	}
+	if T.config.Query != "" {
+		if key := r.URL.Query().Get(T.config.Query); key != "" {
+			return key
+		}
+	}
+	if T.config.PathSegment {
+		rest := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/"+path), "/")
+		key, _, _ := strings.Cut(rest, "/")
+		return key
+	}
+	return ""
+}
+
+// withoutKey returns the request with the key taken out of its url, so that it is not passed on or recorded along with
+// the url further down
+func (T *Keys) withoutKey(r *http.Request, path string, raw string) *http.Request {
+	u := *r.URL
+	if T.config.Query != "" {
+		q := u.Query()
+		if q.Get(T.config.Query) == raw {
+			q.Del(T.config.Query)
+			u.RawQuery = q.Encode()
+		}
+	}
+	if T.config.PathSegment {
+		base := "/" + path
+		if rest, ok := strings.CutPrefix(u.Path, base+"/"+raw); ok && (rest == "" || rest[0] == '/') {
+			u.Path = base + rest
+			u.RawPath = ""
+		}
+	}
+	if u == *r.URL {
+		return r
+	}
+	r = r.Clone(r.Context())
+	r.URL = &u
+	r.RequestURI = u.RequestURI()
+	return r
+}
+
+func allowsPath(key *config.ApiKey, path string) bool {
+	return len(key.Paths) == 0 || slices.Contains(key.Paths, path)
+}
+
+// Middleware rejects http requests to the endpoint path with a missing, unknown or forbidden key, and passes the key
+// on to the rpc requests
+func (T *Keys) Middleware(path string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			raw := T.extract(r, path)
+			if raw == "" {
+				if T.config.Required {
+					http.Error(w, ErrKeyRequired.Message, http.StatusUnauthorized)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+			key, ok := T.Lookup(raw)
+			if !ok {
+				http.Error(w, ErrKeyInvalid.Message, http.StatusUnauthorized)
+				return
+			}
+			if !allowsPath(key, path) {
+				http.Error(w, ErrPathForbidden.Message, http.StatusForbidden)
+				return
+			}
+			r = T.withoutKey(r, path, raw)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), keyRequest{}, keyedRequest{
+				raw:  raw,
+				path: path,
+			})))
+		})
+	}
+}
+
+// RPCMiddleware looks the key up again for every rpc request, so that a key revoked while a websocket is open stops
+// working right away, and checks the methods the key may call. it runs after the method whitelist of the endpoint, so
+// the methods of a key can only narrow it down
+func (T *Keys) RPCMiddleware() func(jrpc.Handler) jrpc.Handler {
+	return func(next jrpc.Handler) jrpc.Handler {
+		return jsonrpc.HandlerFunc(func(w jsonrpc.ResponseWriter, r *jsonrpc.Request) {
+			req, ok := r.Context().Value(keyRequest{}).(keyedRequest)
+			if !ok {
+				next.ServeRPC(w, r)
+				return
+			}
+			key, ok := T.Lookup(req.raw)
+			if !ok {
+				w.Send(nil, ErrKeyInvalid)
+				return
+			}
+			if !allowsPath(key, req.path) {
+				w.Send(nil, ErrPathForbidden)
+				return
+			}
+			if len(key.Methods) > 0 && !slices.Contains(key.Methods, r.Method) {
+				w.Send(nil, ErrMethodForbidden)
+				return
+			}
+			next.ServeRPC(w, r.WithContext(context.WithValue(r.Context(), keyKey{}, key)))
+		})
+	}
+}
+
+type keyRequest struct{}
+
+// keyedRequest is the key an http request was made with, and the endpoint path it was made to
+type keyedRequest struct {
+	raw  string
+	path string
+}
+
+type keyKey struct{}
+
+// FromContext returns the api key the request was made with, or nil
+func FromContext(ctx context.Context) *config.ApiKey {
+	key, _ := ctx.Value(keyKey{}).(*config.ApiKey)
+	return key
+}
@@ -0,0 +1,224 @@
+package apikeys
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gfx.cafe/open/jrpc"
+	"gfx.cafe/open/jrpc/pkg/jsonrpc"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gfx-labs/venn/lib/config"
+	"github.com/gfx-labs/venn/lib/jrpcutil"
+)
+
+func newTestKeys(t *testing.T, cfg *config.ApiKeys, keys ...*config.ApiKey) *Keys {
+	o := &Keys{
+		log:    slog.New(slog.NewJSONHandler(io.Discard, nil)),
+		config: cfg,
+		load: func(context.Context) ([]*config.ApiKey, error) {
+			return keys, nil
+		},
+	}
+	require.NoError(t, o.refresh(context.Background()))
+	return o
+}
+
+func TestKeys_Extract(t *testing.T) {
+	cfg := &config.ApiKeys{
+		Header:      "X-Api-Key",
+		Query:       "key",
+		PathSegment: true,
+	}
+	keys := newTestKeys(t, cfg)
+	cases := []struct {
+		name   string
+		url    string
+		header string
+		want   string
+	}{
+		{name: "none", url: "/eip155-1"},
+		{name: "header", url: "/eip155-1", header: "h", want: "h"},
+		{name: "query", url: "/eip155-1?key=q", want: "q"},
+		{name: "path", url: "/eip155-1/p", want: "p"},
+		{name: "path with rest", url: "/eip155-1/p/ws", want: "p"},
+		{name: "header before query", url: "/eip155-1?key=q", header: "h", want: "h"},
+		{name: "query before path", url: "/eip155-1/p?key=q", want: "q"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, c.url, nil)
+			if c.header != "" {
+				r.Header.Set("X-Api-Key", c.header)
+			}
+			require.Equal(t, c.want, keys.extract(r, "eip155-1"))
+		})
+	}
+}
+
+func TestKeys_Refresh(t *testing.T) {
+	keys := newTestKeys(t, &config.ApiKeys{},
+		&config.ApiKey{Key: "good", Name: "good"},
+		&config.ApiKey{Key: "unnamed"},
+		&config.ApiKey{Key: "revoked", Revoked: true},
+		&config.ApiKey{Key: "invalid", Limits: &config.EndpointLimits{
+			Usage: []config.UsageLimit{{Id: "daily", Period: "fortnight"}},
+		}},
+		&config.ApiKey{},
+		nil,
+	)
+	cases := []struct {
+		key  string
+		ok   bool
+		name string
+	}{
+		{key: "good", ok: true, name: "good"},
+		{key: "unnamed", ok: true, name: keyName("unnamed")},
+		{key: "revoked"},
+		{key: "invalid"},
+		{key: ""},
+		{key: "unknown"},
+	}
+	for _, c := range cases {
+		key, ok := keys.Lookup(c.key)
+		require.Equal(t, c.ok, ok, c.key)
+		if ok {
+			require.Equal(t, c.name, key.Name)
+		}
+	}
+	_, ok := keys.Named("good")
+	require.True(t, ok)
+	_, ok = keys.Named(keyName("revoked"))
+	require.False(t, ok)
+}
+
+func TestKeys_Middleware(t *testing.T) {
+	cases := []struct {
+		name     string
+		required bool
+		key      string
+		want     int
+		wantKey  bool
+	}{
+		{name: "missing", want: http.StatusOK},
+		{name: "missing required", required: true, want: http.StatusUnauthorized},
+		{name: "valid", key: "good", want: http.StatusOK, wantKey: true},
+		{name: "unknown", key: "unknown", want: http.StatusUnauthorized},
+		{name: "revoked", key: "revoked", want: http.StatusUnauthorized},
+		{name: "forbidden path", key: "other-path", want: http.StatusForbidden},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			keys := newTestKeys(t, &config.ApiKeys{Header: "X-Api-Key", Required: c.required},
+				&config.ApiKey{Key: "good", Paths: []string{"eip155-1"}},
+				&config.ApiKey{Key: "revoked", Revoked: true},
+				&config.ApiKey{Key: "other-path", Paths: []string{"eip155-8453"}},
+			)
+			var keyed bool
+			h := keys.Middleware("eip155-1")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, keyed = r.Context().Value(keyRequest{}).(keyedRequest)
+			}))
+			r := httptest.NewRequest(http.MethodPost, "/eip155-1", nil)
+			if c.key != "" {
+				r.Header.Set("X-Api-Key", c.key)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			require.Equal(t, c.want, w.Code)
+			require.Equal(t, c.wantKey, keyed)
+		})
+	}
+}
+
+func TestKeys_MiddlewareStripsKey(t *testing.T) {
+	keys := newTestKeys(t, &config.ApiKeys{Header: "X-Api-Key", Query: "key", PathSegment: true},
+		&config.ApiKey{Key: "good"},
+	)
+	cases := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{name: "query", url: "/eip155-1?key=good", want: "/eip155-1"},
+		{name: "query with others", url: "/eip155-1?a=1&key=good", want: "/eip155-1?a=1"},
+		{name: "path", url: "/eip155-1/good", want: "/eip155-1"},
+		{name: "path with rest", url: "/eip155-1/good/ws?a=1", want: "/eip155-1/ws?a=1"},
+		{name: "header", url: "/eip155-1/other", want: "/eip155-1/other"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var got string
+			h := keys.Middleware("eip155-1")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.URL.RequestURI()
+				require.Equal(t, got, r.RequestURI)
+				_, keyed := r.Context().Value(keyRequest{}).(keyedRequest)
+				require.True(t, keyed)
+			}))
+			r := httptest.NewRequest(http.MethodPost, c.url, nil)
+			if c.name == "header" {
+				r.Header.Set("X-Api-Key", "good")
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			require.Equal(t, http.StatusOK, w.Code)
+			require.Equal(t, c.want, got)
+		})
+	}
+}
+
+func TestKeys_RPCMiddleware(t *testing.T) {
+	keys := newTestKeys(t, &config.ApiKeys{Header: "X-Api-Key"},
+		&config.ApiKey{Key: "good", Name: "good", Methods: []string{"eth_call"}},
+		&config.ApiKey{Key: "other-path", Paths: []string{"eip155-8453"}},
+	)
+	h := keys.RPCMiddleware()(jrpc.HandlerFunc(func(w jrpc.ResponseWriter, r *jrpc.Request) {
+		name := ""
+		if key := FromContext(r.Context()); key != nil {
+			name = key.Name
+		}
+		_ = w.Send(name, nil)
+	}))
+	cases := []struct {
+		name   string
+		raw    string
+		method string
+		revoke bool
+		want   string
+		err    error
+	}{
+		{name: "without key", method: "eth_call"},
+		{name: "allowed", raw: "good", method: "eth_call", want: "good"},
+		{name: "forbidden method", raw: "good", method: "eth_getLogs", err: ErrMethodForbidden},
+		{name: "forbidden path", raw: "other-path", method: "eth_call", err: ErrPathForbidden},
+		{name: "revoked since the request", raw: "good", method: "eth_call", revoke: true, err: ErrKeyInvalid},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if c.revoke {
+				keys.load = func(context.Context) ([]*config.ApiKey, error) {
+					return []*config.ApiKey{{Key: "good", Revoked: true}}, nil
+				}
+				require.NoError(t, keys.refresh(context.Background()))
+			}
+			ctx := context.Background()
+			if c.raw != "" {
+				ctx = context.WithValue(ctx, keyRequest{}, keyedRequest{raw: c.raw, path: "eip155-1"})
+			}
+			r, err := jsonrpc.NewRequest(ctx, jsonrpc.NewNullIDPtr(), c.method, nil)
+			require.NoError(t, err)
+			var icept jrpcutil.Interceptor
+			h.ServeRPC(&icept, r)
+			if c.err != nil {
+				require.True(t, errors.Is(icept.Error, c.err), icept.Error)
+				return
+			}
+			require.NoError(t, icept.Error)
+			require.Equal(t, c.want, icept.Result)
+		})
+	}
+}
@@ -2,9 +2,13 @@ package cacher
 
 import (
 	"bytes"
+	"cmp"
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"slices"
 
 	"github.com/gfx-labs/venn/lib/subctx"
 
@@ -14,24 +18,33 @@ import (
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/go-faster/jx"
 	"go.uber.org/fx"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/gfx-labs/venn/lib/config"
 	"github.com/gfx-labs/venn/lib/ethtypes"
 	"github.com/gfx-labs/venn/lib/jrpcutil"
 	"github.com/gfx-labs/venn/lib/stores/blockstore"
+	"github.com/gfx-labs/venn/lib/stores/headstore"
+	"github.com/gfx-labs/venn/svc/node/atoms/vennstore"
 	"github.com/gfx-labs/venn/svc/node/quarks/cluster"
 )
 
 type Cacher struct {
-	store blockstore.Store
+	log       *slog.Logger
+	store     blockstore.Store
+	headstore headstore.Store
+	reorgs    *vennstore.Reorgs
 }
 
 type Params struct {
 	fx.In
 
-	Chains   map[string]*config.Chain
-	Clusters *cluster.Clusters
-	Blocks   blockstore.Store
+	Log       *slog.Logger
+	Chains    map[string]*config.Chain
+	Clusters  *cluster.Clusters
+	Blocks    blockstore.Store
+	Headstore headstore.Store
+	Reorgs    *vennstore.Reorgs
 }
 
 type Result struct {
@@ -40,12 +53,21 @@ type Result struct {
 	Cacher *Cacher
 }
 
-// maxLogRange is the max range for logs before they are ignored from the cache
-const maxLogRange = 10
+const (
+	// maxLogRange is the max range for logs before they are ignored from the cache, on chains without a log cache
+	maxLogRange = 10
+	// logScanWindow is the number of blocks of logs looked up in the cache at once
+	logScanWindow = 1024
+	// logFetchConcurrency is the number of chunks of missing logs fetched from the remotes at once
+	logFetchConcurrency = 4
+)
 
 func New(p Params) (r Result, err error) {
 	r.Cacher = &Cacher{
-		store: p.Blocks,
+		log:       p.Log,
+		store:     p.Blocks,
+		headstore: p.Headstore,
+		reorgs:    p.Reorgs,
 	}
 	return
 }
@@ -142,21 +164,31 @@ func rawStrToHash(rawStr []byte) common.Hash {
 }
 
 func (T *Cacher) filterLogs(filter *ethtypes.CompiledFilter, entries []*blockstore.Entry) (json.RawMessage, error) {
-	var header ethtypes.LogAddressTopics
-
 	var w jx.Writer
 	w.ArrStart()
 	firstLog := true
+	if err := T.writeFilteredLogs(&w, &firstLog, filter, entries); err != nil {
+		return nil, err
+	}
+	w.ArrEnd()
+
+	return w.Buf, nil
+}
+
+// writeFilteredLogs writes the logs of the entries which match the filter into the array being written by w
+func (T *Cacher) writeFilteredLogs(w *jx.Writer, firstLog *bool, filter *ethtypes.CompiledFilter, entries []*blockstore.Entry) error {
+	var header ethtypes.LogAddressTopics
+
 	for _, entry := range entries {
 		d := jx.DecodeBytes(entry.Value)
 		arr, err := d.ArrIter()
 		if err != nil {
-			return nil, err
+			return err
 		}
 		for arr.Next() {
 			raw, err := d.Raw()
 			if err != nil {
-				return nil, err
+				return err
 			}
 
 			header.Topics = header.Topics[:0]
@@ -166,34 +198,34 @@ func (T *Cacher) filterLogs(filter *ethtypes.CompiledFilter, entries []*blocksto
 
 			log, err := dd.ObjIter()
 			if err != nil {
-				return nil, err
+				return err
 			}
 
 			for log.Next() {
 				if bytes.Equal(log.Key(), []byte("address")) {
 					address, err := dd.StrBytes()
 					if err != nil {
-						return nil, err
+						return err
 					}
 
 					header.Address = rawStrToAddress(address)
 				} else if bytes.Equal(log.Key(), []byte("topics")) {
 					topics, err := dd.ArrIter()
 					if err != nil {
-						return nil, err
+						return err
 					}
 
 					for topics.Next() {
 						topic, err := dd.StrBytes()
 						if err != nil {
-							return nil, err
+							return err
 						}
 
 						header.Topics = append(header.Topics, rawStrToHash(topic))
 					}
 				} else {
 					if err = dd.Skip(); err != nil {
-						return nil, err
+						return err
 					}
 				}
 			}
@@ -202,19 +234,147 @@ func (T *Cacher) filterLogs(filter *ethtypes.CompiledFilter, entries []*blocksto
 				continue
 			}
 
-			if firstLog {
-				firstLog = false
+			if *firstLog {
+				*firstLog = false
 			} else {
 				w.Comma()
 			}
 			w.Raw(raw)
 		}
 	}
+
+	return nil
+}
+
+// getLogsRange serves a range of logs from the cache. the range is looked up in windows, and the blocks in each window
+// which are not cached are fetched from the remotes in chunks, which puts them in the cache for next time. long runs
+// of missing blocks are fetched from remote with the params of the caller instead.
+func (T *Cacher) getLogsRange(ctx context.Context, chain *config.Chain, remote jrpc.Handler, params json.RawMessage, query blockstore.QueryRange, filter *ethtypes.CompiledFilter) (json.RawMessage, error) {
+	var w jx.Writer
+	w.ArrStart()
+	firstLog := true
+	for start := query.Start; start <= query.End; start += logScanWindow {
+		window := blockstore.QueryRange{
+			Start: start,
+			End:   min(start+logScanWindow-1, query.End),
+		}
+		entries, err := T.getLogEntries(ctx, chain, remote, params, window)
+		if err != nil {
+			return nil, err
+		}
+		if err := T.writeFilteredLogs(&w, &firstLog, filter, entries); err != nil {
+			return nil, fmt.Errorf("failed to filter logs: %w", err)
+		}
+	}
 	w.ArrEnd()
 
 	return w.Buf, nil
 }
 
+// getLogEntries returns the log entries in the range, in order. blocks without logs may not have an entry, and the
+// entry of a run fetched with the params of the caller holds the logs of every block of the run.
+func (T *Cacher) getLogEntries(ctx context.Context, chain *config.Chain, remote jrpc.Handler, params json.RawMessage, query blockstore.QueryRange) ([]*blockstore.Entry, error) {
+	var entries []*blockstore.Entry
+	if partial, ok := T.store.(blockstore.PartialStore); ok {
+		var err error
+		entries, err = partial.GetPartial(ctx, chain, blockstore.EntryLogs, query)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var chunks, runs []blockstore.QueryRange
+	for _, missing := range blockstore.MissingRanges(query, entries) {
+		// caching every log of a long run costs far more than the logs the caller asked for
+		if int(missing.End-missing.Start)+1 > chain.LogCache.FilteredRun {
+			runs = append(runs, missing)
+			continue
+		}
+		fromBlock := ethtypes.BlockNumber(missing.Start)
+		toBlock := ethtypes.BlockNumber(missing.End)
+		filter := ethtypes.FilterQuery{
+			FromBlock: &fromBlock,
+			ToBlock:   &toBlock,
+		}
+		size := (int(missing.End-missing.Start) + chain.LogCache.ChunkSize) / chain.LogCache.ChunkSize
+		for _, split := range filter.SplitBlockRange(int(missing.End), size) {
+			chunks = append(chunks, blockstore.QueryRange{
+				Start: hexutil.Uint64(*split.FromBlock),
+				End:   hexutil.Uint64(*split.ToBlock),
+			})
+		}
+	}
+	if len(chunks) == 0 && len(runs) == 0 {
+		return entries, nil
+	}
+
+	fetched := make([][]*blockstore.Entry, len(chunks)+len(runs))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(logFetchConcurrency)
+	for i, chunk := range chunks {
+		g.Go(func() error {
+			res, err := T.store.Get(gctx, chain, blockstore.EntryLogs, chunk)
+			if err != nil {
+				return err
+			}
+			fetched[i] = res
+			return nil
+		})
+	}
+	for i, run := range runs {
+		g.Go(func() error {
+			res, err := T.filteredLogs(gctx, remote, params, run)
+			if err != nil {
+				return err
+			}
+			fetched[len(chunks)+i] = res
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	for _, res := range fetched {
+		entries = append(entries, res...)
+	}
+	slices.SortFunc(entries, func(a, b *blockstore.Entry) int {
+		return cmp.Compare(a.BlockNumber, b.BlockNumber)
+	})
+	return entries, nil
+}
+
+// filteredLogs fetches the logs of the run from remote with the params of the caller. the logs are not cached
+func (T *Cacher) filteredLogs(ctx context.Context, remote jrpc.Handler, params json.RawMessage, run blockstore.QueryRange) ([]*blockstore.Entry, error) {
+	// the filter is passed on as is, apart from the range, so that it means the same to the remote
+	var filters []map[string]json.RawMessage
+	if err := json.Unmarshal(params, &filters); err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+	if len(filters) != 1 {
+		return nil, jsonrpc.NewInvalidParamsError("expected 1 parameter")
+	}
+	filter := filters[0]
+	var err error
+	if filter["fromBlock"], err = json.Marshal(run.Start); err != nil {
+		return nil, err
+	}
+	if filter["toBlock"], err = json.Marshal(run.End); err != nil {
+		return nil, err
+	}
+	var logs json.RawMessage
+	if err := jrpcutil.Do(ctx, remote, &logs, "eth_getLogs", []any{filter}); err != nil {
+		return nil, err
+	}
+	if len(logs) == 0 || bytes.Equal(logs, []byte("null")) {
+		return nil, nil
+	}
+	return []*blockstore.Entry{{
+		BlockNumber: run.Start,
+		Value:       logs,
+	}}, nil
+}
+
 func (T *Cacher) Middleware(next jrpc.Handler) jrpc.Handler {
 	return jrpc.HandlerFunc(func(w jrpc.ResponseWriter, r *jrpc.Request) {
 		chain, err := subctx.GetChain(r.Context())
@@ -395,36 +555,78 @@ func (T *Cacher) Middleware(next jrpc.Handler) jrpc.Handler {
 				return
 			}
 
-			var logs []*blockstore.Entry
-			var err error
+			filter := ethtypes.CompileFilter(params[0].Addresses, params[0].Topics)
 			if params[0].BlockHash != nil {
-				logs, err = T.store.Get(r.Context(), chain, blockstore.EntryLogs, blockstore.QueryHash(*params[0].BlockHash))
-			} else if params[0].FromBlock != nil && params[0].ToBlock != nil {
+				logs, err := T.store.Get(r.Context(), chain, blockstore.EntryLogs, blockstore.QueryHash(*params[0].BlockHash))
+				if err != nil {
+					_ = w.Send(nil, err)
+					return
+				}
+
+				raw, err := T.filterLogs(filter, logs)
+				if err != nil {
+					err = fmt.Errorf("failed to filter logs: %w", err)
+				}
+				_ = w.Send(raw, err)
+				return
+			}
+
+			if params[0].FromBlock == nil || params[0].ToBlock == nil || *params[0].FromBlock < 0 || *params[0].ToBlock < *params[0].FromBlock {
+				next.ServeRPC(w, r)
+				return
+			}
+			// without a log cache, only short ranges are served from the cache
+			if chain.LogCache == nil {
 				if *params[0].ToBlock-*params[0].FromBlock > maxLogRange {
 					next.ServeRPC(w, r)
 					return
 				}
-
-				logs, err = T.store.Get(r.Context(), chain, blockstore.EntryLogs, blockstore.QueryRange{
+				logs, err := T.store.Get(r.Context(), chain, blockstore.EntryLogs, blockstore.QueryRange{
 					Start: hexutil.Uint64(*params[0].FromBlock),
 					End:   hexutil.Uint64(*params[0].ToBlock),
 				})
-			} else {
-				next.ServeRPC(w, r)
+				if err != nil {
+					_ = w.Send(nil, err)
+					return
+				}
+				raw, err := T.filterLogs(filter, logs)
+				if err != nil {
+					err = fmt.Errorf("failed to filter logs: %w", err)
+				}
+				_ = w.Send(raw, err)
 				return
 			}
-			if err != nil {
-				_ = w.Send(nil, err)
+			if int(*params[0].ToBlock-*params[0].FromBlock) >= chain.LogCache.MaxRange {
+				next.ServeRPC(w, r)
 				return
 			}
 
-			filter := ethtypes.CompileFilter(params[0].Addresses, params[0].Topics)
-			raw, err := T.filterLogs(filter, logs)
-			if err != nil {
-				err = fmt.Errorf("failed to filter logs: %w", err)
+			// a range past the head may reach blocks the remotes have but the cache does not know of yet, so it is left
+			// to them rather than cut short
+			head, err := T.headstore.Get(r.Context(), chain)
+			if err != nil || head == 0 || hexutil.Uint64(*params[0].ToBlock) > head {
+				next.ServeRPC(w, r)
+				return
 			}
+
+			raw, err := T.getLogsRange(r.Context(), chain, next, r.Params, blockstore.QueryRange{
+				Start: hexutil.Uint64(*params[0].FromBlock),
+				End:   hexutil.Uint64(*params[0].ToBlock),
+			}, filter)
 			_ = w.Send(raw, err)
 			return
+		case "eth_getTransactionReceipt":
+			T.serveTxByHash(w, r, next, chain, blockstore.EntryReceipts)
+			return
+		case "eth_getTransactionByHash":
+			T.serveTxByHash(w, r, next, chain, blockstore.EntryBlockHeader)
+			return
+		case "eth_getTransactionByBlockHashAndIndex", "eth_getTransactionByBlockNumberAndIndex":
+			T.serveTxByBlock(w, r, next, chain)
+			return
+		case "eth_call", "eth_getBalance", "eth_getCode", "eth_getStorageAt":
+			T.serveState(w, r, next, chain, stateBlockParams[r.Method])
+			return
 		default:
 			next.ServeRPC(w, r)
 		}
@@ -0,0 +1,208 @@
+package cacher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"gfx.cafe/open/jrpc"
+	"gfx.cafe/open/jrpc/pkg/jsonrpc"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gfx-labs/venn/lib/config"
+	"github.com/gfx-labs/venn/lib/jrpcutil"
+	"github.com/gfx-labs/venn/lib/stores/blockstore"
+	"github.com/gfx-labs/venn/lib/stores/headstore"
+	"github.com/gfx-labs/venn/lib/subctx"
+)
+
+// testLog returns the logs of a block, which has a single log
+func testLog(number hexutil.Uint64) json.RawMessage {
+	return json.RawMessage(fmt.Sprintf(`[{"address":"0x0000000000000000000000000000000000000001","topics":[],"blockNumber":"%s"}]`, number))
+}
+
+// testLogStore holds the cached logs, and fetches the blocks it does not have as the remotes would
+type testLogStore struct {
+	cached  map[hexutil.Uint64]*blockstore.Entry
+	fetched []blockstore.QueryRange
+	mu      sync.Mutex
+}
+
+func newTestLogStore(cached ...hexutil.Uint64) *testLogStore {
+	store := &testLogStore{cached: make(map[hexutil.Uint64]*blockstore.Entry)}
+	for _, number := range cached {
+		store.cached[number] = &blockstore.Entry{BlockNumber: number, Value: testLog(number)}
+	}
+	return store
+}
+
+func (T *testLogStore) Get(_ context.Context, _ *config.Chain, typ blockstore.EntryType, query blockstore.Query) ([]*blockstore.Entry, error) {
+	q, ok := query.(blockstore.QueryRange)
+	if !ok || typ != blockstore.EntryLogs {
+		return nil, errors.New("unexpected query")
+	}
+	T.mu.Lock()
+	defer T.mu.Unlock()
+	T.fetched = append(T.fetched, q)
+	var entries []*blockstore.Entry
+	for i := q.Start; i <= q.End; i++ {
+		entries = append(entries, &blockstore.Entry{BlockNumber: i, Value: testLog(i)})
+	}
+	return entries, nil
+}
+
+func (T *testLogStore) GetPartial(_ context.Context, _ *config.Chain, _ blockstore.EntryType, query blockstore.QueryRange) ([]*blockstore.Entry, error) {
+	T.mu.Lock()
+	defer T.mu.Unlock()
+	var entries []*blockstore.Entry
+	for i := query.Start; i <= query.End; i++ {
+		if entry, ok := T.cached[i]; ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (T *testLogStore) Put(context.Context, *config.Chain, blockstore.EntryType, ...*blockstore.Entry) error {
+	return nil
+}
+
+// fetchedBlocks returns every block fetched from the store, in order
+func (T *testLogStore) fetchedBlocks() []hexutil.Uint64 {
+	T.mu.Lock()
+	defer T.mu.Unlock()
+	var blocks []hexutil.Uint64
+	for _, q := range T.fetched {
+		for i := q.Start; i <= q.End; i++ {
+			blocks = append(blocks, i)
+		}
+	}
+	slices.Sort(blocks)
+	return blocks
+}
+
+// testLogRemote serves eth_getLogs, and records the filters it was called with
+type testLogRemote struct {
+	filters []map[string]json.RawMessage
+	mu      sync.Mutex
+}
+
+func (T *testLogRemote) ServeRPC(w jrpc.ResponseWriter, r *jrpc.Request) {
+	var params []map[string]json.RawMessage
+	if err := json.Unmarshal(r.Params, &params); err != nil {
+		_ = w.Send(nil, err)
+		return
+	}
+	T.mu.Lock()
+	T.filters = append(T.filters, params[0])
+	T.mu.Unlock()
+
+	var from, to hexutil.Uint64
+	_ = json.Unmarshal(params[0]["fromBlock"], &from)
+	_ = json.Unmarshal(params[0]["toBlock"], &to)
+	var logs []string
+	for i := from; i <= to; i++ {
+		raw := testLog(i)
+		logs = append(logs, string(raw[1:len(raw)-1]))
+	}
+	_ = w.Send(json.RawMessage("["+strings.Join(logs, ",")+"]"), nil)
+}
+
+func newTestCacher(t *testing.T, store blockstore.Store, head hexutil.Uint64) (*Cacher, *config.Chain) {
+	chain := &config.Chain{
+		Name: "test",
+		LogCache: &config.LogCache{
+			ChunkSize:   20,
+			MaxRange:    5000,
+			FilteredRun: 30,
+		},
+	}
+	heads := headstore.NewAtomic()
+	_, err := heads.Put(context.Background(), chain, head)
+	require.NoError(t, err)
+	return &Cacher{
+		log:       slog.New(slog.NewJSONHandler(io.Discard, nil)),
+		store:     store,
+		headstore: heads,
+	}, chain
+}
+
+// getLogs serves eth_getLogs for the range through the cacher, and returns the block numbers of the logs
+func getLogs(t *testing.T, cacher *Cacher, chain *config.Chain, remote jrpc.Handler, from, to hexutil.Uint64) []hexutil.Uint64 {
+	ctx := subctx.WithChain(context.Background(), chain)
+	r, err := jsonrpc.NewRequest(ctx, jsonrpc.NewNullIDPtr(), "eth_getLogs", []any{map[string]any{
+		"fromBlock": from,
+		"toBlock":   to,
+		"address":   "0x0000000000000000000000000000000000000001",
+	}})
+	require.NoError(t, err)
+	var icept jrpcutil.Interceptor
+	cacher.Middleware(remote).ServeRPC(&icept, r)
+	require.NoError(t, icept.Error)
+
+	raw, err := json.Marshal(icept.Result)
+	require.NoError(t, err)
+	var logs []struct {
+		BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	}
+	require.NoError(t, json.Unmarshal(raw, &logs))
+	var blocks []hexutil.Uint64
+	for _, log := range logs {
+		blocks = append(blocks, log.BlockNumber)
+	}
+	return blocks
+}
+
+func blockRange(start, end hexutil.Uint64) []hexutil.Uint64 {
+	var blocks []hexutil.Uint64
+	for i := start; i <= end; i++ {
+		blocks = append(blocks, i)
+	}
+	return blocks
+}
+
+func TestCacher_GetLogsPartialHit(t *testing.T) {
+	// blocks 10 to 14 and 40 are cached, the rest is fetched from the store in chunks
+	store := newTestLogStore(append(blockRange(10, 14), 40)...)
+	cacher, chain := newTestCacher(t, store, 100)
+	var remote testLogRemote
+
+	require.Equal(t, blockRange(10, 60), getLogs(t, cacher, chain, &remote, 10, 60))
+	require.Equal(t, append(blockRange(15, 39), blockRange(41, 60)...), store.fetchedBlocks())
+	require.Empty(t, remote.filters)
+}
+
+func TestCacher_GetLogsLongMissingRun(t *testing.T) {
+	// the run from 15 to 60 is longer than FilteredRun, so it is fetched with the filter of the caller
+	store := newTestLogStore(blockRange(10, 14)...)
+	cacher, chain := newTestCacher(t, store, 100)
+	var remote testLogRemote
+
+	require.Equal(t, blockRange(10, 60), getLogs(t, cacher, chain, &remote, 10, 60))
+	require.Empty(t, store.fetchedBlocks())
+	require.Len(t, remote.filters, 1)
+	require.JSONEq(t, `"0xf"`, string(remote.filters[0]["fromBlock"]))
+	require.JSONEq(t, `"0x3c"`, string(remote.filters[0]["toBlock"]))
+	require.JSONEq(t, `"0x0000000000000000000000000000000000000001"`, string(remote.filters[0]["address"]))
+}
+
+func TestCacher_GetLogsPastHead(t *testing.T) {
+	// a range past the head is left to the remote as a whole, rather than cut short at the head
+	store := newTestLogStore(blockRange(10, 20)...)
+	cacher, chain := newTestCacher(t, store, 15)
+	var remote testLogRemote
+
+	require.Equal(t, blockRange(10, 20), getLogs(t, cacher, chain, &remote, 10, 20))
+	require.Empty(t, store.fetchedBlocks())
+	require.Len(t, remote.filters, 1)
+	require.JSONEq(t, `"0xa"`, string(remote.filters[0]["fromBlock"]))
+	require.JSONEq(t, `"0x14"`, string(remote.filters[0]["toBlock"]))
+}
@@ -0,0 +1,143 @@
+package cacher
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"gfx.cafe/open/jrpc"
+	"github.com/bytedance/sonic"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/gfx-labs/venn/lib/config"
+	"github.com/gfx-labs/venn/lib/ethtypes"
+	"github.com/gfx-labs/venn/lib/jrpcutil"
+	"github.com/gfx-labs/venn/lib/stores/blockstore"
+)
+
+// stateBlockParams is the index of the block param of every cached state query
+var stateBlockParams = map[string]int{
+	"eth_call":         1,
+	"eth_getBalance":   1,
+	"eth_getCode":      1,
+	"eth_getStorageAt": 2,
+}
+
+// stateBlock returns the block a state query is made at. only block numbers and hashes qualify, since the state at a
+// tag such as latest or pending changes.
+func stateBlock(raw json.RawMessage) (blockstore.Query, bool) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return nil, false
+	}
+	switch raw[0] {
+	case '"':
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil || !strings.HasPrefix(s, "0x") {
+			return nil, false
+		}
+		if len(s) == 2+2*common.HashLength {
+			var hash common.Hash
+			if err := hash.UnmarshalText([]byte(s)); err != nil {
+				return nil, false
+			}
+			return blockstore.QueryHash(hash), true
+		}
+		number, err := hexutil.DecodeUint64(s)
+		if err != nil {
+			return nil, false
+		}
+		return blockstore.QueryNumber(hexutil.Uint64(number)), true
+	case '{':
+		var block ethtypes.BlockNumberOrHash
+		if err := json.Unmarshal(raw, &block); err != nil {
+			return nil, false
+		}
+		if hash, ok := block.Hash(); ok {
+			// the remote would fail the query if the block is no longer canonical, which the cache can not tell
+			if block.RequireCanonical {
+				return nil, false
+			}
+			return blockstore.QueryHash(hash), true
+		}
+		if number, ok := block.Number(); ok && number >= 0 {
+			return blockstore.QueryNumber(hexutil.Uint64(number)), true
+		}
+		return nil, false
+	default:
+		return nil, false
+	}
+}
+
+// stateKey returns the key of a state query, which is made up of the method and its params other than the block
+func stateKey(method string, params []json.RawMessage, blockParam int) (string, error) {
+	rest := make([]json.RawMessage, 0, len(params)-1)
+	rest = append(rest, params[:blockParam]...)
+	rest = append(rest, params[blockParam+1:]...)
+	raw, err := json.Marshal(rest)
+	if err != nil {
+		return "", err
+	}
+	canonical, err := jrpcutil.CanonicalJSON(raw)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return method + ":" + hex.EncodeToString(sum[:]), nil
+}
+
+// serveState serves a state query at a block number or hash from the cache. state at a block never changes, so results
+// are kept until the block is orphaned.
+func (T *Cacher) serveState(w jrpc.ResponseWriter, r *jrpc.Request, next jrpc.Handler, chain *config.Chain, blockParam int) {
+	state, ok := T.store.(blockstore.StateStore)
+	if !ok {
+		next.ServeRPC(w, r)
+		return
+	}
+
+	var params []json.RawMessage
+	if err := json.Unmarshal(r.Params, &params); err != nil || blockParam >= len(params) {
+		next.ServeRPC(w, r)
+		return
+	}
+	block, ok := stateBlock(params[blockParam])
+	if !ok {
+		next.ServeRPC(w, r)
+		return
+	}
+	if q, ok := block.(blockstore.QueryRange); ok {
+		// blocks past the head may be orphaned before a reorg covering them could be seen
+		head, err := T.headstore.Get(r.Context(), chain)
+		if err != nil || head == 0 || q.Start > head {
+			next.ServeRPC(w, r)
+			return
+		}
+	}
+	key, err := stateKey(r.Method, params, blockParam)
+	if err != nil {
+		next.ServeRPC(w, r)
+		return
+	}
+
+	if value, err := state.GetState(r.Context(), chain, block, key); err == nil {
+		_ = w.Send(value, nil)
+		return
+	}
+
+	seq := T.reorgs.Seq(chain)
+	var icept jrpcutil.Interceptor
+	next.ServeRPC(&icept, r)
+	// results fetched while a reorg was being handled may be from an orphaned block
+	if icept.Error == nil && T.reorgs.Seq(chain) == seq {
+		value, err := sonic.Marshal(icept.Result)
+		if err == nil && !bytes.Equal(value, []byte("null")) {
+			if err := state.PutState(r.Context(), chain, block, key, value); err != nil {
+				T.log.Warn("failed to cache state", "chain", chain.Name, "method", r.Method, "error", err)
+			}
+		}
+	}
+	_ = w.Send(icept.Result, icept.Error)
+}
@@ -0,0 +1,207 @@
+package cacher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+
+	"gfx.cafe/open/jrpc"
+	"gfx.cafe/open/jrpc/pkg/jsonrpc"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/go-faster/jx"
+
+	"github.com/gfx-labs/venn/lib/config"
+	"github.com/gfx-labs/venn/lib/ethtypes"
+	"github.com/gfx-labs/venn/lib/stores/blockstore"
+)
+
+var errTxNotCached = errors.New("transaction not cached")
+
+// arrayItem returns the raw item at index of the array d is at. it returns false if the array is shorter or null.
+func arrayItem(d *jx.Decoder, index int) (json.RawMessage, bool, error) {
+	if d.Next() == jx.Null {
+		return nil, false, nil
+	}
+	arr, err := d.ArrIter()
+	if err != nil {
+		return nil, false, err
+	}
+	for i := 0; arr.Next(); i++ {
+		if i != index {
+			if err := d.Skip(); err != nil {
+				return nil, false, err
+			}
+			continue
+		}
+		raw, err := d.Raw()
+		if err != nil {
+			return nil, false, err
+		}
+		return json.RawMessage(raw), true, nil
+	}
+	return nil, false, arr.Err()
+}
+
+// blockTransaction returns the transaction at index of the block. it returns false if the block is null or has fewer
+// transactions, and an error if the block only holds transaction hashes.
+func blockTransaction(block json.RawMessage, index int) (json.RawMessage, bool, error) {
+	d := jx.DecodeBytes(block)
+	if d.Next() == jx.Null {
+		return nil, false, nil
+	}
+	fields, err := d.ObjIter()
+	if err != nil {
+		return nil, false, err
+	}
+	for fields.Next() {
+		if !bytes.Equal(fields.Key(), []byte("transactions")) {
+			if err := d.Skip(); err != nil {
+				return nil, false, err
+			}
+			continue
+		}
+		tx, ok, err := arrayItem(d, index)
+		if err != nil || !ok {
+			return nil, ok, err
+		}
+		if len(tx) == 0 || tx[0] != '{' {
+			return nil, false, errTxNotCached
+		}
+		return tx, true, nil
+	}
+	return nil, false, fields.Err()
+}
+
+// cachedTx returns the receipt or transaction of the hash from the cached entries of its block, without fetching
+// anything from the remotes
+func (T *Cacher) cachedTx(ctx context.Context, chain *config.Chain, typ blockstore.EntryType, hash common.Hash) (json.RawMessage, error) {
+	index, ok := T.store.(blockstore.TxIndex)
+	if !ok {
+		return nil, errTxNotCached
+	}
+	partial, ok := T.store.(blockstore.PartialStore)
+	if !ok {
+		return nil, errTxNotCached
+	}
+	location, err := index.GetTx(ctx, chain, hash)
+	if err != nil {
+		return nil, errTxNotCached
+	}
+
+	// entries by number are invalidated on reorg, so a block which is still held by number is still canonical
+	entries, err := partial.GetPartial(ctx, chain, typ, blockstore.QueryNumber(location.BlockNumber))
+	if err != nil || len(entries) != 1 || entries[0].BlockHash != location.BlockHash {
+		return nil, errTxNotCached
+	}
+
+	var raw json.RawMessage
+	var found bool
+	var field string
+	switch typ {
+	case blockstore.EntryReceipts:
+		raw, found, err = arrayItem(jx.DecodeBytes(entries[0].Value), location.Index)
+		field = "transactionHash"
+	default:
+		raw, found, err = blockTransaction(entries[0].Value, location.Index)
+		field = "hash"
+	}
+	if err != nil || !found {
+		return nil, errTxNotCached
+	}
+
+	// make sure the index was not pointing at a stale entry
+	var check map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &check); err != nil {
+		return nil, errTxNotCached
+	}
+	var got common.Hash
+	if err := json.Unmarshal(check[field], &got); err != nil || got != hash {
+		return nil, errTxNotCached
+	}
+	return raw, nil
+}
+
+// serveTxByHash serves eth_getTransactionReceipt and eth_getTransactionByHash from the cache when the block of the
+// transaction is held
+func (T *Cacher) serveTxByHash(w jrpc.ResponseWriter, r *jrpc.Request, next jrpc.Handler, chain *config.Chain, typ blockstore.EntryType) {
+	var params []common.Hash
+	if err := json.Unmarshal(r.Params, &params); err != nil || len(params) != 1 {
+		next.ServeRPC(w, r)
+		return
+	}
+
+	raw, err := T.cachedTx(r.Context(), chain, typ, params[0])
+	if err != nil {
+		next.ServeRPC(w, r)
+		return
+	}
+	_ = w.Send(raw, nil)
+}
+
+// serveTxByBlock serves eth_getTransactionByBlockHashAndIndex and eth_getTransactionByBlockNumberAndIndex from the
+// block in the store
+func (T *Cacher) serveTxByBlock(w jrpc.ResponseWriter, r *jrpc.Request, next jrpc.Handler, chain *config.Chain) {
+	var params []json.RawMessage
+	if err := json.Unmarshal(r.Params, &params); err != nil {
+		_ = w.Send(nil, err)
+		return
+	}
+	if len(params) != 2 {
+		_ = w.Send(nil, jsonrpc.NewInvalidParamsError("expected 2 params"))
+		return
+	}
+
+	var index hexutil.Uint
+	if err := json.Unmarshal(params[1], &index); err != nil {
+		_ = w.Send(nil, jsonrpc.NewInvalidParamsError(err.Error()))
+		return
+	}
+
+	var query blockstore.Query
+	switch r.Method {
+	case "eth_getTransactionByBlockHashAndIndex":
+		var blockHash common.Hash
+		if err := json.Unmarshal(params[0], &blockHash); err != nil {
+			_ = w.Send(nil, jsonrpc.NewInvalidParamsError(err.Error()))
+			return
+		}
+		query = blockstore.QueryHash(blockHash)
+	default:
+		var blockNumber ethtypes.BlockNumber
+		if err := json.Unmarshal(params[0], &blockNumber); err != nil {
+			_ = w.Send(nil, jsonrpc.NewInvalidParamsError(err.Error()))
+			return
+		}
+		// tags which were not replaced by a number can not be looked up
+		if blockNumber < 0 {
+			next.ServeRPC(w, r)
+			return
+		}
+		// blocks past the head do not exist yet
+		head, err := T.headstore.Get(r.Context(), chain)
+		if err != nil || head == 0 || hexutil.Uint64(blockNumber) > head {
+			next.ServeRPC(w, r)
+			return
+		}
+		query = blockstore.QueryNumber(hexutil.Uint64(blockNumber))
+	}
+
+	entries, err := T.store.Get(r.Context(), chain, blockstore.EntryBlockHeader, query)
+	if err != nil || len(entries) != 1 {
+		next.ServeRPC(w, r)
+		return
+	}
+
+	tx, ok, err := blockTransaction(entries[0].Value, int(index))
+	if err != nil {
+		next.ServeRPC(w, r)
+		return
+	}
+	if !ok {
+		_ = w.Send(nil, nil)
+		return
+	}
+	_ = w.Send(tx, nil)
+}
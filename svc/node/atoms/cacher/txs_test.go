@@ -0,0 +1,75 @@
+package cacher
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/go-faster/jx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArrayItem(t *testing.T) {
+	cases := []struct {
+		name  string
+		array string
+		index int
+		want  string
+		found bool
+		err   bool
+	}{
+		{name: "first", array: `[{"a":1},{"b":2}]`, index: 0, want: `{"a":1}`, found: true},
+		{name: "last", array: `[{"a":1},{"b":2}]`, index: 1, want: `{"b":2}`, found: true},
+		{name: "out of range", array: `[{"a":1},{"b":2}]`, index: 2},
+		{name: "empty", array: `[]`, index: 0},
+		{name: "null", array: `null`, index: 0},
+		{name: "not an array", array: `{}`, index: 0, err: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, found, err := arrayItem(jx.DecodeStr(c.array), c.index)
+			if c.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.found, found)
+			if c.found {
+				require.JSONEq(t, c.want, string(got))
+			}
+		})
+	}
+}
+
+func TestBlockTransaction(t *testing.T) {
+	full := `{"number":"0x1","transactions":[{"hash":"0x01","transactionIndex":"0x0"},{"hash":"0x02","transactionIndex":"0x1"}],"uncles":[]}`
+	hashes := `{"number":"0x1","transactions":["0x01","0x02"]}`
+	cases := []struct {
+		name  string
+		block string
+		index int
+		want  string
+		found bool
+		err   error
+	}{
+		{name: "full", block: full, index: 1, want: `{"hash":"0x02","transactionIndex":"0x1"}`, found: true},
+		{name: "full out of range", block: full, index: 2},
+		{name: "hashes only", block: hashes, index: 0, err: errTxNotCached},
+		{name: "hashes only out of range", block: hashes, index: 5},
+		{name: "no transactions field", block: `{"number":"0x1"}`, index: 0},
+		{name: "null", block: `null`, index: 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, found, err := blockTransaction(json.RawMessage(c.block), c.index)
+			if c.err != nil {
+				require.ErrorIs(t, err, c.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.found, found)
+			if c.found {
+				require.JSONEq(t, c.want, string(got))
+			}
+		})
+	}
+}
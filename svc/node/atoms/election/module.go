@@ -10,6 +10,7 @@ import (
 
 	"github.com/gfx-labs/venn/lib/config"
 	"github.com/gfx-labs/venn/lib/election"
+	"github.com/gfx-labs/venn/svc/shared/services/gnat"
 	"github.com/gfx-labs/venn/svc/shared/services/redi"
 )
 
@@ -30,7 +31,9 @@ type Params struct {
 
 	Log   *slog.Logger
 	Lc    fx.Lifecycle
-	Redis *redi.Redis `optional:"true"`
+	Redis *redi.Redis  `optional:"true"`
+	Nats  *config.Nats `optional:"true"`
+	Gnat  *gnat.Gnat   `optional:"true"`
 	Ctx   context.Context
 }
 type Result struct {
@@ -60,6 +63,18 @@ func New(p Params) (o Result, err error) {
 			p.Redis.C(),
 			logger,
 		)
+	case "nats", "natskv":
+		if p.Gnat == nil {
+			return o, errors.New("nats election strategy requires nats")
+		}
+		o.Election.strategy, err = election.NewNatsKVStrategy(
+			p.Nats.Namespace,
+			p.Gnat.Conn(),
+			logger,
+		)
+		if err != nil {
+			return o, err
+		}
 	case "alwaysleader":
 		o.Election.strategy = &election.AlwaysLeader{}
 	default:
@@ -84,9 +99,34 @@ func (p *Election) RunWithLease(
 	log *slog.Logger,
 	leaderFunc func(ctx context.Context),
 	followerFunc func(ctx context.Context),
+) {
+	p.runWithLease(ctx, log, p.strategy.AcquireLease, leaderFunc, followerFunc)
+}
+
+// RunWithShardLease is RunWithLease for a single shard of the work. every shard fails over on its own, and the shards
+// are spread across the members of the election.
+func (p *Election) RunWithShardLease(
+	ctx context.Context,
+	log *slog.Logger,
+	shard string,
+	leaderFunc func(ctx context.Context),
+	followerFunc func(ctx context.Context),
+) {
+	acquire := func(ctx context.Context) <-chan context.Context {
+		return p.strategy.AcquireShardLease(ctx, shard)
+	}
+	p.runWithLease(ctx, log.With("shard", shard), acquire, leaderFunc, followerFunc)
+}
+
+func (p *Election) runWithLease(
+	ctx context.Context,
+	log *slog.Logger,
+	acquire func(ctx context.Context) <-chan context.Context,
+	leaderFunc func(ctx context.Context),
+	followerFunc func(ctx context.Context),
 ) {
 	for {
-		leaseCh := p.strategy.AcquireLease(ctx)
+		leaseCh := acquire(ctx)
 		var lctx context.Context
 		select {
 		case <-ctx.Done():
@@ -140,3 +180,18 @@ func (p *Election) IsLeader() bool {
 func (p *Election) AcquireLease(ctx context.Context) <-chan context.Context {
 	return p.strategy.AcquireLease(ctx)
 }
+
+// Fence returns the fencing token of the lease ctx was handed out for, if the strategy has them
+func (p *Election) Fence(ctx context.Context) (uint64, bool) {
+	return election.Fence(ctx)
+}
+
+// Owners returns the member holding the lease of each of the shards
+func (p *Election) Owners(ctx context.Context, shards []string) (map[string]string, error) {
+	return p.strategy.Owners(ctx, shards)
+}
+
+// ID returns the name of this member, as returned by Owners
+func (p *Election) ID() string {
+	return p.strategy.ID()
+}
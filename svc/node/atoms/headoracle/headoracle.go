@@ -0,0 +1,200 @@
+package headoracle
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"go.uber.org/fx"
+
+	"github.com/gfx-labs/venn/lib/config"
+	"github.com/gfx-labs/venn/lib/jrpcutil"
+	"github.com/gfx-labs/venn/lib/oracles"
+	"github.com/gfx-labs/venn/lib/oracles/blockoracle"
+	"github.com/gfx-labs/venn/lib/subctx"
+	"github.com/gfx-labs/venn/svc/node/quarks/cluster"
+	"github.com/gfx-labs/venn/svc/shared/services/prom"
+)
+
+// HeadOracle periodically asks the configured head oracles of each chain for the chain head, and compares every
+// remote against the consensus so that remotes which fall behind can be deprioritized.
+type HeadOracle struct {
+	log      *slog.Logger
+	clusters *cluster.Clusters
+
+	chains map[string]*chainOracle
+}
+
+type chainOracle struct {
+	chain  *config.Chain
+	oracle blockoracle.BlockOracle
+
+	head    hexutil.Uint64
+	updated time.Time
+	mu      sync.RWMutex
+}
+
+type Params struct {
+	fx.In
+
+	Ctx      context.Context
+	Log      *slog.Logger
+	Lc       fx.Lifecycle
+	Chains   map[string]*config.Chain
+	Clusters *cluster.Clusters
+}
+
+type Result struct {
+	fx.Out
+
+	HeadOracle *HeadOracle
+}
+
+func New(p Params) (r Result, err error) {
+	h := &HeadOracle{
+		log:      p.Log.With("module", "headoracle"),
+		clusters: p.Clusters,
+		chains:   make(map[string]*chainOracle),
+	}
+	r.HeadOracle = h
+
+	for _, chain := range p.Chains {
+		if len(chain.HeadOracles) == 0 {
+			continue
+		}
+		sources := make([]blockoracle.BlockOracle, 0, len(chain.HeadOracles))
+		for _, o := range chain.HeadOracles {
+			source, err := blockoracle.HttpJsonOracle(string(o.Url), o.CelExpr)
+			if err != nil {
+				return r, fmt.Errorf("chain %s: head oracle %s: %w", chain.Name, o.Url, err)
+			}
+			// the cel evaluation context is shared between calls, so each source must be serialized
+			sources = append(sources, oracles.TimeoutOracle(oracles.MutexOracle(source), 10*time.Second))
+		}
+
+		var consensus blockoracle.BlockOracle
+		switch chain.HeadOracleStrategy {
+		case config.HeadOracleStrategyMedian:
+			consensus = oracles.MedianOracle(sources)
+		default:
+			consensus = oracles.MaxTrimOracle(sources)
+		}
+
+		h.chains[chain.Name] = &chainOracle{
+			chain:  chain,
+			oracle: oracles.SingleFlightOracle(consensus),
+		}
+	}
+
+	p.Lc.Append(fx.Hook{
+		OnStart: func(_ context.Context) error {
+			for _, co := range h.chains {
+				go h.run(p.Ctx, co)
+			}
+			return nil
+		},
+	})
+	return
+}
+
+// Consensus returns the latest head reported by the oracles of the chain, and when it was observed.
+// ok is false if the chain has no oracles or they have not reported yet.
+func (T *HeadOracle) Consensus(chain string) (head hexutil.Uint64, updated time.Time, ok bool) {
+	co, exists := T.chains[chain]
+	if !exists {
+		return 0, time.Time{}, false
+	}
+	co.mu.RLock()
+	defer co.mu.RUnlock()
+	return co.head, co.updated, co.head > 0
+}
+
+func (T *HeadOracle) run(ctx context.Context, co *chainOracle) {
+	ticker := time.NewTicker(co.chain.HeadOracleInterval.Duration)
+	defer ticker.Stop()
+
+	for {
+		T.tick(ctx, co)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (T *HeadOracle) tick(ctx context.Context, co *chainOracle) {
+	chain := co.chain
+	label := prom.HeadOracleLabel{
+		Chain: chain.Name,
+	}
+
+	head, err := co.oracle.Report(ctx)
+	if err != nil {
+		prom.HeadOracle.Failures(label).Inc()
+		T.log.Warn("failed to query head oracles", "chain", chain.Name, "error", err)
+		return
+	}
+
+	co.mu.Lock()
+	co.head = hexutil.Uint64(head)
+	co.updated = time.Now()
+	co.mu.Unlock()
+	prom.HeadOracle.Consensus(label).Set(float64(head))
+
+	T.compareRemotes(ctx, chain, hexutil.Uint64(head))
+}
+
+// remoteHeadTimeout is how long a remote has to answer for its head, before it is checked with the head it had
+const remoteHeadTimeout = 5 * time.Second
+
+// compareRemotes refreshes the head of every remote on the chain and checks it against the consensus
+func (T *HeadOracle) compareRemotes(ctx context.Context, chain *config.Chain, consensus hexutil.Uint64) {
+	cl, ok := T.clusters.Remotes[chain.Name]
+	if !ok {
+		return
+	}
+	targets := T.clusters.GetMiddlewares()[chain.Name]
+
+	ctx = subctx.WithChain(ctx, chain)
+	for _, remote := range cl.Remotes() {
+		target, ok := targets[remote.Config.Name]
+		if !ok || target.Validator == nil {
+			continue
+		}
+
+		wasBehind := target.Validator.IsBehind()
+
+		// the validator records the head of the remote as the request passes through it
+		// a hung remote must not hold back the check of the others
+		rctx, cancel := context.WithTimeout(ctx, remoteHeadTimeout)
+		var blockNumber hexutil.Uint64
+		if err := jrpcutil.Do(rctx, remote.Handler, &blockNumber, "eth_blockNumber", []any{}); err != nil {
+			T.log.Debug("failed to refresh remote head", "chain", chain.Name, "remote", remote.Config.Name, "error", err)
+		}
+		cancel()
+
+		lag, behind := target.Validator.SetConsensus(consensus)
+
+		remoteLabel := prom.RemoteHealthLabel{
+			Chain:  chain.Name,
+			Remote: remote.Config.Name,
+		}
+		prom.HeadOracle.RemoteLag(remoteLabel).Set(float64(lag))
+		if behind {
+			prom.HeadOracle.RemoteBehind(remoteLabel).Set(1)
+		} else {
+			prom.HeadOracle.RemoteBehind(remoteLabel).Set(0)
+		}
+
+		switch {
+		case behind && !wasBehind:
+			T.log.Warn("remote fell behind head oracle consensus", "chain", chain.Name, "remote", remote.Config.Name, "consensus", consensus, "lag", lag)
+		case !behind && wasBehind:
+			T.log.Info("remote caught up to head oracle consensus", "chain", chain.Name, "remote", remote.Config.Name, "consensus", consensus, "lag", lag)
+		}
+	}
+}
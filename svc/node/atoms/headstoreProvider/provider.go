@@ -2,6 +2,7 @@ package headstoreProvider
 
 import (
 	"github.com/gfx-labs/venn/lib/stores/headstore"
+	"github.com/gfx-labs/venn/svc/node/stores/headstores/natshead"
 	"github.com/gfx-labs/venn/svc/node/stores/headstores/redihead"
 	"go.uber.org/fx"
 )
@@ -10,6 +11,7 @@ type Params struct {
 	fx.In
 
 	Redihead *redihead.Redihead `optional:"true"`
+	Natshead *natshead.Natshead `optional:"true"`
 }
 
 type Result struct {
@@ -20,7 +22,10 @@ type Result struct {
 
 // New creates a headstore instance that can be used by both vennstore and cluster
 func New(p Params) (r Result, err error) {
-	if p.Redihead != nil {
+	// natshead is only there when it was selected over redis
+	if p.Natshead != nil {
+		r.Headstore = p.Natshead
+	} else if p.Redihead != nil {
 		r.Headstore = p.Redihead
 	} else {
 		r.Headstore = headstore.NewAtomic()
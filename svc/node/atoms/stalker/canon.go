@@ -0,0 +1,65 @@
+package stalker
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// canonDepth is the number of recent blocks whose hashes are remembered. reorgs deeper than this are only detected down
+// to the oldest remembered block.
+const canonDepth = 256
+
+type blockRef struct {
+	Number     hexutil.Uint64 `json:"number"`
+	Hash       common.Hash    `json:"hash"`
+	ParentHash common.Hash    `json:"parentHash"`
+}
+
+// canonChain holds the hashes of the most recent blocks of the canonical chain, without gaps, in order of block number
+type canonChain struct {
+	blocks []blockRef
+}
+
+func (c *canonChain) empty() bool {
+	return len(c.blocks) == 0
+}
+
+// tail returns the number of the oldest remembered block
+func (c *canonChain) tail() hexutil.Uint64 {
+	return c.blocks[0].Number
+}
+
+// head returns the number of the newest remembered block
+func (c *canonChain) head() hexutil.Uint64 {
+	return c.blocks[len(c.blocks)-1].Number
+}
+
+func (c *canonChain) get(number hexutil.Uint64) (common.Hash, bool) {
+	if c.empty() || number < c.tail() || number > c.head() {
+		return common.Hash{}, false
+	}
+	return c.blocks[number-c.tail()].Hash, true
+}
+
+// rewind forgets every block after number
+func (c *canonChain) rewind(number hexutil.Uint64) {
+	if c.empty() || number >= c.head() {
+		return
+	}
+	if number < c.tail() {
+		c.blocks = c.blocks[:0]
+		return
+	}
+	c.blocks = c.blocks[:number-c.tail()+1]
+}
+
+// push adds the block after the current head, or starts over if it does not follow it
+func (c *canonChain) push(block blockRef) {
+	if !c.empty() && block.Number != c.head()+1 {
+		c.blocks = c.blocks[:0]
+	}
+	c.blocks = append(c.blocks, block)
+	if len(c.blocks) > canonDepth {
+		c.blocks = append(c.blocks[:0], c.blocks[len(c.blocks)-canonDepth:]...)
+	}
+}
@@ -0,0 +1,255 @@
+package stalker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+
+	"gfx.cafe/open/jrpc"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gfx-labs/venn/lib/callcenter"
+	"github.com/gfx-labs/venn/lib/config"
+	"github.com/gfx-labs/venn/lib/stores/blockstore"
+	"github.com/gfx-labs/venn/lib/stores/headstore"
+	"github.com/gfx-labs/venn/svc/node/atoms/vennstore"
+)
+
+// testBlocks returns the blocks from start to end of a chain which forks off of parent. the fork tells apart the
+// hashes of different chains
+func testBlocks(parent common.Hash, start, end hexutil.Uint64, fork byte) []blockRef {
+	var blocks []blockRef
+	for i := start; i <= end; i++ {
+		hash := common.Hash{fork}
+		hash[31] = byte(i)
+		blocks = append(blocks, blockRef{
+			Number:     i,
+			Hash:       hash,
+			ParentHash: parent,
+		})
+		parent = hash
+	}
+	return blocks
+}
+
+func testCanon(blocks []blockRef) *canonChain {
+	var canon canonChain
+	for _, block := range blocks {
+		canon.push(block)
+	}
+	return &canon
+}
+
+func TestCanonChain(t *testing.T) {
+	blocks := testBlocks(common.Hash{}, 10, 20, 1)
+	canon := testCanon(blocks)
+	require.Equal(t, hexutil.Uint64(10), canon.tail())
+	require.Equal(t, hexutil.Uint64(20), canon.head())
+	for _, block := range blocks {
+		hash, ok := canon.get(block.Number)
+		require.True(t, ok)
+		require.Equal(t, block.Hash, hash)
+	}
+	_, ok := canon.get(9)
+	require.False(t, ok)
+	_, ok = canon.get(21)
+	require.False(t, ok)
+
+	// rewinding to the fork keeps the blocks up to it, and the fork is pushed on top
+	canon.rewind(15)
+	require.Equal(t, hexutil.Uint64(15), canon.head())
+	fork := testBlocks(blocks[5].Hash, 16, 22, 2)
+	for _, block := range fork {
+		canon.push(block)
+	}
+	require.Equal(t, hexutil.Uint64(10), canon.tail())
+	require.Equal(t, hexutil.Uint64(22), canon.head())
+	hash, _ := canon.get(15)
+	require.Equal(t, blocks[5].Hash, hash)
+	hash, _ = canon.get(16)
+	require.Equal(t, fork[0].Hash, hash)
+
+	// rewinding past the head does nothing
+	canon.rewind(30)
+	require.Equal(t, hexutil.Uint64(22), canon.head())
+
+	// rewinding past the tail forgets everything
+	canon.rewind(5)
+	require.True(t, canon.empty())
+}
+
+func TestCanonChain_PushGap(t *testing.T) {
+	canon := testCanon(testBlocks(common.Hash{}, 10, 20, 1))
+
+	// a block which does not follow the head starts the chain over
+	canon.push(blockRef{Number: 30})
+	require.Equal(t, hexutil.Uint64(30), canon.tail())
+	require.Equal(t, hexutil.Uint64(30), canon.head())
+}
+
+func TestCanonChain_Depth(t *testing.T) {
+	canon := testCanon(testBlocks(common.Hash{}, 0, canonDepth+9, 1))
+	require.Len(t, canon.blocks, canonDepth)
+	require.Equal(t, hexutil.Uint64(10), canon.tail())
+	require.Equal(t, hexutil.Uint64(canonDepth+9), canon.head())
+}
+
+// newTestTrack returns a stalker, and a cluster which serves the blocks by number
+func newTestTrack(t *testing.T, blocks []blockRef) (*Stalker, *callcenter.Cluster) {
+	byNumber := make(map[hexutil.Uint64]blockRef, len(blocks))
+	for _, block := range blocks {
+		byNumber[block.Number] = block
+	}
+	cluster := callcenter.NewCluster(nil, nil)
+	cluster.Add(0, callcenter.NewRemoteWithConfig(jrpc.HandlerFunc(func(w jrpc.ResponseWriter, r *jrpc.Request) {
+		var params []json.RawMessage
+		require.NoError(t, json.Unmarshal(r.Params, &params))
+		var number hexutil.Uint64
+		require.NoError(t, json.Unmarshal(params[0], &number))
+		block, ok := byNumber[number]
+		if !ok {
+			_ = w.Send(nil, nil)
+			return
+		}
+		_ = w.Send(block, nil)
+	}), &config.Remote{}))
+	log := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	head := headstore.NewAtomic()
+	lru := blockstore.NewLruStore(16)
+	return &Stalker{
+		log:       log,
+		headstore: head,
+		blocks:    lru,
+		reorgs:    vennstore.NewReorgs(log, head, lru, lru),
+	}, cluster
+}
+
+func TestStalker_TrackFork(t *testing.T) {
+	chain := &config.Chain{Name: "test"}
+	main := testBlocks(common.Hash{}, 1, 10, 1)
+	// the fork branches off after block 7, and replaces blocks 8 to 10
+	fork := testBlocks(main[6].Hash, 8, 11, 2)
+	s, cluster := newTestTrack(t, append(main[:7:7], fork...))
+	reorgs, done := s.headstore.OnReorg(chain)
+	defer done()
+
+	for _, block := range main {
+		require.NoError(t, s.blocks.Put(context.Background(), chain, blockstore.EntryBlockHeader, &blockstore.Entry{
+			BlockHash:   block.Hash,
+			BlockNumber: block.Number,
+			Value:       []byte(`{}`),
+		}))
+	}
+
+	canon := testCanon(main)
+	require.NoError(t, s.track(context.Background(), chain, cluster, canon, fork[3]))
+
+	// the orphaned blocks are gone by the time the head may be published
+	for _, block := range main {
+		_, err := s.blocks.Get(context.Background(), chain, blockstore.EntryBlockHeader, blockstore.QueryNumber(block.Number))
+		if block.Number > 7 {
+			require.Error(t, err, block.Number)
+		} else {
+			require.NoError(t, err, block.Number)
+		}
+	}
+
+	select {
+	case reorg := <-reorgs:
+		require.Equal(t, headstore.Reorg{
+			Start:    8,
+			End:      10,
+			Orphaned: []common.Hash{main[7].Hash, main[8].Hash, main[9].Hash},
+			Head:     11,
+		}, reorg)
+	default:
+		t.Fatal("no reorg was published")
+	}
+
+	// the canonical chain follows the fork
+	require.Equal(t, hexutil.Uint64(1), canon.tail())
+	require.Equal(t, hexutil.Uint64(11), canon.head())
+	for _, block := range append(main[:7:7], fork...) {
+		hash, _ := canon.get(block.Number)
+		require.Equal(t, block.Hash, hash, block.Number)
+	}
+}
+
+func TestStalker_TrackExtends(t *testing.T) {
+	chain := &config.Chain{Name: "test"}
+	blocks := testBlocks(common.Hash{}, 1, 12, 1)
+	s, cluster := newTestTrack(t, blocks)
+	reorgs, done := s.headstore.OnReorg(chain)
+	defer done()
+
+	// the head skipped block 11, which is fetched to connect it to the chain
+	canon := testCanon(blocks[:10])
+	require.NoError(t, s.track(context.Background(), chain, cluster, canon, blocks[11]))
+	require.Equal(t, hexutil.Uint64(12), canon.head())
+	hash, _ := canon.get(11)
+	require.Equal(t, blocks[10].Hash, hash)
+
+	// the same head again, or an older one, changes nothing
+	require.NoError(t, s.track(context.Background(), chain, cluster, canon, blocks[11]))
+	require.NoError(t, s.track(context.Background(), chain, cluster, canon, blocks[5]))
+	require.Equal(t, hexutil.Uint64(12), canon.head())
+
+	select {
+	case reorg := <-reorgs:
+		t.Fatalf("unexpected reorg %v", reorg)
+	default:
+	}
+}
+
+func TestStalker_TrackPastFinalized(t *testing.T) {
+	chain := &config.Chain{Name: "test"}
+	main := testBlocks(common.Hash{}, 1, 10, 1)
+	fork := testBlocks(main[2].Hash, 4, 11, 2)
+	s, cluster := newTestTrack(t, append(main[:3:3], fork...))
+	require.NoError(t, s.headstore.PutFinality(context.Background(), chain, 0, 6))
+	reorgs, done := s.headstore.OnReorg(chain)
+	defer done()
+
+	// a fork before the finalized block is not followed, and the chain starts over from the head
+	canon := testCanon(main)
+	require.NoError(t, s.track(context.Background(), chain, cluster, canon, fork[7]))
+	require.Equal(t, hexutil.Uint64(11), canon.tail())
+	require.Equal(t, hexutil.Uint64(11), canon.head())
+
+	select {
+	case reorg := <-reorgs:
+		t.Fatalf("unexpected reorg %v", reorg)
+	default:
+	}
+}
+
+func TestStalker_TrackStaleFork(t *testing.T) {
+	chain := &config.Chain{Name: "test"}
+	main := testBlocks(common.Hash{}, 1, 10, 1)
+	// a remote which is behind, and still on a fork which was orphaned after block 6
+	stale := testBlocks(main[5].Hash, 7, 8, 2)
+	s, cluster := newTestTrack(t, append(main[:6:6], stale...))
+	reorgs, done := s.headstore.OnReorg(chain)
+	defer done()
+
+	canon := testCanon(main)
+	for range 3 {
+		require.NoError(t, s.track(context.Background(), chain, cluster, canon, stale[1]))
+	}
+
+	// the canonical chain is left as it was
+	require.Equal(t, hexutil.Uint64(10), canon.head())
+	for _, block := range main {
+		hash, _ := canon.get(block.Number)
+		require.Equal(t, block.Hash, hash, block.Number)
+	}
+	select {
+	case reorg := <-reorgs:
+		t.Fatalf("unexpected reorg %v", reorg)
+	default:
+	}
+}
@@ -0,0 +1,90 @@
+package stalker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"go.uber.org/multierr"
+
+	"github.com/gfx-labs/venn/lib/callcenter"
+	"github.com/gfx-labs/venn/lib/config"
+	"github.com/gfx-labs/venn/lib/jrpcutil"
+	"github.com/gfx-labs/venn/lib/subctx"
+	"github.com/gfx-labs/venn/svc/shared/services/prom"
+)
+
+// finalityBlocks is the number of blocks between polls of the safe and finalized heads. they move much slower than the
+// latest head, so there is no need to poll them as often.
+const finalityBlocks = 4
+
+// stalkFinality polls the safe and finalized heads of the chain
+func (T *Stalker) stalkFinality(ctx context.Context, chain *config.Chain, cluster *callcenter.Cluster) {
+	// set the chain context for the requests
+	ctx = subctx.WithChain(ctx, chain)
+	interval := max(time.Duration(chain.BlockTimeSeconds*float64(time.Second))*finalityBlocks, 2*time.Second)
+	for {
+		if err := T.tickFinality(ctx, chain, cluster); err != nil {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+			// chains without finality fail every time, so this is not worth more than a debug log
+			T.log.Debug("failed to get safe and finalized heads", "chain", chain.Name, "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (T *Stalker) tickFinality(ctx context.Context, chain *config.Chain, cluster *callcenter.Cluster) error {
+	var merr error
+	safe, err := T.getTag(ctx, cluster, "safe")
+	if err != nil {
+		merr = multierr.Append(merr, err)
+	}
+	finalized, err := T.getTag(ctx, cluster, "finalized")
+	if err != nil {
+		merr = multierr.Append(merr, err)
+	}
+
+	heads, err := T.headstore.GetHeads(ctx, chain)
+	if err != nil {
+		return multierr.Append(merr, err)
+	}
+	// only publish heads which moved forward
+	if safe <= heads.Safe && finalized <= heads.Finalized {
+		return merr
+	}
+	if err := T.headstore.PutFinality(ctx, chain, safe, finalized); err != nil {
+		return multierr.Append(merr, err)
+	}
+
+	stalkerLabel := prom.StalkerLabel{
+		Chain: chain.Name,
+	}
+	if safe > 0 {
+		prom.Stalker.SafeBlock(stalkerLabel).Set(float64(safe))
+	}
+	if finalized > 0 {
+		prom.Stalker.FinalizedBlock(stalkerLabel).Set(float64(finalized))
+	}
+	return merr
+}
+
+// getTag returns the number of the block with the tag, or zero if there is none
+func (T *Stalker) getTag(ctx context.Context, cluster *callcenter.Cluster, tag string) (hexutil.Uint64, error) {
+	var block *blockRef
+	if err := jrpcutil.Do(ctx, cluster, &block, "eth_getBlockByNumber", []any{tag, false}); err != nil {
+		return 0, fmt.Errorf("get %s block: %w", tag, err)
+	}
+	if block == nil {
+		return 0, nil
+	}
+	return block.Number, nil
+}
@@ -0,0 +1,87 @@
+package stalker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/gfx-labs/venn/lib/config"
+	"github.com/gfx-labs/venn/lib/stores/blockstore"
+)
+
+const (
+	// prefetchDepth is the most blocks prefetched at once, when the head moved by more than one block
+	prefetchDepth = 8
+	// prefetchTimeout is the longest the head waits for the prefetch before it is published anyway, so that a slow
+	// remote does not hold back the head. the blocks which were not prefetched in time are fetched when asked for
+	prefetchTimeout = 500 * time.Millisecond
+)
+
+// prefetchTypes returns the entry types configured to be prefetched for the chain
+func prefetchTypes(chain *config.Chain) []blockstore.EntryType {
+	cfg := chain.Prefetch
+	if cfg == nil {
+		return nil
+	}
+	// forged receipts are built from the block and logs, so those are what needs to be cached
+	forge := cfg.Receipts && chain.ForgeBlockReceipts
+
+	var types []blockstore.EntryType
+	if cfg.Blocks || forge {
+		types = append(types, blockstore.EntryBlockHeader)
+	}
+	if cfg.Receipts && !chain.ForgeBlockReceipts {
+		types = append(types, blockstore.EntryReceipts)
+	}
+	if cfg.Logs || forge {
+		types = append(types, blockstore.EntryLogs)
+	}
+	return types
+}
+
+// prefetch gets the entries of the blocks in the range through the store, which puts them in every cache on the way.
+// entries which do not match the canonical chain were served by a remote which is on another fork, so they are
+// invalidated again.
+func (T *Stalker) prefetch(ctx context.Context, chain *config.Chain, canon *canonChain, query blockstore.QueryRange) error {
+	var stale []hexutil.Uint64
+	var mu sync.Mutex
+
+	var g errgroup.Group
+	for _, typ := range prefetchTypes(chain) {
+		g.Go(func() error {
+			entries, err := T.blocks.Get(ctx, chain, typ, query)
+			if err != nil {
+				return fmt.Errorf("%s: %w", typ, err)
+			}
+			for _, entry := range entries {
+				if entry.BlockHash == (common.Hash{}) {
+					continue
+				}
+				if hash, ok := canon.get(entry.BlockNumber); ok && hash != entry.BlockHash {
+					mu.Lock()
+					stale = append(stale, entry.BlockNumber)
+					mu.Unlock()
+				}
+			}
+			return nil
+		})
+	}
+	err := g.Wait()
+
+	invalidator, ok := T.blocks.(blockstore.Invalidator)
+	if !ok {
+		return err
+	}
+	for _, number := range stale {
+		T.log.Warn("prefetched entry is not canonical. invalidating", "chain", chain.Name, "number", number)
+		if ierr := invalidator.Invalidate(ctx, chain, blockstore.QueryNumber(number)); ierr != nil {
+			T.log.Error("failed to invalidate prefetched entry", "chain", chain.Name, "number", number, "error", ierr)
+		}
+	}
+	return err
+}
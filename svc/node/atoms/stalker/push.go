@@ -0,0 +1,204 @@
+package stalker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gfx.cafe/open/jrpc"
+	"gfx.cafe/open/jrpc/contrib/codecs/websocket"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/gfx-labs/venn/lib/callcenter"
+	"github.com/gfx-labs/venn/lib/config"
+	"github.com/gfx-labs/venn/svc/shared/services/prom"
+)
+
+const (
+	// pushBackoffMin and pushBackoffMax bound the wait between attempts to resubscribe to the new heads of a remote
+	pushBackoffMin = time.Second
+	pushBackoffMax = 30 * time.Second
+	// headTimesDepth is the number of blocks the times a head was seen at are remembered for
+	headTimesDepth = 64
+)
+
+// pushedHead is a head which a remote pushed over its newHeads subscription
+type pushedHead struct {
+	remote string
+	head   blockRef
+	at     time.Time
+}
+
+// listen subscribes to the new heads of the remote and sends them to pushes until the context is done, resubscribing
+// whenever the subscription fails
+func (T *Stalker) listen(ctx context.Context, chain *config.Chain, remote *config.Remote, pushes chan<- pushedHead) {
+	backoff := pushBackoffMin
+	for {
+		start := time.Now()
+		err := T.subscribeHeads(ctx, remote, pushes)
+		if ctx.Err() != nil {
+			return
+		}
+		// a subscription which stayed up for a while is not failing, so start the backoff over
+		if time.Since(start) > pushBackoffMax {
+			backoff = pushBackoffMin
+		}
+		T.log.Warn("new heads subscription closed. resubscribing", "chain", chain.Name, "remote", remote.Name, "error", err, "backoff", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, pushBackoffMax)
+	}
+}
+
+// subscribeHeads sends the heads pushed by the remote to pushes until the subscription fails
+func (T *Stalker) subscribeHeads(ctx context.Context, remote *config.Remote, pushes chan<- pushedHead) error {
+	proxier := callcenter.NewProxier(func(ctx context.Context) (jrpc.Conn, error) {
+		c, err := jrpc.DialContext(ctx, string(remote.WsUrl))
+		if err != nil {
+			return nil, err
+		}
+		if cc, ok := c.(*websocket.Client); ok {
+			for key, value := range remote.Headers {
+				cc.SetHeader(key, value)
+			}
+		}
+		return c, nil
+	})
+	defer proxier.Close()
+
+	ch := make(chan json.RawMessage)
+	sub, err := proxier.Subscribe(ctx, "eth", ch, []any{"newHeads"})
+	if err != nil {
+		return fmt.Errorf("subscribe: %w", err)
+	}
+	defer func() {
+		_ = sub.Unsubscribe()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-sub.Err():
+			return err
+		case msg := <-ch:
+			var head blockRef
+			if err := json.Unmarshal(msg, &head); err != nil {
+				return fmt.Errorf("decode head: %w", err)
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case pushes <- pushedHead{remote: remote.Name, head: head, at: time.Now()}:
+			}
+		}
+	}
+}
+
+// receive applies a head pushed by a remote. heads which are not ahead of the canonical chain are only timed, since
+// polling already covers them.
+func (T *Stalker) receive(ctx context.Context, chain *config.Chain, cluster *callcenter.Cluster, canon *canonChain, times *headTimes, push pushedHead) {
+	times.push(push.remote, push.head.Number, push.at)
+	if !canon.empty() && push.head.Number <= canon.head() {
+		return
+	}
+
+	prev, err := T.apply(ctx, chain, cluster, canon, push.head)
+	if err != nil {
+		T.log.Error("failed to apply pushed head", "chain", chain.Name, "remote", push.remote, "error", err)
+		return
+	}
+	if prev == push.head.Number {
+		return
+	}
+	prom.Stalker.HeadBlock(prom.StalkerLabel{
+		Chain: chain.Name,
+	}).Set(float64(push.head.Number))
+	T.checkConsensus(chain, push.head.Number)
+	T.log.Debug("received pushed block",
+		"chain", chain.Name,
+		"remote", push.remote,
+		"got", push.head.Number, "prev", prev,
+	)
+}
+
+// headTimes remembers when each head was first seen by polling and by every remote pushing heads, to measure how far
+// the pushed heads are ahead of polling. it is only used by the goroutine stalking the chain.
+type headTimes struct {
+	chain  string
+	polled map[hexutil.Uint64]time.Time
+	pushed map[hexutil.Uint64]map[string]time.Time
+	last   hexutil.Uint64
+	top    hexutil.Uint64
+}
+
+func newHeadTimes(chain string) *headTimes {
+	return &headTimes{
+		chain:  chain,
+		polled: make(map[hexutil.Uint64]time.Time),
+		pushed: make(map[hexutil.Uint64]map[string]time.Time),
+	}
+}
+
+// poll records that polling saw the head. it returns false if polling already saw the head or a later one.
+func (h *headTimes) poll(number hexutil.Uint64, at time.Time) bool {
+	if number <= h.last {
+		return false
+	}
+	h.last = number
+	h.polled[number] = at
+	for remote, pushedAt := range h.pushed[number] {
+		h.observe(remote, at.Sub(pushedAt))
+	}
+	h.prune(number)
+	return true
+}
+
+// push records that the remote pushed the head
+func (h *headTimes) push(remote string, number hexutil.Uint64, at time.Time) {
+	remotes, ok := h.pushed[number]
+	if !ok {
+		remotes = make(map[string]time.Time)
+		h.pushed[number] = remotes
+	}
+	if _, ok := remotes[remote]; ok {
+		return
+	}
+	remotes[remote] = at
+	if polledAt, ok := h.polled[number]; ok {
+		h.observe(remote, polledAt.Sub(at))
+	}
+	h.prune(number)
+}
+
+// observe records how far the push of the remote was ahead of polling. it is negative if polling was first.
+func (h *headTimes) observe(remote string, lead time.Duration) {
+	prom.Stalker.PushLead(prom.StalkerRemoteLabel{
+		Chain:  h.chain,
+		Remote: remote,
+	}).Observe(float64(lead.Milliseconds()))
+}
+
+func (h *headTimes) prune(number hexutil.Uint64) {
+	if number <= h.top {
+		return
+	}
+	h.top = number
+	if h.top < headTimesDepth {
+		return
+	}
+	for n := range h.polled {
+		if n <= h.top-headTimesDepth {
+			delete(h.polled, n)
+		}
+	}
+	for n := range h.pushed {
+		if n <= h.top-headTimesDepth {
+			delete(h.pushed, n)
+		}
+	}
+}
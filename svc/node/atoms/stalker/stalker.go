@@ -16,8 +16,11 @@ import (
 	"github.com/gfx-labs/venn/lib/callcenter"
 	"github.com/gfx-labs/venn/lib/config"
 	"github.com/gfx-labs/venn/lib/jrpcutil"
+	"github.com/gfx-labs/venn/lib/stores/blockstore"
 	"github.com/gfx-labs/venn/lib/stores/headstore"
 	"github.com/gfx-labs/venn/svc/node/atoms/election"
+	"github.com/gfx-labs/venn/svc/node/atoms/headoracle"
+	"github.com/gfx-labs/venn/svc/node/atoms/vennstore"
 	"github.com/gfx-labs/venn/svc/node/quarks/cluster"
 	"github.com/gfx-labs/venn/svc/shared/services/prom"
 )
@@ -26,7 +29,13 @@ type Stalker struct {
 	ctx       context.Context
 	log       *slog.Logger
 	headstore headstore.Store
+	blocks    blockstore.Store
+	reorgs    *vennstore.Reorgs
 	election  *election.Election
+	oracle    *headoracle.HeadOracle
+
+	// chains is the name of every stalked chain
+	chains []string
 
 	dt map[string]*delayTracker
 }
@@ -40,7 +49,10 @@ type Params struct {
 	Chains   map[string]*config.Chain
 	Clusters *cluster.Clusters
 	Head     headstore.Store
+	Blocks   blockstore.Store
+	Reorgs   *vennstore.Reorgs
 	Election *election.Election
+	Oracle   *headoracle.HeadOracle `optional:"true"`
 }
 
 type Result struct {
@@ -54,7 +66,10 @@ func New(p Params) (r Result, err error) {
 		ctx:       p.Ctx,
 		log:       p.Log,
 		headstore: p.Head,
+		blocks:    p.Blocks,
+		reorgs:    p.Reorgs,
 		election:  p.Election,
+		oracle:    p.Oracle,
 		dt:        make(map[string]*delayTracker),
 	}
 	r.Stalker = s
@@ -63,58 +78,146 @@ func New(p Params) (r Result, err error) {
 		blockTime := time.Duration(chain.BlockTimeSeconds * float64(time.Second))
 		s.dt[chain.Name] = newDelayTracker(128, 0, int(blockTime))
 	}
+	clusters := make(map[string]*callcenter.Cluster)
+	for _, chain := range p.Chains {
+		if !chain.ParsedStalk {
+			continue
+		}
+		cluster, ok := p.Clusters.Remotes[chain.Name]
+		if !ok {
+			s.log.Error("cluster not found for chain. not stalking", "chain", chain.Name)
+			continue
+		}
+		clusters[chain.Name] = cluster
+		s.chains = append(s.chains, chain.Name)
+	}
 	p.Lc.Append(fx.Hook{
 		OnStart: func(_ context.Context) error {
-			go s.election.RunWithLease(
-				s.ctx,
-				s.log.With("module", "stalker"),
-				func(ctx context.Context) {
-					for _, chain := range p.Chains {
-						if !chain.ParsedStalk {
-							continue
+			for name, cluster := range clusters {
+				chain := p.Chains[name]
+				// every chain has a lease of its own, so the chains are spread across the replicas and fail over on their own
+				go s.election.RunWithShardLease(
+					s.ctx,
+					s.log.With("module", "stalker", "chain", chain.Name),
+					shard(chain.Name),
+					func(ctx context.Context) {
+						// heads put under a lease which was since taken over are dropped by the headstore
+						if token, ok := s.election.Fence(ctx); ok {
+							ctx = headstore.WithFence(ctx, token)
 						}
-						cluster, ok := p.Clusters.Remotes[chain.Name]
-						if !ok {
-							s.log.Error("cluster not found for chain. not stalking", "chain", chain.Name)
-							continue
+						stalkerLabel := prom.StalkerLabel{
+							Chain: chain.Name,
 						}
-						go s.stalk(ctx, chain, cluster)
-					}
-					<-ctx.Done()
-				},
-				func(ctx context.Context) {
-					<-ctx.Done()
-				},
-			)
+						prom.Stalker.Leader(stalkerLabel).Set(1)
+						defer prom.Stalker.Leader(stalkerLabel).Set(0)
+						go s.stalkFinality(ctx, chain, cluster)
+						s.stalk(ctx, chain, cluster)
+					},
+					func(ctx context.Context) {
+						<-ctx.Done()
+					},
+				)
+			}
 			return nil
 		},
 	})
 	return
 }
 
+// shard returns the name of the election shard of the chain
+func shard(chain string) string {
+	return "stalker:" + chain
+}
+
+// Owners returns the member of the election stalking each chain, and which of them is this one
+func (T *Stalker) Owners(ctx context.Context) (owners map[string]string, self string, err error) {
+	shards := make([]string, 0, len(T.chains))
+	for _, chain := range T.chains {
+		shards = append(shards, shard(chain))
+	}
+	byShard, err := T.election.Owners(ctx, shards)
+	if err != nil {
+		return nil, "", err
+	}
+	owners = make(map[string]string, len(byShard))
+	for _, chain := range T.chains {
+		if owner, ok := byShard[shard(chain)]; ok {
+			owners[chain] = owner
+		}
+	}
+	return owners, T.election.ID(), nil
+}
+
 func (T *Stalker) stalk(ctx context.Context, chain *config.Chain, cluster *callcenter.Cluster) {
 	// set the chain context for the requests
 	ctx = subctx.WithChain(ctx, chain)
-	for {
-		waitfor, err := T.tick(ctx, chain, cluster)
-		if err != nil {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-			}
-			T.log.Error("failed to get block head", "chain", chain.Name, "error", err)
+	// the canonical chain is only tracked while holding the lease, so start from scratch every time
+	canon := new(canonChain)
+	times := newHeadTimes(chain.Name)
+
+	// remotes which push their heads are followed alongside polling, which stays as the fallback
+	pushes := make(chan pushedHead)
+	for _, remote := range chain.Remotes {
+		if remote.PushHeads {
+			go T.listen(ctx, chain, remote, pushes)
 		}
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-time.After(waitfor):
-			continue
+		case push := <-pushes:
+			T.receive(ctx, chain, cluster, canon, times, push)
+		case <-timer.C:
+			waitfor, err := T.tick(ctx, chain, cluster, canon, times)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				T.log.Error("failed to get block head", "chain", chain.Name, "error", err)
+			}
+			timer.Reset(waitfor)
+		}
+	}
+}
+
+// apply tracks the head on the canonical chain, prefetches the new blocks and then publishes the head. heads which are
+// not ahead of the published head are not published again, so pushed and polled heads are deduped.
+func (T *Stalker) apply(ctx context.Context, chain *config.Chain, cluster *callcenter.Cluster, canon *canonChain, head blockRef) (hexutil.Uint64, error) {
+	blockTime := max(time.Duration(chain.BlockTimeSeconds*float64(time.Second)), 500*time.Millisecond)
+
+	// the orphaned blocks of a reorg are invalidated before the new head is published, so that the head is never served
+	// from them. other replicas drop them from their own stores once the reorg reaches them
+	if err := T.track(ctx, chain, cluster, canon, head); err != nil {
+		return 0, fmt.Errorf("track canonical chain: %w", err)
+	}
+
+	// the entries of the new blocks are cached before the head is published, so that nobody has to wait for a remote
+	if chain.Prefetch != nil {
+		current, err := T.headstore.Get(ctx, chain)
+		if err == nil && head.Number > current {
+			query := blockstore.QueryRange{
+				Start: current + 1,
+				End:   head.Number,
+			}
+			if query.End-query.Start >= prefetchDepth {
+				query.Start = query.End - prefetchDepth + 1
+			}
+			pctx, cancel := context.WithTimeout(ctx, min(blockTime/4, prefetchTimeout))
+			if err := T.prefetch(pctx, chain, canon, query); err != nil {
+				T.log.Warn("failed to prefetch new blocks", "chain", chain.Name, "start", query.Start, "end", query.End, "error", err)
+			}
+			cancel()
 		}
 	}
+
+	return T.headstore.Put(ctx, chain, head.Number)
 }
 
-func (T *Stalker) tick(ctx context.Context, chain *config.Chain, cluster *callcenter.Cluster) (time.Duration, error) {
+func (T *Stalker) tick(ctx context.Context, chain *config.Chain, cluster *callcenter.Cluster, canon *canonChain, times *headTimes) (time.Duration, error) {
 	blockTime := max(time.Duration(chain.BlockTimeSeconds*float64(time.Second)), 500*time.Millisecond)
 	// ask for the latest block
 	var block json.RawMessage
@@ -129,10 +232,10 @@ func (T *Stalker) tick(ctx context.Context, chain *config.Chain, cluster *callce
 		return blockTime, nil
 	}
 
-	// extract block number and timestamp
+	// extract block number, hashes and timestamp
 	var head struct {
-		BlockNumber hexutil.Uint64 `json:"number"`
-		Timestamp   hexutil.Uint64 `json:"timestamp"`
+		blockRef
+		Timestamp hexutil.Uint64 `json:"timestamp"`
 	}
 
 	if err := json.Unmarshal(block, &head); err != nil {
@@ -142,13 +245,14 @@ func (T *Stalker) tick(ctx context.Context, chain *config.Chain, cluster *callce
 	objTime := time.Unix(int64(head.Timestamp), 0)
 	nextTime := objTime.Add(blockTime)
 
-	prev, err := T.headstore.Put(ctx, chain, head.BlockNumber)
+	prev, err := T.apply(ctx, chain, cluster, canon, head.blockRef)
 	if err != nil {
 		// store error, so lets just wait the block time
 		return blockTime, err
 	}
 	dt := T.dt[chain.Name]
-	if prev != head.BlockNumber {
+	// the head may already have been pushed by a remote, so the schedule follows the heads seen by polling
+	if times.poll(head.Number, now) {
 		// we can use this as a data point for propogation delay. we accept a propogation delay of up to the blocktime
 		propDelay := nextTime.Sub(now)
 		if propDelay > 0 {
@@ -171,11 +275,12 @@ func (T *Stalker) tick(ctx context.Context, chain *config.Chain, cluster *callce
 		prom.Stalker.BlockPropagationDelay(stalkerLabel).Observe(float64(propDelay))
 		prom.Stalker.PropagationDelayMean(stalkerLabel).Set(float64(meanPropDelay.Milliseconds()))
 		// update the head block metric
-		prom.Stalker.HeadBlock(stalkerLabel).Set(float64(head.BlockNumber))
+		prom.Stalker.HeadBlock(stalkerLabel).Set(float64(head.Number))
+		T.checkConsensus(chain, head.Number)
 
 		T.log.Debug("received new block",
 			"chain", chain.Name,
-			"got", head.BlockNumber, "prev", prev,
+			"got", head.Number, "prev", prev,
 			"expected time", nextTime, "now", now,
 			"next wait", nextWait,
 			"propagation delay", meanPropDelay,
@@ -195,10 +300,137 @@ func (T *Stalker) tick(ctx context.Context, chain *config.Chain, cluster *callce
 	nextWait := max(500*time.Millisecond, blockTime/4)
 	T.log.Debug("received stale block",
 		"chain", chain.Name,
-		"got", head.BlockNumber, "prev", prev,
+		"got", head.Number, "prev", prev,
 		"expected time", nextTime, "now", now,
 		"next wait", nextWait,
 	)
 	return nextWait, nil
 	// otherwise, use the time until the expected time, or 500ms, whichever is greater
 }
+
+// track adds the head to the canonical chain. if the head does not build on the remembered chain, the chain is followed
+// back to where it forked and a reorg is published for the blocks which were replaced.
+func (T *Stalker) track(ctx context.Context, chain *config.Chain, cluster *callcenter.Cluster, canon *canonChain, head blockRef) error {
+	if !canon.empty() && head.Number < canon.head() {
+		// a remote which is behind, which may still be on a fork that was since orphaned. a reorg to a shorter chain is
+		// followed once the chain grows past the tracked head
+		return nil
+	}
+	if hash, ok := canon.get(head.Number); ok && hash == head.Hash {
+		// the same head again
+		return nil
+	}
+	if canon.empty() || head.Number > canon.head()+canonDepth {
+		canon.push(head)
+		return nil
+	}
+
+	// finalized blocks can not be reorged, so the chain is never followed back past them
+	heads, err := T.headstore.GetHeads(ctx, chain)
+	if err != nil {
+		return err
+	}
+
+	added := []blockRef{head}
+	cur := head
+	for {
+		if cur.Number == 0 || cur.Number <= canon.tail() {
+			T.log.Warn("reorg is deeper than the tracked blocks", "chain", chain.Name, "tracked", canonDepth, "head", head.Number)
+			break
+		}
+		if heads.Finalized > 0 && cur.Number <= heads.Finalized {
+			// only a remote which is on another chain could disagree this far back
+			T.log.Warn("reorg reaches past the finalized block", "chain", chain.Name, "finalized", heads.Finalized, "head", head.Number)
+			canon.rewind(0)
+			canon.push(head)
+			return nil
+		}
+		if hash, ok := canon.get(cur.Number - 1); ok && hash == cur.ParentHash {
+			break
+		}
+		parent, err := T.getBlock(ctx, cluster, cur.Number-1)
+		if err != nil {
+			return err
+		}
+		if parent.Hash != cur.ParentHash {
+			// the remotes disagree about the chain, so it cannot be followed back. start over from the head
+			T.log.Warn("remotes disagree about the canonical chain", "chain", chain.Name, "number", parent.Number, "expected", cur.ParentHash, "got", parent.Hash)
+			canon.rewind(0)
+			canon.push(head)
+			return nil
+		}
+		added = append(added, parent)
+		cur = parent
+	}
+	fork := cur.Number - 1
+
+	var reorg *headstore.Reorg
+	if fork < canon.head() {
+		reorg = &headstore.Reorg{
+			Start: max(fork+1, canon.tail()),
+			End:   canon.head(),
+			Head:  head.Number,
+		}
+		for i := reorg.Start; i <= reorg.End; i++ {
+			hash, _ := canon.get(i)
+			reorg.Orphaned = append(reorg.Orphaned, hash)
+		}
+	}
+
+	canon.rewind(fork)
+	for i := len(added) - 1; i >= 0; i-- {
+		canon.push(added[i])
+	}
+	if reorg == nil {
+		return nil
+	}
+
+	stalkerLabel := prom.StalkerLabel{
+		Chain: chain.Name,
+	}
+	prom.Stalker.Reorgs(stalkerLabel).Inc()
+	prom.Stalker.ReorgDepth(stalkerLabel).Observe(float64(reorg.Depth()))
+	T.log.Warn("reorg detected",
+		"chain", chain.Name,
+		"depth", reorg.Depth(),
+		"start", reorg.Start, "end", reorg.End,
+		"head", head.Number, "hash", head.Hash,
+	)
+	return T.reorgs.Apply(ctx, chain, *reorg)
+}
+
+func (T *Stalker) getBlock(ctx context.Context, cluster *callcenter.Cluster, number hexutil.Uint64) (blockRef, error) {
+	var block *blockRef
+	if err := jrpcutil.Do(ctx, cluster, &block, "eth_getBlockByNumber", []any{number, false}); err != nil {
+		return blockRef{}, fmt.Errorf("get block %d: %w", number, err)
+	}
+	if block == nil {
+		return blockRef{}, fmt.Errorf("block %d not found", number)
+	}
+	return *block, nil
+}
+
+// checkConsensus compares the head we got from the cluster against the head oracle consensus, if there is one
+func (T *Stalker) checkConsensus(chain *config.Chain, head hexutil.Uint64) {
+	if T.oracle == nil {
+		return
+	}
+	consensus, _, ok := T.oracle.Consensus(chain.Name)
+	if !ok {
+		return
+	}
+	var lag hexutil.Uint64
+	if consensus > head {
+		lag = consensus - head
+	}
+	prom.Stalker.HeadLag(prom.StalkerLabel{
+		Chain: chain.Name,
+	}).Set(float64(lag))
+	if chain.HeadLagThreshold > 0 && lag > hexutil.Uint64(chain.HeadLagThreshold) {
+		T.log.Warn("stalker head is behind head oracle consensus",
+			"chain", chain.Name,
+			"head", head, "consensus", consensus,
+			"lag", lag,
+		)
+	}
+}
@@ -14,13 +14,15 @@ import (
 	"go.uber.org/fx"
 
 	"github.com/gfx-labs/venn/lib/config"
-	"github.com/gfx-labs/venn/lib/ethtypes"
-	"github.com/gfx-labs/venn/lib/jrpcutil"
+	"github.com/gfx-labs/venn/svc/node/atoms/vennstore"
 )
 
 type Subcenter struct {
-	store headstore.Store
-	log   *slog.Logger
+	store  headstore.Store
+	reorgs *vennstore.Reorgs
+	feeds  *feeds
+	heads  *headBroadcasters
+	log    *slog.Logger
 }
 
 type Params struct {
@@ -28,6 +30,7 @@ type Params struct {
 
 	Log    *slog.Logger
 	Heads  headstore.Store
+	Reorgs *vennstore.Reorgs
 	Chains map[string]*config.Chain
 }
 
@@ -39,8 +42,11 @@ type Result struct {
 
 func New(p Params) (r Result, err error) {
 	r.Result = &Subcenter{
-		store: p.Heads,
-		log:   p.Log,
+		store:  p.Heads,
+		reorgs: p.Reorgs,
+		feeds:  newFeeds(p.Log.With("module", "feeds")),
+		heads:  newHeadBroadcasters(p.Log.With("module", "heads"), p.Heads),
+		log:    p.Log,
 	}
 	return r, nil
 }
@@ -92,10 +98,6 @@ func (T *Subcenter) Middleware(h jrpc.Handler) jrpc.Handler {
 				_ = w.Send(nil, err)
 				return
 			}
-			if !chain.ParsedStalk {
-				_ = w.Send(nil, jsonrpc.NewInvalidRequestError("chain does not support subscriptions"))
-				return
-			}
 			notifier, ok := subscription.NotifierFromContext(r.Context())
 			if !ok {
 				_ = w.Send(nil, subscription.ErrNotificationsUnsupported)
@@ -121,6 +123,40 @@ func (T *Subcenter) Middleware(h jrpc.Handler) jrpc.Handler {
 
 			params = params[1:]
 
+			// these are shared upstream subscriptions, so they do not need the chain to be stalked
+			switch method {
+			case "newPendingTransactions":
+				var fullTx bool
+				if len(params) > 1 {
+					_ = w.Send(nil, jsonrpc.NewInvalidParamsError("expected at most 1 parameter"))
+					return
+				}
+				if len(params) == 1 {
+					if err := json.Unmarshal(params[0], &fullTx); err != nil {
+						_ = w.Send(nil, jsonrpc.NewInvalidParamsError(err.Error()))
+						return
+					}
+				}
+				if fullTx {
+					T.serveUpstream(w, r, chain, notifier, method, true)
+				} else {
+					T.serveUpstream(w, r, chain, notifier, method)
+				}
+				return
+			case "syncing":
+				if len(params) != 0 {
+					_ = w.Send(nil, jsonrpc.NewInvalidParamsError("expected no parameters"))
+					return
+				}
+				T.serveUpstream(w, r, chain, notifier, method)
+				return
+			}
+
+			if !chain.ParsedStalk {
+				_ = w.Send(nil, jsonrpc.NewInvalidRequestError("chain does not support subscriptions"))
+				return
+			}
+
 			current, err := T.store.Get(r.Context(), chain)
 			if err != nil {
 				_ = w.Send(nil, err)
@@ -131,106 +167,9 @@ func (T *Subcenter) Middleware(h jrpc.Handler) jrpc.Handler {
 
 			switch method {
 			case "newHeads":
-				{
-					sub, done := T.store.On(chain)
-					defer done()
-
-					w.Send(notifier.ID(), nil)
-					for {
-						select {
-						case <-r.Context().Done():
-							T.log.Info("context closed. closing subscription")
-							return
-						case err := <-notifier.Err():
-							T.log.Error("notifier error. subscription closing.", "error", err)
-							return
-						case head := <-sub:
-							// NOTE: eth_subscribe doesn't guarantee that every single block will be sent.
-							// we could implement native retry logic the underlying cluster, retrying non application/user errors up to N times with some sort of backoff, to better deliver blocks.
-							for i := current + 1; i <= head; i++ {
-								var block json.RawMessage
-								if err := jrpcutil.Do(r.Context(), h, &block, "eth_getBlockByNumber", []any{i, false}); err != nil {
-									T.log.Error("failed to get block", "error", err)
-									continue
-								}
-								withoutTxns, err := removeTransactions(block)
-								if err != nil {
-									T.log.Error("failed to remove txns from block. was the block invalid?", "error", err)
-									continue
-								}
-								// if the notifier errors, the connection should closed if it errors anyways, so we can error here and return, since that will happen anyways, we may as well not waste the calls to more blocks
-								if err := notifier.Notify(withoutTxns); err != nil {
-									T.log.Error("failed to notify the subscription", "error", err)
-									break
-								}
-							}
-							current = head
-						}
-					}
-				}
+				T.serveHeads(w, r, h, chain, notifier)
 			case "logs":
-				{
-					var filter ethtypes.SubscriptionFilterQuery
-					if len(params) != 1 {
-						_ = w.Send(nil, jsonrpc.NewInvalidParamsError("expected 1 parameter"))
-						return
-					}
-
-					if err = json.Unmarshal(params[0], &filter); err != nil {
-						_ = w.Send(nil, jsonrpc.NewInvalidParamsError(err.Error()))
-						return
-					}
-
-					w.Send(notifier.ID(), nil)
-					sub, done := T.store.On(chain)
-					defer done()
-					for {
-						select {
-						case <-r.Context().Done():
-							T.log.Info("context closed. closing subscription")
-							return
-						case err = <-notifier.Err():
-							T.log.Error("notifier error. subscription closing.", "error", err)
-							return
-						case head := <-sub:
-							from := ethtypes.BlockNumber(current + 1)
-							to := ethtypes.BlockNumber(head)
-
-							var logs json.RawMessage
-							if err := jrpcutil.Do(r.Context(), h, &logs, "eth_getLogs", []any{
-								ethtypes.FilterQuery{
-									FromBlock: &from,
-									ToBlock:   &to,
-									Addresses: filter.Addresses,
-									Topics:    filter.Topics,
-								},
-							}); err != nil {
-								T.log.Error("failed to get logs for sub", "error", err)
-								continue
-							}
-
-							d := jx.DecodeBytes(logs)
-							arr, err := d.ArrIter()
-							if err != nil {
-								T.log.Error("failed to decode logs. are the logs corrupt?", "error", err)
-								continue
-							}
-							for arr.Next() {
-								log, err := d.Raw()
-								if err != nil {
-									T.log.Error("failed to decode log. are they corrupt?", "error", err)
-									continue
-								}
-								if err = notifier.Notify(json.RawMessage(log)); err != nil {
-									T.log.Error("error notifying subscription", "error", err)
-									break
-								}
-							}
-
-							current = head
-						}
-					}
-				}
+				T.serveLogs(w, r, h, chain, notifier, current, params)
 			default:
 				_ = w.Send(nil, jsonrpc.NewInvalidRequestError("unknown subscription method"))
 				return
@@ -0,0 +1,224 @@
+package subcenter
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+
+	"gfx.cafe/open/jrpc"
+	"gfx.cafe/open/jrpc/contrib/extension/subscription"
+	"gfx.cafe/open/jrpc/pkg/jsonrpc"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/gfx-labs/venn/lib/config"
+	"github.com/gfx-labs/venn/lib/jrpcutil"
+	"github.com/gfx-labs/venn/lib/stores/headstore"
+	"github.com/gfx-labs/venn/lib/subctx"
+	"github.com/gfx-labs/venn/svc/shared/services/prom"
+)
+
+// headRing is the number of rendered headers kept per chain. subscribers which fall further behind are disconnected.
+const headRing = 64
+
+// headBroadcasters runs a broadcaster per chain while it has newHeads subscribers
+type headBroadcasters struct {
+	log        *slog.Logger
+	store      headstore.Store
+	broadcasts map[string]*headBroadcaster
+	mu         sync.Mutex
+}
+
+// headBroadcaster fetches every new header once, strips its transactions and keeps the result in a ring buffer which
+// is read by all the subscribers of the chain
+type headBroadcaster struct {
+	log    *slog.Logger
+	chain  *config.Chain
+	cancel context.CancelFunc
+
+	ring [headRing]json.RawMessage
+	// seq is the number of headers pushed so far
+	seq uint64
+
+	subs map[int]*headSub
+	next int
+	mu   sync.Mutex
+}
+
+type headSub struct {
+	b      *headBroadcaster
+	id     int
+	cursor uint64
+	// wake is signalled when there are new headers to read
+	wake chan struct{}
+}
+
+func newHeadBroadcasters(log *slog.Logger, store headstore.Store) *headBroadcasters {
+	return &headBroadcasters{
+		log:        log,
+		store:      store,
+		broadcasts: make(map[string]*headBroadcaster),
+	}
+}
+
+// subscribe adds a subscriber to the broadcaster of the chain, starting it if needed. h is used to fetch the headers.
+func (T *headBroadcasters) subscribe(chain *config.Chain, h jrpc.Handler) *headSub {
+	T.mu.Lock()
+	defer T.mu.Unlock()
+
+	b, ok := T.broadcasts[chain.Name]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		b = &headBroadcaster{
+			log:    T.log.With("chain", chain.Name),
+			chain:  chain,
+			cancel: cancel,
+			subs:   make(map[int]*headSub),
+		}
+		T.broadcasts[chain.Name] = b
+		go b.run(ctx, T.store, h)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sub := &headSub{
+		b:      b,
+		id:     b.next,
+		cursor: b.seq,
+		wake:   make(chan struct{}, 1),
+	}
+	b.next++
+	b.subs[sub.id] = sub
+	prom.Subscriptions.HeadSubscribers(prom.SubscriptionLabel{Chain: chain.Name}).Set(float64(len(b.subs)))
+	return sub
+}
+
+func (T *headBroadcasters) unsubscribe(sub *headSub) {
+	T.mu.Lock()
+	defer T.mu.Unlock()
+
+	b := sub.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[sub.id]; !ok {
+		return
+	}
+	delete(b.subs, sub.id)
+	prom.Subscriptions.HeadSubscribers(prom.SubscriptionLabel{Chain: b.chain.Name}).Set(float64(len(b.subs)))
+	if len(b.subs) == 0 {
+		b.cancel()
+		delete(T.broadcasts, b.chain.Name)
+	}
+}
+
+func (T *headBroadcaster) push(header json.RawMessage) {
+	T.mu.Lock()
+	defer T.mu.Unlock()
+
+	T.ring[T.seq%headRing] = header
+	T.seq++
+	for _, sub := range T.subs {
+		select {
+		case sub.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// read returns the headers the subscriber has not seen yet and how far behind it was. it returns false if the
+// subscriber fell so far behind that headers it has not seen were dropped from the ring.
+func (T *headSub) read() ([]json.RawMessage, int, bool) {
+	T.b.mu.Lock()
+	defer T.b.mu.Unlock()
+
+	lag := int(T.b.seq - T.cursor)
+	if lag > headRing {
+		return nil, lag, false
+	}
+	headers := make([]json.RawMessage, 0, lag)
+	for ; T.cursor < T.b.seq; T.cursor++ {
+		headers = append(headers, T.b.ring[T.cursor%headRing])
+	}
+	return headers, lag, true
+}
+
+func (T *headBroadcaster) run(ctx context.Context, store headstore.Store, h jrpc.Handler) {
+	// set the chain context for the requests
+	ctx = subctx.WithChain(ctx, T.chain)
+	heads, done := store.On(T.chain)
+	defer done()
+
+	current, err := store.Get(ctx, T.chain)
+	if err != nil {
+		T.log.Error("failed to get head", "error", err)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case head, ok := <-heads:
+			if !ok {
+				return
+			}
+			if head <= current {
+				continue
+			}
+			// subscribers can never read more than the ring holds, so there is no point fetching more
+			if head-current > headRing {
+				current = head - headRing
+			}
+			// NOTE: eth_subscribe doesn't guarantee that every single block will be sent.
+			for i := current + 1; i <= head; i++ {
+				header, err := T.render(ctx, h, i)
+				if err != nil {
+					T.log.Error("failed to get block", "number", i, "error", err)
+					continue
+				}
+				T.push(header)
+			}
+			current = head
+		}
+	}
+}
+
+func (T *headBroadcaster) render(ctx context.Context, h jrpc.Handler, number hexutil.Uint64) (json.RawMessage, error) {
+	var block json.RawMessage
+	if err := jrpcutil.Do(ctx, h, &block, "eth_getBlockByNumber", []any{number, false}); err != nil {
+		return nil, err
+	}
+	return removeTransactions(block)
+}
+
+// serveHeads sends every new header to the subscriber. subscribers which fall too far behind are disconnected.
+func (T *Subcenter) serveHeads(w jsonrpc.ResponseWriter, r *jsonrpc.Request, h jrpc.Handler, chain *config.Chain, notifier *subscription.Notifier) {
+	sub := T.heads.subscribe(chain, h)
+	defer T.heads.unsubscribe(sub)
+
+	label := prom.SubscriptionLabel{Chain: chain.Name}
+	w.Send(notifier.ID(), nil)
+	for {
+		select {
+		case <-r.Context().Done():
+			T.log.Info("context closed. closing subscription")
+			return
+		case err := <-notifier.Err():
+			T.log.Error("notifier error. subscription closing.", "error", err)
+			return
+		case <-sub.wake:
+			headers, lag, ok := sub.read()
+			if !ok {
+				prom.Subscriptions.HeadDropped(label).Inc()
+				T.log.Warn("subscriber fell too far behind. closing subscription", "chain", chain.Name, "lag", lag)
+				return
+			}
+			prom.Subscriptions.HeadLag(label).Observe(float64(lag))
+			for _, header := range headers {
+				// if the notifier errors, the connection should closed if it errors anyways, so we can stop here
+				if err := notifier.Notify(header); err != nil {
+					T.log.Error("failed to notify the subscription", "error", err)
+					return
+				}
+			}
+		}
+	}
+}
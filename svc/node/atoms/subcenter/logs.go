@@ -0,0 +1,241 @@
+package subcenter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"gfx.cafe/open/jrpc"
+	"gfx.cafe/open/jrpc/contrib/extension/subscription"
+	"gfx.cafe/open/jrpc/pkg/jsonrpc"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/go-faster/jx"
+
+	"github.com/gfx-labs/venn/lib/config"
+	"github.com/gfx-labs/venn/lib/ethtypes"
+	"github.com/gfx-labs/venn/lib/jrpcutil"
+)
+
+// deliveredDepth is the number of blocks behind the head for which delivered logs are remembered
+const deliveredDepth = 256
+
+type deliveredBlock struct {
+	number hexutil.Uint64
+	hash   common.Hash
+	logs   []json.RawMessage
+}
+
+// deliveredLogs remembers the logs a subscription has sent for recent blocks, so that they can be sent again marked as
+// removed when their block is orphaned
+type deliveredLogs struct {
+	blocks []deliveredBlock
+}
+
+func (d *deliveredLogs) add(log json.RawMessage) error {
+	var l struct {
+		BlockHash   common.Hash    `json:"blockHash"`
+		BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	}
+	if err := json.Unmarshal(log, &l); err != nil {
+		return err
+	}
+	if n := len(d.blocks); n > 0 && d.blocks[n-1].hash == l.BlockHash {
+		d.blocks[n-1].logs = append(d.blocks[n-1].logs, log)
+		return nil
+	}
+	d.blocks = append(d.blocks, deliveredBlock{
+		number: l.BlockNumber,
+		hash:   l.BlockHash,
+		logs:   []json.RawMessage{log},
+	})
+	return nil
+}
+
+// prune forgets the blocks below number
+func (d *deliveredLogs) prune(number hexutil.Uint64) {
+	d.blocks = slices.DeleteFunc(d.blocks, func(b deliveredBlock) bool {
+		return b.number < number
+	})
+}
+
+// remove forgets the blocks with the given hashes, and returns their logs marked as removed, newest first
+func (d *deliveredLogs) remove(hashes []common.Hash) ([]json.RawMessage, error) {
+	var removed []json.RawMessage
+	for i := len(d.blocks) - 1; i >= 0; i-- {
+		block := d.blocks[i]
+		if !slices.Contains(hashes, block.hash) {
+			continue
+		}
+		for j := len(block.logs) - 1; j >= 0; j-- {
+			log, err := markRemoved(block.logs[j])
+			if err != nil {
+				return nil, err
+			}
+			removed = append(removed, log)
+		}
+	}
+	d.blocks = slices.DeleteFunc(d.blocks, func(b deliveredBlock) bool {
+		return slices.Contains(hashes, b.hash)
+	})
+	return removed, nil
+}
+
+// markRemoved sets the removed field of the log to true
+func markRemoved(log json.RawMessage) (json.RawMessage, error) {
+	d := jx.DecodeBytes(log)
+	var w jx.Writer
+
+	fields, err := d.ObjIter()
+	if err != nil {
+		return nil, err
+	}
+	w.ObjStart()
+	for fields.Next() {
+		if bytes.Equal(fields.Key(), []byte("removed")) {
+			if err = d.Skip(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		w.ByteStr(fields.Key())
+		w.RawStr(":")
+
+		raw, err := d.Raw()
+		if err != nil {
+			return nil, err
+		}
+		w.Raw(raw)
+		w.Comma()
+	}
+	w.RawStr(`"removed":true`)
+	w.ObjEnd()
+
+	return w.Buf, nil
+}
+
+// serveLogs streams the logs matching the filter for every new block. when blocks are orphaned by a reorg, the logs
+// which were sent for them are sent again marked as removed, followed by the logs of the new canonical blocks.
+func (T *Subcenter) serveLogs(w jsonrpc.ResponseWriter, r *jsonrpc.Request, h jrpc.Handler, chain *config.Chain, notifier *subscription.Notifier, current hexutil.Uint64, params []json.RawMessage) {
+	var filter ethtypes.SubscriptionFilterQuery
+	if len(params) != 1 {
+		_ = w.Send(nil, jsonrpc.NewInvalidParamsError("expected 1 parameter"))
+		return
+	}
+
+	if err := json.Unmarshal(params[0], &filter); err != nil {
+		_ = w.Send(nil, jsonrpc.NewInvalidParamsError(err.Error()))
+		return
+	}
+
+	w.Send(notifier.ID(), nil)
+	sub, done := T.store.On(chain)
+	defer done()
+	reorgs, reorgsDone := T.reorgs.On(chain)
+	defer reorgsDone()
+
+	var delivered deliveredLogs
+	// deliver sends the logs of the blocks in the range. it returns false if the logs could not be fetched, and an error
+	// if the subscription could not be notified
+	deliver := func(from, to hexutil.Uint64) (bool, error) {
+		fromBlock := ethtypes.BlockNumber(from)
+		toBlock := ethtypes.BlockNumber(to)
+
+		var logs json.RawMessage
+		if err := jrpcutil.Do(r.Context(), h, &logs, "eth_getLogs", []any{
+			ethtypes.FilterQuery{
+				FromBlock: &fromBlock,
+				ToBlock:   &toBlock,
+				Addresses: filter.Addresses,
+				Topics:    filter.Topics,
+			},
+		}); err != nil {
+			T.log.Error("failed to get logs for sub", "error", err)
+			return false, nil
+		}
+
+		d := jx.DecodeBytes(logs)
+		arr, err := d.ArrIter()
+		if err != nil {
+			T.log.Error("failed to decode logs. are the logs corrupt?", "error", err)
+			return false, nil
+		}
+		for arr.Next() {
+			log, err := d.Raw()
+			if err != nil {
+				T.log.Error("failed to decode log. are they corrupt?", "error", err)
+				return false, nil
+			}
+			if err := delivered.add(json.RawMessage(log)); err != nil {
+				T.log.Error("failed to decode log block. is the log corrupt?", "error", err)
+			}
+			if err = notifier.Notify(json.RawMessage(log)); err != nil {
+				return false, fmt.Errorf("notify subscription: %w", err)
+			}
+		}
+		if to > deliveredDepth {
+			delivered.prune(to - deliveredDepth)
+		}
+		return true, nil
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			T.log.Info("context closed. closing subscription")
+			return
+		case err := <-notifier.Err():
+			T.log.Error("notifier error. subscription closing.", "error", err)
+			return
+		case reorg, ok := <-reorgs:
+			if !ok {
+				return
+			}
+			removed, err := delivered.remove(reorg.Orphaned)
+			if err != nil {
+				T.log.Error("failed to mark logs as removed. are the logs corrupt?", "error", err)
+			}
+			for _, log := range removed {
+				if err := notifier.Notify(log); err != nil {
+					T.log.Error("error notifying subscription", "error", err)
+					return
+				}
+			}
+			if reorg.Start > current {
+				// none of the orphaned blocks were delivered yet
+				continue
+			}
+			// the head may already have moved past the orphaned blocks, in which case only they are sent again
+			to := min(current, reorg.End, reorg.Head)
+			if to >= reorg.Start {
+				ok, err := deliver(reorg.Start, to)
+				if err != nil {
+					T.log.Error("error notifying subscription", "error", err)
+					return
+				}
+				if !ok {
+					// the new canonical blocks are fetched again with the next head
+					current = reorg.Start - 1
+					continue
+				}
+			}
+			if reorg.Head < current {
+				current = reorg.Head
+			}
+		case head := <-sub:
+			if head <= current {
+				continue
+			}
+			ok, err := deliver(current+1, head)
+			if err != nil {
+				T.log.Error("error notifying subscription", "error", err)
+				return
+			}
+			if ok {
+				current = head
+			}
+		}
+	}
+}
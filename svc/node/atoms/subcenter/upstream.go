@@ -0,0 +1,220 @@
+package subcenter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"gfx.cafe/open/jrpc"
+	"gfx.cafe/open/jrpc/contrib/codecs/websocket"
+	"gfx.cafe/open/jrpc/contrib/extension/subscription"
+	"gfx.cafe/open/jrpc/pkg/jsonrpc"
+
+	"github.com/gfx-labs/venn/lib/config"
+)
+
+var ErrNoWebsocketRemotes = errors.New("chain has no websocket remotes")
+
+const (
+	// feedBuffer is the number of notifications which may be queued for a client before they are dropped
+	feedBuffer = 256
+	// feedBackoffMin and feedBackoffMax bound the wait between attempts to resubscribe upstream
+	feedBackoffMin = time.Second
+	feedBackoffMax = 30 * time.Second
+)
+
+// feeds shares upstream subscriptions between clients. every distinct subscription of a chain is backed by a single
+// upstream websocket subscription, which is opened for the first client and closed when the last one leaves.
+type feeds struct {
+	log   *slog.Logger
+	feeds map[string]*feed
+	mu    sync.Mutex
+}
+
+type feed struct {
+	log     *slog.Logger
+	chain   *config.Chain
+	remotes []*config.Remote
+	params  []any
+
+	cancel context.CancelFunc
+
+	subs map[int]chan<- json.RawMessage
+	next int
+	mu   sync.Mutex
+}
+
+func newFeeds(log *slog.Logger) *feeds {
+	return &feeds{
+		log:   log,
+		feeds: make(map[string]*feed),
+	}
+}
+
+// subscribe returns the notifications of the upstream subscription with the params
+func (T *feeds) subscribe(chain *config.Chain, params ...any) (<-chan json.RawMessage, func(), error) {
+	var remotes []*config.Remote
+	for _, remote := range chain.Remotes {
+		if remote.WsUrl != "" {
+			remotes = append(remotes, remote)
+		}
+	}
+	if len(remotes) == 0 {
+		return nil, nil, ErrNoWebsocketRemotes
+	}
+
+	key, err := json.Marshal(params)
+	if err != nil {
+		return nil, nil, err
+	}
+	name := chain.Name + ":" + string(key)
+
+	T.mu.Lock()
+	defer T.mu.Unlock()
+
+	f, ok := T.feeds[name]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		f = &feed{
+			log:     T.log.With("chain", chain.Name, "feed", string(key)),
+			chain:   chain,
+			remotes: remotes,
+			params:  params,
+			cancel:  cancel,
+			subs:    make(map[int]chan<- json.RawMessage),
+		}
+		T.feeds[name] = f
+		go f.run(ctx)
+	}
+
+	f.mu.Lock()
+	id := f.next
+	f.next++
+	ch := make(chan json.RawMessage, feedBuffer)
+	f.subs[id] = ch
+	f.mu.Unlock()
+
+	return ch, func() {
+		T.mu.Lock()
+		defer T.mu.Unlock()
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if _, ok := f.subs[id]; !ok {
+			return
+		}
+		delete(f.subs, id)
+		close(ch)
+		if len(f.subs) == 0 {
+			f.cancel()
+			delete(T.feeds, name)
+		}
+	}, nil
+}
+
+func (T *feed) publish(msg json.RawMessage) {
+	T.mu.Lock()
+	defer T.mu.Unlock()
+
+	for _, sub := range T.subs {
+		select {
+		case sub <- msg:
+		default:
+			T.log.Warn("subscriber is full. dropping notification")
+		}
+	}
+}
+
+// run keeps the upstream subscription alive until the feed is closed, moving to the next remote whenever it fails
+func (T *feed) run(ctx context.Context) {
+	backoff := feedBackoffMin
+	for i := 0; ; i++ {
+		remote := T.remotes[i%len(T.remotes)]
+		start := time.Now()
+		err := T.stream(ctx, remote)
+		if ctx.Err() != nil {
+			return
+		}
+		// a subscription which stayed up for a while is not failing, so start the backoff over
+		if time.Since(start) > feedBackoffMax {
+			backoff = feedBackoffMin
+		}
+		T.log.Warn("upstream subscription closed. resubscribing", "remote", remote.Name, "error", err, "backoff", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, feedBackoffMax)
+	}
+}
+
+// stream subscribes upstream on the remote and publishes every notification until the subscription fails
+func (T *feed) stream(ctx context.Context, remote *config.Remote) error {
+	conn, err := jrpc.DialContext(ctx, string(remote.WsUrl))
+	if err != nil {
+		return fmt.Errorf("dial: %w", err)
+	}
+	defer conn.Close()
+	if cc, ok := conn.(*websocket.Client); ok {
+		for key, value := range remote.Headers {
+			cc.SetHeader(key, value)
+		}
+	}
+
+	subscriber, err := subscription.UpgradeConn(conn, nil)
+	if err != nil {
+		return err
+	}
+	ch := make(chan json.RawMessage)
+	sub, err := subscriber.Subscribe(ctx, "eth", ch, T.params)
+	if err != nil {
+		return fmt.Errorf("subscribe: %w", err)
+	}
+	defer func() {
+		_ = sub.Unsubscribe()
+	}()
+	T.log.Info("upstream subscription opened", "remote", remote.Name)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-sub.Err():
+			return err
+		case msg := <-ch:
+			T.publish(msg)
+		}
+	}
+}
+
+// serveUpstream forwards the notifications of a shared upstream subscription to the client
+func (T *Subcenter) serveUpstream(w jsonrpc.ResponseWriter, r *jsonrpc.Request, chain *config.Chain, notifier *subscription.Notifier, params ...any) {
+	ch, done, err := T.feeds.subscribe(chain, params...)
+	if err != nil {
+		_ = w.Send(nil, err)
+		return
+	}
+	defer done()
+
+	w.Send(notifier.ID(), nil)
+	for {
+		select {
+		case <-r.Context().Done():
+			T.log.Info("context closed. closing subscription")
+			return
+		case err := <-notifier.Err():
+			T.log.Error("notifier error. subscription closing.", "error", err)
+			return
+		case msg := <-ch:
+			if err := notifier.Notify(msg); err != nil {
+				T.log.Error("error notifying subscription", "error", err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package vennstore
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/gfx-labs/venn/lib/config"
+	"github.com/gfx-labs/venn/lib/stores/blockstore"
+	"github.com/gfx-labs/venn/lib/stores/headstore"
+)
+
+// maxApplied is the number of reorgs applied by this replica which are remembered per chain
+const maxApplied = 16
+
+// Reorgs invalidates the orphaned blocks of reorgs in the stores and then passes the reorgs on to its own subscribers.
+// subscribing here instead of to the headstore guarantees that the stores no longer hold orphaned entries by the time
+// the reorg is received.
+//
+// the replica which finds a reorg applies it to every store before it publishes the new head. the other replicas only
+// drop the orphaned blocks from the stores of their own once they receive the reorg through the headstore, since
+// invalidating the shared stores again could drop the entries of the new canonical blocks which were prefetched since.
+type Reorgs struct {
+	log         *slog.Logger
+	headstore   headstore.Store
+	invalidator blockstore.Invalidator
+	local       blockstore.Invalidator
+
+	// seqs counts the reorgs of every chain
+	seqs map[string]uint64
+	// applied holds the recent reorgs of every chain which were applied by this replica, which are skipped when they
+	// come back through the headstore
+	applied map[string][]reorgKey
+
+	subs map[string]map[int]chan<- headstore.Reorg
+	next int
+	mu   sync.Mutex
+}
+
+type reorgKey struct {
+	Start hexutil.Uint64
+	End   hexutil.Uint64
+	Head  hexutil.Uint64
+	Last  common.Hash
+}
+
+func keyOfReorg(reorg headstore.Reorg) reorgKey {
+	key := reorgKey{
+		Start: reorg.Start,
+		End:   reorg.End,
+		Head:  reorg.Head,
+	}
+	if len(reorg.Orphaned) > 0 {
+		key.Last = reorg.Orphaned[len(reorg.Orphaned)-1]
+	}
+	return key
+}
+
+// NewReorgs creates the reorgs of the stores. invalidator holds every store, and local the ones which are private to
+// this replica
+func NewReorgs(log *slog.Logger, head headstore.Store, invalidator, local blockstore.Invalidator) *Reorgs {
+	return &Reorgs{
+		log:         log,
+		headstore:   head,
+		invalidator: invalidator,
+		local:       local,
+		seqs:        make(map[string]uint64),
+		applied:     make(map[string][]reorgKey),
+		subs:        make(map[string]map[int]chan<- headstore.Reorg),
+	}
+}
+
+// Apply invalidates the orphaned blocks of a reorg found by this replica in every store, passes it on to the
+// subscribers and publishes it to the other replicas. the orphaned blocks are invalidated by the time it returns, so
+// the new head may be published after.
+func (T *Reorgs) Apply(ctx context.Context, chain *config.Chain, reorg headstore.Reorg) error {
+	T.mu.Lock()
+	T.seqs[chain.Name]++
+	applied := append(T.applied[chain.Name], keyOfReorg(reorg))
+	if len(applied) > maxApplied {
+		applied = applied[len(applied)-maxApplied:]
+	}
+	T.applied[chain.Name] = applied
+	T.mu.Unlock()
+
+	err := T.invalidate(ctx, chain, reorg, T.invalidator)
+	T.publish(chain, reorg)
+	// the other replicas are told even if some store failed, so that they still drop the orphaned blocks
+	return errors.Join(err, T.headstore.PutReorg(ctx, chain, reorg))
+}
+
+// wasApplied returns whether the reorg was applied by this replica, and forgets it if so
+func (T *Reorgs) wasApplied(chain *config.Chain, reorg headstore.Reorg) bool {
+	T.mu.Lock()
+	defer T.mu.Unlock()
+
+	key := keyOfReorg(reorg)
+	for i, v := range T.applied[chain.Name] {
+		if v == key {
+			T.applied[chain.Name] = append(T.applied[chain.Name][:i], T.applied[chain.Name][i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (T *Reorgs) invalidate(ctx context.Context, chain *config.Chain, reorg headstore.Reorg, invalidator blockstore.Invalidator) error {
+	T.log.Info("invalidating orphaned blocks",
+		"chain", chain.Name,
+		"start", reorg.Start, "end", reorg.End,
+		"head", reorg.Head,
+	)
+	err := invalidator.Invalidate(ctx, chain, blockstore.QueryRange{
+		Start: reorg.Start,
+		End:   reorg.End,
+	})
+	if err != nil {
+		T.log.Error("failed to invalidate orphaned blocks", "chain", chain.Name, "error", err)
+	}
+	return err
+}
+
+// subscribe subscribes to the reorgs of the chain published to the headstore, which run then applies
+func (T *Reorgs) subscribe(chain *config.Chain) (<-chan headstore.Reorg, func()) {
+	return T.headstore.OnReorg(chain)
+}
+
+func (T *Reorgs) run(ctx context.Context, chain *config.Chain, reorgs <-chan headstore.Reorg, done func()) {
+	defer done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case reorg, ok := <-reorgs:
+			if !ok {
+				return
+			}
+			if T.wasApplied(chain, reorg) {
+				continue
+			}
+			T.mu.Lock()
+			T.seqs[chain.Name]++
+			T.mu.Unlock()
+			_ = T.invalidate(ctx, chain, reorg, T.local)
+			T.publish(chain, reorg)
+		}
+	}
+}
+
+// Seq returns the number of reorgs of the chain seen so far. it is incremented before the orphaned blocks are
+// invalidated, so a result fetched while it did not change can not be from an orphaned block which was already
+// invalidated.
+func (T *Reorgs) Seq(chain *config.Chain) uint64 {
+	T.mu.Lock()
+	defer T.mu.Unlock()
+
+	return T.seqs[chain.Name]
+}
+
+// publish passes the reorg on to the subscribers. a subscriber which can not keep up is unsubscribed, which ends its
+// subscription instead of leaving it to miss the reorg
+func (T *Reorgs) publish(chain *config.Chain, reorg headstore.Reorg) {
+	T.mu.Lock()
+	defer T.mu.Unlock()
+
+	for id, sub := range T.subs[chain.Name] {
+		select {
+		case sub <- reorg:
+		default:
+			T.log.Warn("reorg subscriber is full. unsubscribing it", "chain", chain.Name)
+			delete(T.subs[chain.Name], id)
+			close(sub)
+		}
+	}
+}
+
+// On subscribes to the reorgs of the chain, after their orphaned blocks have been invalidated
+func (T *Reorgs) On(chain *config.Chain) (<-chan headstore.Reorg, func()) {
+	T.mu.Lock()
+	defer T.mu.Unlock()
+
+	id := T.next
+	T.next++
+
+	if T.subs[chain.Name] == nil {
+		T.subs[chain.Name] = make(map[int]chan<- headstore.Reorg)
+	}
+	ch := make(chan headstore.Reorg, 8)
+	T.subs[chain.Name][id] = ch
+
+	return ch, func() {
+		T.mu.Lock()
+		defer T.mu.Unlock()
+
+		if _, ok := T.subs[chain.Name][id]; ok {
+			delete(T.subs[chain.Name], id)
+			close(ch)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package vennstore
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gfx-labs/venn/lib/config"
+	"github.com/gfx-labs/venn/lib/stores/blockstore"
+	"github.com/gfx-labs/venn/lib/stores/headstore"
+)
+
+// recordingInvalidator records the ranges it invalidates
+type recordingInvalidator struct {
+	ranges chan blockstore.QueryRange
+}
+
+func newRecordingInvalidator() *recordingInvalidator {
+	return &recordingInvalidator{ranges: make(chan blockstore.QueryRange, 16)}
+}
+
+func (T *recordingInvalidator) Invalidate(_ context.Context, _ *config.Chain, query blockstore.QueryRange) error {
+	T.ranges <- query
+	return nil
+}
+
+func newTestReorgs(t *testing.T) (*Reorgs, *headstore.Atomic, *recordingInvalidator, *recordingInvalidator) {
+	head := headstore.NewAtomic()
+	all, local := newRecordingInvalidator(), newRecordingInvalidator()
+	reorgs := NewReorgs(slog.New(slog.NewJSONHandler(io.Discard, nil)), head, all, local)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	chain := &config.Chain{Name: "test"}
+	sub, done := reorgs.subscribe(chain)
+	go reorgs.run(ctx, chain, sub, done)
+	return reorgs, head, all, local
+}
+
+func testReorg(head hexutil.Uint64) headstore.Reorg {
+	return headstore.Reorg{
+		Start:    head - 2,
+		End:      head - 1,
+		Orphaned: []common.Hash{{1}, {2}},
+		Head:     head,
+	}
+}
+
+func TestReorgs_Apply(t *testing.T) {
+	reorgs, _, all, local := newTestReorgs(t)
+	chain := &config.Chain{Name: "test"}
+	sub, done := reorgs.On(chain)
+	defer done()
+
+	require.NoError(t, reorgs.Apply(context.Background(), chain, testReorg(10)))
+	// every store is invalidated before Apply returns
+	select {
+	case query := <-all.ranges:
+		require.Equal(t, blockstore.QueryRange{Start: 8, End: 9}, query)
+	default:
+		t.Fatal("the stores were not invalidated")
+	}
+	require.Equal(t, testReorg(10), <-sub)
+	require.EqualValues(t, 1, reorgs.Seq(chain))
+
+	// and the reorg coming back through the headstore is not applied again
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case query := <-local.ranges:
+		t.Fatalf("invalidated again %v", query)
+	case reorg := <-sub:
+		t.Fatalf("published again %v", reorg)
+	default:
+	}
+	require.EqualValues(t, 1, reorgs.Seq(chain))
+}
+
+func TestReorgs_FromOtherReplica(t *testing.T) {
+	reorgs, head, all, local := newTestReorgs(t)
+	chain := &config.Chain{Name: "test"}
+	sub, done := reorgs.On(chain)
+	defer done()
+
+	// a reorg found by another replica only drops the orphaned blocks from the stores of this one
+	require.NoError(t, head.PutReorg(context.Background(), chain, testReorg(10)))
+	require.Equal(t, testReorg(10), <-sub)
+	require.Equal(t, blockstore.QueryRange{Start: 8, End: 9}, <-local.ranges)
+	select {
+	case query := <-all.ranges:
+		t.Fatalf("invalidated the shared stores %v", query)
+	default:
+	}
+	require.EqualValues(t, 1, reorgs.Seq(chain))
+}
+
+func TestReorgs_LaggingSubscriber(t *testing.T) {
+	reorgs, _, _, _ := newTestReorgs(t)
+	chain := &config.Chain{Name: "test"}
+	sub, done := reorgs.On(chain)
+	defer done()
+
+	// a subscriber which does not keep up is unsubscribed instead of missing reorgs
+	for i := range 9 {
+		require.NoError(t, reorgs.Apply(context.Background(), chain, testReorg(hexutil.Uint64(10+i))))
+	}
+	var got int
+	for range sub {
+		got++
+	}
+	require.Equal(t, 8, got)
+}
@@ -1,14 +1,17 @@
 package vennstore
 
 import (
+	"context"
 	"log/slog"
 
 	"github.com/gfx-labs/venn/lib/config"
 	"github.com/gfx-labs/venn/lib/stores/blockstore"
+	"github.com/gfx-labs/venn/lib/stores/headstore"
 
 	"go.uber.org/fx"
 
 	"github.com/gfx-labs/venn/svc/node/stores/vennstores/chainblock"
+	"github.com/gfx-labs/venn/svc/node/stores/vennstores/diskblock"
 	"github.com/gfx-labs/venn/svc/node/stores/vennstores/rediblock"
 )
 
@@ -17,10 +20,12 @@ type Params struct {
 
 	Lc fx.Lifecycle
 
-	Log    *slog.Logger
-	Chains map[string]*config.Chain
+	Log       *slog.Logger
+	Chains    map[string]*config.Chain
+	Headstore headstore.Store
 
 	Rediblock  *rediblock.Rediblock `optional:"true"`
+	Diskblock  *diskblock.Diskblock `optional:"true"`
 	Chainblock *chainblock.Chainblock
 }
 
@@ -28,19 +33,42 @@ type Result struct {
 	fx.Out
 
 	Blockstore blockstore.Store
+	Reorgs     *Reorgs
 }
 
 func New(p Params) (r Result, err error) {
+	lru := blockstore.NewLruStore(2048)
 	compoundStore := blockstore.NewCompoundStore(p.Log)
-	compoundStore.AddStore(
-		"lru",
-		blockstore.NewLruStore(2048),
-	)
+	compoundStore.AddStore("lru", lru)
+	// the stores which are private to this replica
+	localStore := blockstore.NewCompoundStore(p.Log)
+	localStore.AddStore("lru", lru)
 	if p.Rediblock != nil {
 		compoundStore.AddStore("rediblock", p.Rediblock)
 	}
+	if p.Diskblock != nil {
+		compoundStore.AddStore("diskblock", p.Diskblock)
+		localStore.AddStore("diskblock", p.Diskblock)
+	}
 	compoundStore.AddStore("blockgetter", p.Chainblock)
-	r.Blockstore = blockstore.NewSingleFlight(compoundStore)
+	store := blockstore.NewSingleFlight(compoundStore)
+	r.Blockstore = store
+
+	r.Reorgs = NewReorgs(p.Log.With("module", "reorgs"), p.Headstore, store, localStore)
+	ctx, cancel := context.WithCancel(context.Background())
+	p.Lc.Append(fx.Hook{
+		OnStart: func(_ context.Context) error {
+			for _, chain := range p.Chains {
+				reorgs, done := r.Reorgs.subscribe(chain)
+				go r.Reorgs.run(ctx, chain, reorgs, done)
+			}
+			return nil
+		},
+		OnStop: func(_ context.Context) error {
+			cancel()
+			return nil
+		},
+	})
 
 	return
 }
@@ -0,0 +1,110 @@
+package deduper
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"gfx.cafe/open/jrpc"
+	"go.uber.org/fx"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/gfx-labs/venn/lib/jrpcutil"
+	"github.com/gfx-labs/venn/lib/subctx"
+	"github.com/gfx-labs/venn/svc/shared/services/prom"
+)
+
+// neverDedup are methods which change state, or whose result depends on more than their params
+var neverDedup = map[string]bool{
+	"eth_sendRawTransaction":          true,
+	"eth_sendTransaction":             true,
+	"eth_subscribe":                   true,
+	"eth_unsubscribe":                 true,
+	"eth_newFilter":                   true,
+	"eth_newBlockFilter":              true,
+	"eth_newPendingTransactionFilter": true,
+	"eth_getFilterChanges":            true,
+	"eth_getFilterLogs":               true,
+	"eth_uninstallFilter":             true,
+}
+
+// sharedTimeout bounds a shared call, which outlives the request that started it
+const sharedTimeout = 30 * time.Second
+
+// Deduper makes concurrent identical requests share a single call and its result
+type Deduper struct {
+	group   singleflight.Group
+	timeout time.Duration
+}
+
+type Params struct {
+	fx.In
+}
+
+type Result struct {
+	fx.Out
+
+	Deduper *Deduper
+}
+
+func New(_ Params) (r Result, err error) {
+	r.Deduper = &Deduper{
+		timeout: sharedTimeout,
+	}
+	return
+}
+
+type dedupResult struct {
+	result any
+	err    error
+}
+
+func (T *Deduper) Middleware(next jrpc.Handler) jrpc.Handler {
+	return jrpc.HandlerFunc(func(w jrpc.ResponseWriter, r *jrpc.Request) {
+		if neverDedup[r.Method] || strings.HasSuffix(r.Method, "_subscribe") {
+			next.ServeRPC(w, r)
+			return
+		}
+		chain, err := subctx.GetChain(r.Context())
+		if err != nil {
+			next.ServeRPC(w, r)
+			return
+		}
+		params, err := jrpcutil.CanonicalJSON(r.Params)
+		if err != nil {
+			// let the rest of the pipeline report the invalid params
+			next.ServeRPC(w, r)
+			return
+		}
+
+		key := chain.Name + "\x00" + r.Method + "\x00" + params
+		var leader bool
+		ch := T.group.DoChan(key, func() (any, error) {
+			leader = true
+			// the call is shared, so it must not be cancelled just because the first caller went away. it is bounded
+			// instead, so that a call which never returns does not hold up every later identical request
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), T.timeout)
+			defer cancel()
+			var icept jrpcutil.Interceptor
+			next.ServeRPC(&icept, r.WithContext(ctx))
+			return dedupResult{
+				result: icept.Result,
+				err:    icept.Error,
+			}, nil
+		})
+
+		select {
+		case res := <-ch:
+			if res.Shared && !leader {
+				prom.Dedup.Hits(prom.DedupLabel{
+					Chain:  chain.Name,
+					Method: r.Method,
+				}).Inc()
+			}
+			out := res.Val.(dedupResult)
+			_ = w.Send(out.result, out.err)
+		case <-r.Context().Done():
+			_ = w.Send(nil, r.Context().Err())
+		}
+	})
+}
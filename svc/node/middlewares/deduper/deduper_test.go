@@ -0,0 +1,131 @@
+package deduper
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gfx.cafe/open/jrpc"
+	"gfx.cafe/open/jrpc/pkg/jsonrpc"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gfx-labs/venn/lib/config"
+	"github.com/gfx-labs/venn/lib/jrpcutil"
+	"github.com/gfx-labs/venn/lib/subctx"
+)
+
+// testHandler answers with the number of calls it served, once released
+type testHandler struct {
+	calls   atomic.Int64
+	started chan struct{}
+	release chan struct{}
+	ctxErr  chan error
+}
+
+func newTestHandler() *testHandler {
+	return &testHandler{
+		started: make(chan struct{}, 16),
+		release: make(chan struct{}),
+		ctxErr:  make(chan error, 16),
+	}
+}
+
+func (T *testHandler) ServeRPC(w jrpc.ResponseWriter, r *jrpc.Request) {
+	call := T.calls.Add(1)
+	T.started <- struct{}{}
+	select {
+	case <-T.release:
+		T.ctxErr <- r.Context().Err()
+		_ = w.Send(call, nil)
+	case <-r.Context().Done():
+		T.ctxErr <- r.Context().Err()
+		_ = w.Send(nil, r.Context().Err())
+	}
+}
+
+// serve sends the request through the deduper in the background, and returns its response once done
+func serve(t *testing.T, h jrpc.Handler, ctx context.Context, method string, params any) <-chan *jrpcutil.Interceptor {
+	ctx = subctx.WithChain(ctx, &config.Chain{Name: "test"})
+	r, err := jsonrpc.NewRequest(ctx, jsonrpc.NewNullIDPtr(), method, params)
+	require.NoError(t, err)
+	done := make(chan *jrpcutil.Interceptor, 1)
+	go func() {
+		var icept jrpcutil.Interceptor
+		h.ServeRPC(&icept, r)
+		done <- &icept
+	}()
+	return done
+}
+
+func TestDeduper_Shares(t *testing.T) {
+	handler := newTestHandler()
+	h := (&Deduper{timeout: time.Second}).Middleware(handler)
+
+	first := serve(t, h, context.Background(), "eth_getBalance", []any{"0xAB", "latest"})
+	<-handler.started
+	// the same request, written differently, joins the call in flight
+	second := serve(t, h, context.Background(), "eth_getBalance", []any{"0xab", "latest"})
+	// while other requests do not
+	other := serve(t, h, context.Background(), "eth_getBalance", []any{"0xcd", "latest"})
+	<-handler.started
+	time.Sleep(20 * time.Millisecond)
+	close(handler.release)
+
+	a, b := <-first, <-second
+	require.NoError(t, a.Error)
+	require.NoError(t, b.Error)
+	require.Equal(t, a.Result, b.Result)
+	require.NoError(t, (<-other).Error)
+	require.EqualValues(t, 2, handler.calls.Load())
+}
+
+func TestDeduper_NeverDedup(t *testing.T) {
+	handler := newTestHandler()
+	h := (&Deduper{timeout: time.Second}).Middleware(handler)
+
+	first := serve(t, h, context.Background(), "eth_sendRawTransaction", []any{"0x01"})
+	second := serve(t, h, context.Background(), "eth_sendRawTransaction", []any{"0x01"})
+	<-handler.started
+	<-handler.started
+	close(handler.release)
+	require.NotEqual(t, (<-first).Result, (<-second).Result)
+}
+
+func TestDeduper_CancelledLeader(t *testing.T) {
+	handler := newTestHandler()
+	h := (&Deduper{timeout: time.Second}).Middleware(handler)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := serve(t, h, ctx, "eth_blockNumber", nil)
+	<-handler.started
+	follower := serve(t, h, context.Background(), "eth_blockNumber", nil)
+	time.Sleep(20 * time.Millisecond)
+
+	// the leader going away answers it, but the shared call goes on for the follower
+	cancel()
+	require.ErrorIs(t, (<-leader).Error, context.Canceled)
+	close(handler.release)
+	require.NoError(t, <-handler.ctxErr)
+	res := <-follower
+	require.NoError(t, res.Error)
+	require.EqualValues(t, 1, res.Result)
+	require.EqualValues(t, 1, handler.calls.Load())
+}
+
+func TestDeduper_Timeout(t *testing.T) {
+	handler := newTestHandler()
+	h := (&Deduper{timeout: 20 * time.Millisecond}).Middleware(handler)
+
+	// a shared call which never returns is bounded, even though no caller has a deadline
+	res := <-serve(t, h, context.Background(), "eth_blockNumber", nil)
+	require.ErrorIs(t, res.Error, context.DeadlineExceeded)
+
+	// and the next request makes a new call
+	next := serve(t, h, context.Background(), "eth_blockNumber", nil)
+	<-handler.started
+	<-handler.started
+	close(handler.release)
+	require.NoError(t, (<-next).Error)
+	require.EqualValues(t, 2, handler.calls.Load())
+}
@@ -16,7 +16,7 @@ import (
 	"go.uber.org/fx"
 )
 
-// HeadReplacer is a middleware that replaces "latest" block tags with actual block numbers
+// HeadReplacer is a middleware that replaces "latest", "safe" and "finalized" block tags with actual block numbers
 type HeadReplacer struct {
 	headstore headstore.Store
 	chains    map[string]*config.Chain
@@ -54,7 +54,21 @@ func (h *HeadReplacer) toNumericBlockNumber(ctx context.Context, chain *config.C
 			return 0, true, nil
 		}
 		return ethtypes.BlockNumber(head), false, nil
-	case ethtypes.LatestExecutedBlockNumber, ethtypes.PendingBlockNumber, ethtypes.SafeBlockNumber, ethtypes.FinalizedBlockNumber:
+	case ethtypes.SafeBlockNumber, ethtypes.FinalizedBlockNumber:
+		heads, err := h.headstore.GetHeads(ctx, chain)
+		if err != nil {
+			return 0, true, err
+		}
+		head := heads.Safe
+		if *blockNumber == ethtypes.FinalizedBlockNumber {
+			head = heads.Finalized
+		}
+		// not known yet, or the chain does not have it
+		if head == 0 {
+			return 0, true, nil
+		}
+		return ethtypes.BlockNumber(head), false, nil
+	case ethtypes.LatestExecutedBlockNumber, ethtypes.PendingBlockNumber:
 		return 0, true, nil
 	default:
 		return 0, true, nil
@@ -62,7 +76,8 @@ func (h *HeadReplacer) toNumericBlockNumber(ctx context.Context, chain *config.C
 }
 
 // ReplaceBlockNumberInRequest is a helper function that replaces block number parameters in a request.
-// It handles eth_call, eth_getBlockByNumber, and eth_getBlockReceipts methods.
+// It handles eth_call, eth_getBalance, eth_getCode, eth_getStorageAt, eth_getBlockByNumber, eth_getBlockReceipts and
+// eth_getTransactionByBlockNumberAndIndex methods.
 // The blockParamIndex specifies which parameter contains the block number (0-indexed).
 // Returns the original request if no replacement is needed, or a new request with replaced params.
 func (h *HeadReplacer) ReplaceBlockNumberInRequest(ctx context.Context, r *jrpc.Request, blockParamIndex int) (*jrpc.Request, error) {
@@ -147,7 +162,7 @@ func (h *HeadReplacer) Middleware(next jrpc.Handler) jrpc.Handler {
 			}
 			next.ServeRPC(w, newReq)
 			return
-		case "eth_getBlockReceipts":
+		case "eth_getBlockReceipts", "eth_getTransactionByBlockNumberAndIndex":
 			newReq, err := h.ReplaceBlockNumberInRequest(r.Context(), r, 0)
 			if err != nil {
 				_ = w.Send(nil, err)
@@ -155,7 +170,7 @@ func (h *HeadReplacer) Middleware(next jrpc.Handler) jrpc.Handler {
 			}
 			next.ServeRPC(w, newReq)
 			return
-		case "eth_call":
+		case "eth_call", "eth_getBalance", "eth_getCode":
 			newReq, err := h.ReplaceBlockNumberInRequest(r.Context(), r, 1)
 			if err != nil {
 				_ = w.Send(nil, err)
@@ -163,6 +178,14 @@ func (h *HeadReplacer) Middleware(next jrpc.Handler) jrpc.Handler {
 			}
 			next.ServeRPC(w, newReq)
 			return
+		case "eth_getStorageAt":
+			newReq, err := h.ReplaceBlockNumberInRequest(r.Context(), r, 2)
+			if err != nil {
+				_ = w.Send(nil, err)
+				return
+			}
+			next.ServeRPC(w, newReq)
+			return
 		case "eth_getLogs":
 			// replace latest for current head
 			var request []ethtypes.FilterQuery
@@ -30,7 +30,7 @@ type RemoteTarget struct {
 	InputData     *callcenter.InputData
 	Collector     *callcenter.Collector
 	Logger        *callcenter.Logger
-	Backer        *callcenter.Backer
+	Breaker       *callcenter.Breaker
 	Validator     *callcenter.Validator
 	Doctor        *callcenter.Doctor
 	RateLimiter   *callcenter.Ratelimiter
@@ -82,7 +82,7 @@ func NewRemoteTarget(cfg *config.Remote, chain *config.Chain, log *slog.Logger,
 			}
 		}
 		return c, nil
-	})
+	}).WithBatcher(callcenter.NewBatcher(chain.Name, cfg.Name, cfg.Batch))
 
 	mw := &RemoteTarget{
 		BaseProxy: proxier,
@@ -94,14 +94,18 @@ func NewRemoteTarget(cfg *config.Remote, chain *config.Chain, log *slog.Logger,
 		Logger: callcenter.NewLogger(
 			log.With("remote", cfg.Name, "chain", chain.Name),
 		),
-		Backer: callcenter.NewBacker(
+		Breaker: callcenter.NewBreaker(
 			log.With("remote", cfg.Name, "chain", chain.Name),
+			chain.Name,
+			cfg.Name,
 			cfg.RateLimitBackoff.Duration,
 			cfg.ErrorBackoffMin.Duration,
 			cfg.ErrorBackoffMax.Duration,
+			cfg.Circuit,
 		),
 		Validator: callcenter.NewValidator(
 			max(time.Minute, time.Duration(float64(time.Second)*2*chain.BlockTimeSeconds)),
+			chain.HeadLagThreshold,
 		),
 		Doctor: callcenter.NewDoctor(
 			log.With("remote", cfg.Name, "chain", chain.Name),
@@ -168,7 +172,10 @@ func New(params Params) (r Result, err error) {
 	})
 
 	for _, chain := range params.Chains {
-		cluster := callcenter.NewCluster()
+		cluster := callcenter.NewCluster(
+			callcenter.NewStrategy(chain.SelectionStrategy),
+			callcenter.NewHedger(chain.Name, chain.Hedge),
+		)
 		r.Clusters.Remotes[chain.Name] = cluster
 		// Initialize the nested map for this chain
 		r.Clusters.middlewares[chain.Name] = make(map[string]*RemoteTarget)
@@ -196,7 +203,7 @@ func New(params Params) (r Result, err error) {
 
 					remote = mw.Collector.Middleware(remote)
 					remote = mw.Logger.Middleware(remote)
-					remote = mw.Backer.Middleware(remote)
+					remote = mw.Breaker.Middleware(remote)
 					remote = mw.Validator.Middleware(remote)
 					remote = mw.Doctor.Middleware(remote)
 					remote = mw.RateLimiter.Middleware(remote)
@@ -208,6 +215,8 @@ func New(params Params) (r Result, err error) {
 					}
 
 					remoteWithConfig := callcenter.NewRemoteWithConfig(remote, cfg)
+					remoteWithConfig.Collector = mw.Collector
+					remoteWithConfig.Behind = mw.Validator.IsBehind
 					cluster.Add(cfg.Priority, remoteWithConfig)
 
 					return nil
@@ -0,0 +1,339 @@
+package natshead
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/nats-io/nats.go/jetstream"
+	"go.uber.org/fx"
+
+	"github.com/gfx-labs/venn/lib/config"
+	"github.com/gfx-labs/venn/lib/stores/headstore"
+	"github.com/gfx-labs/venn/svc/shared/services/gnat"
+)
+
+// Head is a head published on the stream. heads which the message does not carry are zero. Fence is the fencing token
+// the heads were put under, or zero if there was none
+type Head struct {
+	Chain string `json:"chain"`
+	Fence uint64 `json:"fence,omitempty"`
+	headstore.Heads
+}
+
+// ReorgMessage is a reorg published on the stream
+type ReorgMessage struct {
+	Chain string          `json:"chain"`
+	Reorg headstore.Reorg `json:"reorg"`
+}
+
+const (
+	// headsPerSubject is the number of messages kept for every subject. only the last one is read at start
+	headsPerSubject = 16
+	// streamMaxAge is how long messages are kept. the heads of a chain which was not stalked for longer are unknown
+	streamMaxAge = 24 * time.Hour
+)
+
+type Params struct {
+	fx.In
+
+	Log    *slog.Logger
+	Ctx    context.Context
+	Config *config.Nats `optional:"true"`
+	Gnat   *gnat.Gnat   `optional:"true"`
+}
+
+type Result struct {
+	fx.Out
+
+	Result *Natshead `optional:"true"`
+}
+
+// Natshead shares the heads through a jetstream stream. the latest head and the finality of every chain are
+// published on subjects of their own, so that the last message of each is enough to know the heads at start.
+type Natshead struct {
+	log       *slog.Logger
+	ctx       context.Context
+	js        jetstream.JetStream
+	namespace string
+	stream    string
+
+	head   map[string]headstore.Heads
+	fence  map[string]uint64
+	headMu sync.RWMutex
+
+	subs map[string]map[int]chan<- hexutil.Uint64
+	next int
+	mu   sync.Mutex
+
+	reorgs headstore.ReorgFeed
+}
+
+func New(params Params) (r Result, err error) {
+	if params.Config == nil || !params.Config.Headstore {
+		params.Log.Info("natshead disabled", "reason", "not selected")
+		return
+	}
+	if params.Gnat == nil {
+		return r, errors.New("natshead: no nats connection")
+	}
+
+	js, err := jetstream.New(params.Gnat.Conn())
+	if err != nil {
+		return r, err
+	}
+	o := &Natshead{
+		log:       params.Log,
+		ctx:       params.Ctx,
+		js:        js,
+		namespace: params.Config.Namespace,
+		stream:    streamName(params.Config.Namespace),
+		head:      make(map[string]headstore.Heads),
+		fence:     make(map[string]uint64),
+	}
+
+	ctx, cancel := context.WithTimeout(params.Ctx, 10*time.Second)
+	defer cancel()
+	_, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name: o.stream,
+		Subjects: []string{
+			o.namespace + ".head.>",
+			o.namespace + ".reorg.>",
+		},
+		MaxMsgsPerSubject: headsPerSubject,
+		MaxAge:            streamMaxAge,
+		Discard:           jetstream.DiscardOld,
+	})
+	if err != nil {
+		return r, fmt.Errorf("create head stream: %w", err)
+	}
+
+	r.Result = o
+	go o.start()
+	go o.startReorgs()
+	return
+}
+
+// streamName returns the name of the stream of the namespace. stream names may not hold dots, spaces or wildcards
+func streamName(namespace string) string {
+	return strings.NewReplacer(".", "_", " ", "_", "*", "_", ">", "_").Replace(namespace) + "_heads"
+}
+
+func (T *Natshead) subject(kind string, chain *config.Chain) string {
+	return fmt.Sprintf("%s.%s.%s", T.namespace, kind, chain.Name)
+}
+
+func (T *Natshead) Get(ctx context.Context, chain *config.Chain) (hexutil.Uint64, error) {
+	T.headMu.RLock()
+	defer T.headMu.RUnlock()
+	return T.head[chain.Name].Latest, nil
+}
+
+func (T *Natshead) GetHeads(ctx context.Context, chain *config.Chain) (headstore.Heads, error) {
+	T.headMu.RLock()
+	defer T.headMu.RUnlock()
+	return T.head[chain.Name], nil
+}
+
+func (T *Natshead) Put(ctx context.Context, chain *config.Chain, head hexutil.Uint64) (hexutil.Uint64, error) {
+	was, err := T.Get(ctx, chain)
+	if err != nil {
+		return 0, err
+	}
+	token := headstore.FenceFrom(ctx)
+	if T.fenced(chain.Name, token) {
+		return was, headstore.ErrFenced
+	}
+	// only the last message is read at start, so it must never be behind
+	if head <= was {
+		return was, nil
+	}
+	err = T.publish(ctx, T.subject("head", chain)+".latest", Head{
+		Chain: chain.Name,
+		Fence: token,
+		Heads: headstore.Heads{
+			Latest: head,
+		},
+	})
+	return was, err
+}
+
+func (T *Natshead) PutFinality(ctx context.Context, chain *config.Chain, safe, finalized hexutil.Uint64) error {
+	cur, err := T.GetHeads(ctx, chain)
+	if err != nil {
+		return err
+	}
+	token := headstore.FenceFrom(ctx)
+	if T.fenced(chain.Name, token) {
+		return headstore.ErrFenced
+	}
+	// only the last message is read at start, so it carries both heads even if only one of them moved
+	return T.publish(ctx, T.subject("head", chain)+".finality", Head{
+		Chain: chain.Name,
+		Fence: token,
+		Heads: headstore.Heads{
+			Safe:      max(safe, cur.Safe),
+			Finalized: max(finalized, cur.Finalized),
+		},
+	})
+}
+
+func (T *Natshead) publish(ctx context.Context, subject string, msg any) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = T.js.Publish(ctx, subject, data)
+	return err
+}
+
+// fenced returns whether heads put under token were already taken over by a later one seen on the stream
+func (T *Natshead) fenced(chain string, token uint64) bool {
+	T.headMu.RLock()
+	defer T.headMu.RUnlock()
+	return headstore.Fenced(token, T.fence[chain])
+}
+
+// setHead applies the heads of the message. subscribers are only notified when the latest head moves forward.
+func (T *Natshead) setHead(msg Head) {
+	T.headMu.Lock()
+	// heads put under a lease which was taken over are dropped
+	if headstore.Fenced(msg.Fence, T.fence[msg.Chain]) {
+		T.headMu.Unlock()
+		return
+	}
+	T.fence[msg.Chain] = max(msg.Fence, T.fence[msg.Chain])
+	cur := T.head[msg.Chain]
+	T.head[msg.Chain] = cur.Merge(msg.Heads)
+	T.headMu.Unlock()
+	if msg.Latest <= cur.Latest {
+		return
+	}
+
+	T.mu.Lock()
+	defer T.mu.Unlock()
+	for _, sub := range T.subs[msg.Chain] {
+		select {
+		case sub <- msg.Latest:
+		default:
+		}
+	}
+}
+
+// consume delivers every message of the subjects to handle until ctx is done or the consumer fails
+func (T *Natshead) consume(ctx context.Context, subject string, policy jetstream.DeliverPolicy, handle func(data []byte) error) error {
+	// the ordered consumer recreates itself after a reconnect, resuming after the last delivered message
+	consumer, err := T.js.OrderedConsumer(ctx, T.stream, jetstream.OrderedConsumerConfig{
+		FilterSubjects: []string{subject},
+		DeliverPolicy:  policy,
+	})
+	if err != nil {
+		return err
+	}
+	msgs, err := consumer.Messages()
+	if err != nil {
+		return err
+	}
+	defer msgs.Stop()
+
+	for {
+		msg, err := msgs.Next(jetstream.NextContext(ctx))
+		if err != nil {
+			return err
+		}
+		if err := handle(msg.Data()); err != nil {
+			T.log.Error("message error", "subject", msg.Subject(), "error", err)
+		}
+	}
+}
+
+func (T *Natshead) start() {
+	for {
+		// heads never move backwards, so the last heads of every chain are all that is needed at start
+		err := T.consume(T.ctx, T.namespace+".head.>", jetstream.DeliverLastPerSubjectPolicy, func(data []byte) error {
+			var msg Head
+			if err := json.Unmarshal(data, &msg); err != nil {
+				return err
+			}
+			T.setHead(msg)
+			return nil
+		})
+		select {
+		case <-T.ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+		T.log.Error("head consumer closed. reconnecting", "error", err)
+	}
+}
+
+func (T *Natshead) On(chain *config.Chain) (<-chan hexutil.Uint64, func()) {
+	T.mu.Lock()
+	defer T.mu.Unlock()
+
+	id := T.next
+	T.next++
+
+	if T.subs == nil {
+		T.subs = make(map[string]map[int]chan<- hexutil.Uint64)
+	}
+	if _, ok := T.subs[chain.Name]; !ok {
+		T.subs[chain.Name] = make(map[int]chan<- hexutil.Uint64)
+	}
+	sub := make(chan hexutil.Uint64, 1)
+	T.subs[chain.Name][id] = sub
+	return sub, func() {
+		T.mu.Lock()
+		defer T.mu.Unlock()
+
+		if _, ok := T.subs[chain.Name][id]; ok {
+			delete(T.subs[chain.Name], id)
+			close(sub)
+		}
+	}
+}
+
+func (T *Natshead) PutReorg(ctx context.Context, chain *config.Chain, reorg headstore.Reorg) error {
+	return T.publish(ctx, T.subject("reorg", chain), ReorgMessage{
+		Chain: chain.Name,
+		Reorg: reorg,
+	})
+}
+
+func (T *Natshead) publishReorg(msg ReorgMessage) {
+	if err := T.reorgs.Publish(T.ctx, msg.Chain, msg.Reorg); err != nil {
+		T.log.Error("failed to hand out reorg", "chain", msg.Chain, "error", err)
+	}
+}
+
+func (T *Natshead) startReorgs() {
+	for {
+		// reorgs are only interesting as they happen, so old ones are never replayed
+		err := T.consume(T.ctx, T.namespace+".reorg.>", jetstream.DeliverNewPolicy, func(data []byte) error {
+			var msg ReorgMessage
+			if err := json.Unmarshal(data, &msg); err != nil {
+				return err
+			}
+			T.publishReorg(msg)
+			return nil
+		})
+		select {
+		case <-T.ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+		T.log.Error("reorg consumer closed. reconnecting", "error", err)
+	}
+}
+
+func (T *Natshead) OnReorg(chain *config.Chain) (<-chan headstore.Reorg, func()) {
+	return T.reorgs.Subscribe(chain.Name)
+}
+
+var _ headstore.Store = (*Natshead)(nil)
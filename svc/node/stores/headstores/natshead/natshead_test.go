@@ -0,0 +1,161 @@
+package natshead
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx/fxtest"
+
+	"github.com/gfx-labs/venn/lib/config"
+	"github.com/gfx-labs/venn/lib/stores/headstore"
+	"github.com/gfx-labs/venn/svc/shared/services/gnat"
+)
+
+func runServer(t *testing.T) *server.Server {
+	ns, err := server.NewServer(&server.Options{
+		Port:      server.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+	})
+	require.NoError(t, err)
+	ns.Start()
+	require.True(t, ns.ReadyForConnections(5*time.Second))
+	t.Cleanup(func() {
+		ns.Shutdown()
+		ns.WaitForShutdown()
+	})
+	return ns
+}
+
+func newNatshead(t *testing.T, ctx context.Context, ns *server.Server) *Natshead {
+	log := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	cfg := &config.Nats{
+		URI:       config.SafeUrl(ns.ClientURL()),
+		Namespace: "test",
+		Headstore: true,
+	}
+	g, err := gnat.New(gnat.Params{
+		Config: cfg,
+		Ctx:    ctx,
+		Lc:     fxtest.NewLifecycle(t),
+		Log:    log,
+	})
+	require.NoError(t, err)
+	r, err := New(Params{
+		Log:    log,
+		Ctx:    ctx,
+		Config: cfg,
+		Gnat:   g.Output,
+	})
+	require.NoError(t, err)
+	require.NotNil(t, r.Result)
+	return r.Result
+}
+
+func TestNatshead_Heads(t *testing.T) {
+	ns := runServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	chain := &config.Chain{Name: "ethereum"}
+
+	a := newNatshead(t, ctx, ns)
+	b := newNatshead(t, ctx, ns)
+	heads, done := b.On(chain)
+	defer done()
+
+	_, err := a.Put(ctx, chain, 100)
+	require.NoError(t, err)
+	select {
+	case head := <-heads:
+		require.EqualValues(t, 100, head)
+	case <-time.After(5 * time.Second):
+		t.Fatal("head was not received")
+	}
+
+	// heads never move backwards
+	_, err = a.Put(ctx, chain, 90)
+	require.NoError(t, err)
+	require.NoError(t, a.PutFinality(ctx, chain, 95, 80))
+	require.Eventually(t, func() bool {
+		got, _ := b.GetHeads(ctx, chain)
+		return got == headstore.Heads{Latest: 100, Safe: 95, Finalized: 80}
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// a replica which starts later knows the heads right away
+	c := newNatshead(t, ctx, ns)
+	require.Eventually(t, func() bool {
+		got, _ := c.GetHeads(ctx, chain)
+		return got == headstore.Heads{Latest: 100, Safe: 95, Finalized: 80}
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestNatshead_Reorgs(t *testing.T) {
+	ns := runServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	chain := &config.Chain{Name: "ethereum"}
+
+	a := newNatshead(t, ctx, ns)
+	b := newNatshead(t, ctx, ns)
+	reorgs, done := b.OnReorg(chain)
+	defer done()
+
+	reorg := headstore.Reorg{
+		Start: 10,
+		End:   11,
+		Head:  12,
+	}
+	// the consumer may not be running yet, in which case the reorg is never delivered
+	require.Eventually(t, func() bool {
+		require.NoError(t, a.PutReorg(ctx, chain, reorg))
+		select {
+		case got := <-reorgs:
+			require.Equal(t, reorg, got)
+			return true
+		case <-time.After(100 * time.Millisecond):
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestNatshead_Fence(t *testing.T) {
+	ns := runServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	chain := &config.Chain{Name: "ethereum"}
+
+	deposed := newNatshead(t, ctx, ns)
+	leader := newNatshead(t, ctx, ns)
+
+	_, err := deposed.Put(headstore.WithFence(ctx, 5), chain, 100)
+	require.NoError(t, err)
+	_, err = leader.Put(headstore.WithFence(ctx, 9), chain, 101)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		got, _ := deposed.Get(ctx, chain)
+		return got == 101
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the deposed leader can not put heads once it saw the token of the one which took over
+	_, err = deposed.Put(headstore.WithFence(ctx, 5), chain, 102)
+	require.ErrorIs(t, err, headstore.ErrFenced)
+	require.ErrorIs(t, deposed.PutFinality(headstore.WithFence(ctx, 5), chain, 100, 90), headstore.ErrFenced)
+
+	// heads it published before noticing are dropped by everybody else
+	require.NoError(t, deposed.publish(ctx, deposed.subject("head", chain)+".latest", Head{
+		Chain: chain.Name,
+		Fence: 5,
+		Heads: headstore.Heads{Latest: 200},
+	}))
+	_, err = leader.Put(headstore.WithFence(ctx, 9), chain, 102)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		got, _ := leader.Get(ctx, chain)
+		return got == 102
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -2,6 +2,7 @@ package redihead
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"log/slog"
@@ -17,9 +18,24 @@ import (
 	"github.com/gfx-labs/venn/svc/shared/services/redi"
 )
 
+// Head is a head published on the stream. Value is the latest head, while Safe and Finalized are zero unless the
+// message carries them. Fence is the fencing token the heads were put under, or zero if there was none
 type Head struct {
-	Value uint64
+	Value     uint64
+	Safe      uint64
+	Finalized uint64
+	Chain     string
+	Fence     uint64
+}
+
+// replayCount is the number of the most recent messages read from the stream at start, so that the heads of every
+// chain are known right away
+const replayCount = 256
+
+// ReorgMessage is a reorg published on the stream. the reorg is json encoded
+type ReorgMessage struct {
 	Chain string
+	Value string
 }
 
 type Params struct {
@@ -27,7 +43,8 @@ type Params struct {
 
 	Log    *slog.Logger
 	Ctx    context.Context
-	Redi   *redi.Redis `optional:"true"`
+	Redi   *redi.Redis  `optional:"true"`
+	Nats   *config.Nats `optional:"true"`
 	Chains map[string]*config.Chain
 }
 
@@ -43,12 +60,17 @@ type Redihead struct {
 	ctx    context.Context
 	stream gtrs.Stream[Head]
 
-	head   map[string]uint64
+	reorgStream gtrs.Stream[ReorgMessage]
+
+	head   map[string]headstore.Heads
+	fence  map[string]uint64
 	headMu sync.RWMutex
 
 	subs map[string]map[int]chan<- hexutil.Uint64
 	next int
 	mu   sync.Mutex
+
+	reorgs headstore.ReorgFeed
 }
 
 func New(params Params) (r Result, err error) {
@@ -56,6 +78,10 @@ func New(params Params) (r Result, err error) {
 		params.Log.Info("redihead disabled", "reason", "no redis")
 		return
 	}
+	if params.Nats != nil && params.Nats.Headstore {
+		params.Log.Info("redihead disabled", "reason", "nats headstore selected")
+		return
+	}
 
 	stream := gtrs.NewStream[Head](
 		params.Redi.C(),
@@ -67,20 +93,29 @@ func New(params Params) (r Result, err error) {
 		ctx:    params.Ctx,
 		redi:   params.Redi,
 		stream: stream,
-		head:   make(map[string]uint64),
+		reorgStream: gtrs.NewStream[ReorgMessage](
+			params.Redi.C(),
+			fmt.Sprintf("%s:reorg:stream", params.Redi.Namespace()),
+			&gtrs.Options{MaxLen: 1024, Approx: true},
+		),
+		head:  make(map[string]headstore.Heads),
+		fence: make(map[string]uint64),
 	}
 	go r.Result.start()
+	go r.Result.startReorgs()
 	return
 }
 
 func (T *Redihead) Get(ctx context.Context, chain *config.Chain) (hexutil.Uint64, error) {
 	T.headMu.RLock()
 	defer T.headMu.RUnlock()
-	val, ok := T.head[chain.Name]
-	if !ok {
-		val = 0
-	}
-	return hexutil.Uint64(val), nil
+	return T.head[chain.Name].Latest, nil
+}
+
+func (T *Redihead) GetHeads(ctx context.Context, chain *config.Chain) (headstore.Heads, error) {
+	T.headMu.RLock()
+	defer T.headMu.RUnlock()
+	return T.head[chain.Name], nil
 }
 
 func (T *Redihead) Put(ctx context.Context, chain *config.Chain, head hexutil.Uint64) (hexutil.Uint64, error) {
@@ -88,22 +123,60 @@ func (T *Redihead) Put(ctx context.Context, chain *config.Chain, head hexutil.Ui
 	if err != nil {
 		return 0, err
 	}
+	token := headstore.FenceFrom(ctx)
+	if T.fenced(chain.Name, token) {
+		return was, headstore.ErrFenced
+	}
 	_, err = T.stream.Add(ctx, Head{
 		Value: uint64(head),
 		Chain: chain.Name,
+		Fence: token,
 	})
 	return was, err
 }
 
-func (T *Redihead) setHead(chainName string, head uint64) {
+func (T *Redihead) PutFinality(ctx context.Context, chain *config.Chain, safe, finalized hexutil.Uint64) error {
+	token := headstore.FenceFrom(ctx)
+	if T.fenced(chain.Name, token) {
+		return headstore.ErrFenced
+	}
+	_, err := T.stream.Add(ctx, Head{
+		Safe:      uint64(safe),
+		Finalized: uint64(finalized),
+		Chain:     chain.Name,
+		Fence:     token,
+	})
+	return err
+}
+
+// fenced returns whether heads put under token were already taken over by a later one seen on the stream
+func (T *Redihead) fenced(chain string, token uint64) bool {
+	T.headMu.RLock()
+	defer T.headMu.RUnlock()
+	return headstore.Fenced(token, T.fence[chain])
+}
+
+// setHead applies the heads of the message. subscribers are only notified when the latest head moves forward.
+func (T *Redihead) setHead(msg Head) {
+	chainName := msg.Chain
+	head := msg.Value
 	T.headMu.Lock()
-	cur := T.head[chainName]
-	if head <= cur {
+	// heads put under a lease which was taken over are dropped
+	if headstore.Fenced(msg.Fence, T.fence[chainName]) {
 		T.headMu.Unlock()
 		return
 	}
-	T.head[chainName] = head
+	T.fence[chainName] = max(msg.Fence, T.fence[chainName])
+	cur := T.head[chainName]
+	T.head[chainName] = cur.Merge(headstore.Heads{
+		Latest:    hexutil.Uint64(msg.Value),
+		Safe:      hexutil.Uint64(msg.Safe),
+		Finalized: hexutil.Uint64(msg.Finalized),
+	})
 	T.headMu.Unlock()
+	if hexutil.Uint64(head) <= cur.Latest {
+		return
+	}
 	func() {
 		T.mu.Lock()
 		defer T.mu.Unlock()
@@ -125,7 +198,7 @@ func (T *Redihead) run(ctx context.Context) {
 		ctx,
 		"+",
 		"-",
-		1,
+		replayCount,
 	)
 	if err != nil {
 		T.log.Error("failed to get head", "error", err)
@@ -134,7 +207,10 @@ func (T *Redihead) run(ctx context.Context) {
 
 	var start string
 	if len(messages) > 0 {
-		T.setHead(messages[0].Data.Chain, messages[0].Data.Value)
+		// heads never move backwards, so the order they are applied in does not matter
+		for _, msg := range messages {
+			T.setHead(msg.Data)
+		}
 		start = messages[0].ID
 	} else {
 		start = "$"
@@ -165,7 +241,7 @@ func (T *Redihead) run(ctx context.Context) {
 					continue
 				}
 
-				T.setHead(msg.Data.Chain, msg.Data.Value)
+				T.setHead(msg.Data)
 			}
 		}
 	}
@@ -210,4 +286,72 @@ func (T *Redihead) On(chain *config.Chain) (<-chan hexutil.Uint64, func()) {
 	}
 }
 
+func (T *Redihead) PutReorg(ctx context.Context, chain *config.Chain, reorg headstore.Reorg) error {
+	value, err := json.Marshal(reorg)
+	if err != nil {
+		return err
+	}
+	_, err = T.reorgStream.Add(ctx, ReorgMessage{
+		Chain: chain.Name,
+		Value: string(value),
+	})
+	return err
+}
+
+func (T *Redihead) publishReorg(msg ReorgMessage) {
+	var reorg headstore.Reorg
+	if err := json.Unmarshal([]byte(msg.Value), &reorg); err != nil {
+		T.log.Error("failed to decode reorg", "chain", msg.Chain, "error", err)
+		return
+	}
+
+	if err := T.reorgs.Publish(T.ctx, msg.Chain, reorg); err != nil {
+		T.log.Error("failed to hand out reorg", "chain", msg.Chain, "error", err)
+	}
+}
+
+func (T *Redihead) runReorgs(ctx context.Context) {
+	// reorgs are only interesting as they happen, so old ones are never replayed
+	consumer := gtrs.NewConsumer[ReorgMessage](
+		ctx,
+		T.redi.C(),
+		gtrs.StreamIDs{
+			fmt.Sprintf("%s:reorg:stream", T.redi.Namespace()): "$",
+		},
+	)
+	defer consumer.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-consumer.Chan():
+			if !ok {
+				return
+			}
+			if msg.Err != nil {
+				T.log.Error("reorg message error", "error", msg.Err)
+				continue
+			}
+
+			T.publishReorg(msg.Data)
+		}
+	}
+}
+
+func (T *Redihead) startReorgs() {
+	for {
+		T.runReorgs(T.ctx)
+		select {
+		case <-T.ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func (T *Redihead) OnReorg(chain *config.Chain) (<-chan headstore.Reorg, func()) {
+	return T.reorgs.Subscribe(chain.Name)
+}
+
 var _ headstore.Store = (*Redihead)(nil)
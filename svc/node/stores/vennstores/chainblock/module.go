@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 
 	"github.com/gfx-labs/venn/lib/config"
@@ -14,6 +15,7 @@ import (
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/go-faster/jx"
 	"go.uber.org/fx"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/gfx-labs/venn/lib/ethtypes"
 	"github.com/gfx-labs/venn/lib/jrpcutil"
@@ -22,6 +24,9 @@ import (
 	"github.com/gfx-labs/venn/svc/node/quarks/cluster"
 )
 
+// emptyBlockConcurrency is the number of blocks without logs which have their hash looked up at once
+const emptyBlockConcurrency = 8
+
 type Chainblock struct {
 	log      *slog.Logger
 	clusters *cluster.Clusters
@@ -300,16 +305,42 @@ func (T *Chainblock) getLogs(ctx context.Context, remote jrpc.Handler, query blo
 			}
 		}
 
-		j := 0
+		// a block without logs is only known to exist if a later block has logs, otherwise the remote might not have
+		// it yet. so empty entries are only created up to the last block with logs.
+		last := -1
 		for i, res := range results {
+			if res != nil {
+				last = i
+			}
+		}
+		// the logs do not tell the hash of a block without logs, so it is looked up. entries are stored by their hash, so
+		// empty entries must have the real one
+		var g errgroup.Group
+		g.SetLimit(emptyBlockConcurrency)
+		for i, res := range results[:last+1] {
 			if res != nil {
 				encoders[i].ArrEnd()
 				res.Value = encoders[i].Buf
-				results[j] = res
-				j += 1
+				continue
 			}
+			number := q.Start + hexutil.Uint64(i)
+			g.Go(func() error {
+				hash, err := T.blockHash(ctx, remote, number)
+				if err != nil {
+					return err
+				}
+				results[i] = &blockstore.Entry{
+					BlockHash:   hash,
+					BlockNumber: number,
+					Value:       json.RawMessage("[]"),
+				}
+				return nil
+			})
 		}
-		results = results[:j]
+		if err := g.Wait(); err != nil {
+			return nil, err
+		}
+		results = results[:last+1]
 
 		return results, nil
 	default:
@@ -317,4 +348,18 @@ func (T *Chainblock) getLogs(ctx context.Context, remote jrpc.Handler, query blo
 	}
 }
 
+// blockHash returns the hash of the block with the number
+func (T *Chainblock) blockHash(ctx context.Context, remote jrpc.Handler, number hexutil.Uint64) (common.Hash, error) {
+	var head struct {
+		BlockHash common.Hash `json:"hash"`
+	}
+	if err := jrpcutil.Do(ctx, remote, &head, "eth_getBlockByNumber", []any{number, false}); err != nil {
+		return common.Hash{}, err
+	}
+	if head.BlockHash == (common.Hash{}) {
+		return common.Hash{}, fmt.Errorf("block %d not found", number)
+	}
+	return head.BlockHash, nil
+}
+
 var _ blockstore.Store = (*Chainblock)(nil)
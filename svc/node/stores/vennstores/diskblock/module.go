@@ -0,0 +1,444 @@
+package diskblock
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/fx"
+
+	"github.com/gfx-labs/venn/lib/config"
+	"github.com/gfx-labs/venn/lib/stores/blockstore"
+	"github.com/gfx-labs/venn/lib/stores/headstore"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// pruneBatch is the number of blocks removed from each chain per round when the store is over its size limit
+const pruneBatch = 1024
+
+type Params struct {
+	fx.In
+
+	Config    *config.Diskstore `optional:"true"`
+	Chains    map[string]*config.Chain
+	Headstore headstore.Store
+	Log       *slog.Logger
+	Lc        fx.Lifecycle
+}
+
+type Result struct {
+	fx.Out
+
+	Diskblock *Diskblock `optional:"true"`
+}
+
+// Diskblock stores entries which are finalized, or past the finality depth if the finalized head is not known, in a
+// bbolt database, so that historical data survives
+// restarts and does not need to be fetched from remotes again.
+//
+// every chain has a bucket, which holds two buckets per entry type:
+//   - entries/<type>: big endian block number + block hash -> value
+//   - hashes/<type>: block hash -> big endian block number
+type Diskblock struct {
+	log       *slog.Logger
+	cfg       *config.Diskstore
+	chains    map[string]*config.Chain
+	headstore headstore.Store
+	db        *bolt.DB
+}
+
+func New(p Params) (r Result, err error) {
+	if p.Config == nil {
+		p.Log.Info("diskblock disabled", "reason", "no diskstore configured")
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(p.Config.Path), 0o755); err != nil {
+		return r, err
+	}
+	db, err := bolt.Open(p.Config.Path, 0o600, &bolt.Options{
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		return r, fmt.Errorf("open diskstore: %w", err)
+	}
+	s := &Diskblock{
+		log:       p.Log.With("store", "diskblock"),
+		cfg:       p.Config,
+		chains:    p.Chains,
+		headstore: p.Headstore,
+		db:        db,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.Lc.Append(fx.Hook{
+		OnStart: func(_ context.Context) error {
+			go s.pruneLoop(ctx)
+			return nil
+		},
+		OnStop: func(_ context.Context) error {
+			cancel()
+			return db.Close()
+		},
+	})
+
+	r.Diskblock = s
+	return r, nil
+}
+
+func entriesBucket(typ blockstore.EntryType) []byte {
+	return []byte("entries/" + strconv.Itoa(int(typ)))
+}
+
+func hashesBucket(typ blockstore.EntryType) []byte {
+	return []byte("hashes/" + strconv.Itoa(int(typ)))
+}
+
+func numberKey(number hexutil.Uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(number))
+}
+
+func entryKey(number hexutil.Uint64, hash common.Hash) []byte {
+	return append(numberKey(number), hash.Bytes()...)
+}
+
+func (s *Diskblock) Get(_ context.Context, chain *config.Chain, typ blockstore.EntryType, query blockstore.Query) ([]*blockstore.Entry, error) {
+	var results []*blockstore.Entry
+	err := s.db.View(func(tx *bolt.Tx) error {
+		cb := tx.Bucket([]byte(chain.Name))
+		if cb == nil {
+			return ErrNotFound
+		}
+		entries := cb.Bucket(entriesBucket(typ))
+		hashes := cb.Bucket(hashesBucket(typ))
+		if entries == nil || hashes == nil {
+			return ErrNotFound
+		}
+
+		switch q := query.(type) {
+		case blockstore.QueryHash:
+			hash := common.Hash(q)
+			number := hashes.Get(hash.Bytes())
+			if number == nil {
+				return ErrNotFound
+			}
+			value := entries.Get(append(bytes.Clone(number), hash.Bytes()...))
+			if value == nil {
+				return ErrNotFound
+			}
+			results = []*blockstore.Entry{
+				{
+					BlockHash:   hash,
+					BlockNumber: hexutil.Uint64(binary.BigEndian.Uint64(number)),
+					Value:       bytes.Clone(value),
+				},
+			}
+			return nil
+		case blockstore.QueryRange:
+			if q.End < q.Start {
+				return nil
+			}
+			results = make([]*blockstore.Entry, 0, q.End-q.Start+1)
+			c := entries.Cursor()
+			for i := q.Start; i <= q.End; i++ {
+				prefix := numberKey(i)
+				k, v := c.Seek(prefix)
+				if k == nil || !bytes.HasPrefix(k, prefix) {
+					return ErrNotFound
+				}
+				results = append(results, &blockstore.Entry{
+					BlockHash:   common.BytesToHash(k[8:]),
+					BlockNumber: i,
+					Value:       bytes.Clone(v),
+				})
+			}
+			return nil
+		default:
+			return errors.New("unknown query")
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (s *Diskblock) GetPartial(_ context.Context, chain *config.Chain, typ blockstore.EntryType, query blockstore.QueryRange) ([]*blockstore.Entry, error) {
+	if query.End < query.Start {
+		return nil, nil
+	}
+	var results []*blockstore.Entry
+	err := s.db.View(func(tx *bolt.Tx) error {
+		cb := tx.Bucket([]byte(chain.Name))
+		if cb == nil {
+			return nil
+		}
+		entries := cb.Bucket(entriesBucket(typ))
+		if entries == nil {
+			return nil
+		}
+
+		c := entries.Cursor()
+		var last []byte
+		end := numberKey(query.End)
+		for k, v := c.Seek(numberKey(query.Start)); k != nil && bytes.Compare(k[:8], end) <= 0; k, v = c.Next() {
+			// only one entry per block, there should not be more than one but just in case
+			if bytes.Equal(k[:8], last) {
+				continue
+			}
+			last = bytes.Clone(k[:8])
+			results = append(results, &blockstore.Entry{
+				BlockHash:   common.BytesToHash(k[8:]),
+				BlockNumber: hexutil.Uint64(binary.BigEndian.Uint64(k[:8])),
+				Value:       bytes.Clone(v),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (s *Diskblock) Put(ctx context.Context, chain *config.Chain, typ blockstore.EntryType, entries ...*blockstore.Entry) error {
+	heads, err := s.headstore.GetHeads(ctx, chain)
+	if err != nil || heads.Latest == 0 {
+		// without a head we cannot know which entries are final
+		return nil
+	}
+	head := heads.Latest
+
+	final := make([]*blockstore.Entry, 0, len(entries))
+	for _, entry := range entries {
+		// the finalized head is used once it is known, and the finality depth otherwise
+		if heads.Finalized > 0 {
+			if entry.BlockNumber > heads.Finalized {
+				continue
+			}
+		} else if int64(head)-int64(entry.BlockNumber) < int64(s.cfg.FinalityDepth) {
+			continue
+		}
+		if s.cfg.Retention > 0 && int64(head)-int64(entry.BlockNumber) > int64(s.cfg.Retention) {
+			continue
+		}
+		final = append(final, entry)
+	}
+	if len(final) == 0 {
+		return nil
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		cb, err := tx.CreateBucketIfNotExists([]byte(chain.Name))
+		if err != nil {
+			return err
+		}
+		entriesB, err := cb.CreateBucketIfNotExists(entriesBucket(typ))
+		if err != nil {
+			return err
+		}
+		hashesB, err := cb.CreateBucketIfNotExists(hashesBucket(typ))
+		if err != nil {
+			return err
+		}
+
+		c := entriesB.Cursor()
+		for _, entry := range final {
+			// entries past finality should never change, but if they do the old one must go
+			prefix := numberKey(entry.BlockNumber)
+			var stale [][]byte
+			for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+				if !bytes.Equal(k[8:], entry.BlockHash.Bytes()) {
+					stale = append(stale, bytes.Clone(k))
+				}
+			}
+			for _, k := range stale {
+				s.log.Warn("replacing finalized entry", "chain", chain.Name, "type", typ, "number", uint64(entry.BlockNumber), "old", common.BytesToHash(k[8:]), "new", entry.BlockHash)
+				if err := hashesB.Delete(k[8:]); err != nil {
+					return err
+				}
+				if err := entriesB.Delete(k); err != nil {
+					return err
+				}
+			}
+
+			if err := entriesB.Put(entryKey(entry.BlockNumber, entry.BlockHash), entry.Value); err != nil {
+				return err
+			}
+			// entries for blocks without logs have no hash
+			if entry.BlockHash == (common.Hash{}) {
+				continue
+			}
+			if err := hashesB.Put(entry.BlockHash.Bytes(), prefix); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Invalidate removes the entries of every type for the blocks in the range. entries are only stored once they are past
+// the finality depth, so this only does anything for reorgs deeper than that.
+func (s *Diskblock) Invalidate(_ context.Context, chain *config.Chain, query blockstore.QueryRange) error {
+	if query.End < query.Start {
+		return nil
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		cb := tx.Bucket([]byte(chain.Name))
+		if cb == nil {
+			return nil
+		}
+		end := numberKey(query.End)
+		for typ := blockstore.EntryType(0); typ < blockstore.EntryTypeCount; typ++ {
+			entries := cb.Bucket(entriesBucket(typ))
+			hashes := cb.Bucket(hashesBucket(typ))
+			if entries == nil || hashes == nil {
+				continue
+			}
+			var stale [][]byte
+			c := entries.Cursor()
+			for k, _ := c.Seek(numberKey(query.Start)); k != nil && bytes.Compare(k[:8], end) <= 0; k, _ = c.Next() {
+				stale = append(stale, bytes.Clone(k))
+			}
+			for _, k := range stale {
+				s.log.Warn("invalidating finalized entry", "chain", chain.Name, "type", typ, "number", binary.BigEndian.Uint64(k[:8]), "hash", common.BytesToHash(k[8:]))
+				if err := hashes.Delete(k[8:]); err != nil {
+					return err
+				}
+				if err := entries.Delete(k); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Diskblock) pruneLoop(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.PruneInterval.Duration)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.prune(ctx); err != nil {
+				s.log.Error("failed to prune diskstore", "err", err)
+			}
+		}
+	}
+}
+
+// prune removes entries which are older than the retention depth, then removes the oldest entries of every chain until
+// the store is within its size limit.
+func (s *Diskblock) prune(ctx context.Context) error {
+	if s.cfg.Retention > 0 {
+		for _, chain := range s.chains {
+			head, err := s.headstore.Get(ctx, chain)
+			if err != nil || head == 0 || int64(head) <= int64(s.cfg.Retention) {
+				continue
+			}
+			if _, err := s.deleteBelow(chain.Name, hexutil.Uint64(int64(head)-int64(s.cfg.Retention)), -1); err != nil {
+				return err
+			}
+		}
+	}
+
+	if s.cfg.MaxSizeMB <= 0 {
+		return nil
+	}
+	limit := int64(s.cfg.MaxSizeMB) << 20
+	for {
+		size, err := s.size()
+		if err != nil {
+			return err
+		}
+		if size <= limit {
+			return nil
+		}
+		s.log.Debug("diskstore over size limit", "size", size, "limit", limit)
+
+		var removed int
+		for name := range s.chains {
+			n, err := s.deleteBelow(name, hexutil.Uint64(^uint64(0)), pruneBatch)
+			if err != nil {
+				return err
+			}
+			removed += n
+		}
+		if removed == 0 {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// size returns the number of bytes in use by the database. bbolt never shrinks its file, so pages which were freed by
+// pruning are not counted.
+func (s *Diskblock) size() (int64, error) {
+	var size int64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		stats := s.db.Stats()
+		size = tx.Size() - int64(stats.FreePageN+stats.PendingPageN)*int64(s.db.Info().PageSize)
+		return nil
+	})
+	return size, err
+}
+
+// deleteBelow removes the entries of every type below the block number for the chain. if limit is not negative, at
+// most limit distinct blocks are removed per entry type. it returns the number of entries removed.
+func (s *Diskblock) deleteBelow(chain string, number hexutil.Uint64, limit int) (int, error) {
+	var removed int
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		cb := tx.Bucket([]byte(chain))
+		if cb == nil {
+			return nil
+		}
+		for typ := blockstore.EntryType(0); typ < blockstore.EntryTypeCount; typ++ {
+			entries := cb.Bucket(entriesBucket(typ))
+			hashes := cb.Bucket(hashesBucket(typ))
+			if entries == nil || hashes == nil {
+				continue
+			}
+			end := numberKey(number)
+			c := entries.Cursor()
+			var blocks int
+			var last []byte
+			for k, _ := c.First(); k != nil && bytes.Compare(k[:8], end) < 0; k, _ = c.First() {
+				k = bytes.Clone(k)
+				if !bytes.Equal(k[:8], last) {
+					if limit >= 0 && blocks >= limit {
+						break
+					}
+					blocks++
+					last = k[:8]
+				}
+				if err := hashes.Delete(k[8:]); err != nil {
+					return err
+				}
+				if err := entries.Delete(k); err != nil {
+					return err
+				}
+				removed++
+			}
+		}
+		return nil
+	})
+	return removed, err
+}
+
+var _ blockstore.Store = (*Diskblock)(nil)
+var _ blockstore.PartialStore = (*Diskblock)(nil)
+var _ blockstore.Invalidator = (*Diskblock)(nil)
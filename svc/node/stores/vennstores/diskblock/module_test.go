@@ -0,0 +1,200 @@
+package diskblock
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx/fxtest"
+
+	"github.com/gfx-labs/venn/lib/config"
+	"github.com/gfx-labs/venn/lib/stores/blockstore"
+	"github.com/gfx-labs/venn/lib/stores/headstore"
+)
+
+var testChain = &config.Chain{Name: "test"}
+
+// newTestDiskblock opens a store in a temporary directory, with the chain at head
+func newTestDiskblock(t *testing.T, cfg config.Diskstore, head hexutil.Uint64) (*Diskblock, *headstore.Atomic) {
+	cfg.Path = filepath.Join(t.TempDir(), "venn.db")
+	cfg.PruneInterval = config.Duration{Duration: time.Hour}
+	heads := headstore.NewAtomic()
+	_, err := heads.Put(context.Background(), testChain, head)
+	require.NoError(t, err)
+
+	lc := fxtest.NewLifecycle(t)
+	r, err := New(Params{
+		Config:    &cfg,
+		Chains:    map[string]*config.Chain{testChain.Name: testChain},
+		Headstore: heads,
+		Log:       slog.New(slog.NewJSONHandler(io.Discard, nil)),
+		Lc:        lc,
+	})
+	require.NoError(t, err)
+	lc.RequireStart()
+	t.Cleanup(lc.RequireStop)
+	return r.Diskblock, heads
+}
+
+func testEntry(number hexutil.Uint64, value string) *blockstore.Entry {
+	hash := common.Hash{1}
+	hash[31] = byte(number)
+	hash[30] = byte(number >> 8)
+	return &blockstore.Entry{
+		BlockHash:   hash,
+		BlockNumber: number,
+		Value:       []byte(value),
+	}
+}
+
+func putRange(t *testing.T, s *Diskblock, typ blockstore.EntryType, start, end hexutil.Uint64, value string) {
+	var entries []*blockstore.Entry
+	for i := start; i <= end; i++ {
+		entries = append(entries, testEntry(i, value))
+	}
+	require.NoError(t, s.Put(context.Background(), testChain, typ, entries...))
+}
+
+// stored returns the block numbers held for the entry type, in order
+func stored(t *testing.T, s *Diskblock, typ blockstore.EntryType) []hexutil.Uint64 {
+	entries, err := s.GetPartial(context.Background(), testChain, typ, blockstore.QueryRange{Start: 0, End: 1 << 20})
+	require.NoError(t, err)
+	var numbers []hexutil.Uint64
+	for _, entry := range entries {
+		numbers = append(numbers, entry.BlockNumber)
+	}
+	return numbers
+}
+
+func numbers(start, end hexutil.Uint64) []hexutil.Uint64 {
+	var out []hexutil.Uint64
+	for i := start; i <= end; i++ {
+		out = append(out, i)
+	}
+	return out
+}
+
+func TestDiskblock_Get(t *testing.T) {
+	s, _ := newTestDiskblock(t, config.Diskstore{FinalityDepth: 10}, 100)
+	putRange(t, s, blockstore.EntryBlockHeader, 50, 60, `{}`)
+
+	entries, err := s.Get(context.Background(), testChain, blockstore.EntryBlockHeader, blockstore.QueryRange{Start: 52, End: 54})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.Equal(t, testEntry(53, `{}`), entries[1])
+
+	entries, err = s.Get(context.Background(), testChain, blockstore.EntryBlockHeader, blockstore.QueryHash(testEntry(55, "").BlockHash))
+	require.NoError(t, err)
+	require.Equal(t, []*blockstore.Entry{testEntry(55, `{}`)}, entries)
+
+	// a range with a block which is not held fails as a whole, or is skipped over with GetPartial
+	_, err = s.Get(context.Background(), testChain, blockstore.EntryBlockHeader, blockstore.QueryRange{Start: 59, End: 61})
+	require.ErrorIs(t, err, ErrNotFound)
+	entries, err = s.GetPartial(context.Background(), testChain, blockstore.EntryBlockHeader, blockstore.QueryRange{Start: 59, End: 61})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	_, err = s.Get(context.Background(), testChain, blockstore.EntryReceipts, blockstore.QueryNumber(55))
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestDiskblock_FinalityGate(t *testing.T) {
+	s, heads := newTestDiskblock(t, config.Diskstore{FinalityDepth: 10}, 100)
+
+	// without a finalized head, entries are stored once they are the finality depth behind the head
+	putRange(t, s, blockstore.EntryBlockHeader, 85, 99, `{}`)
+	require.Equal(t, numbers(85, 90), stored(t, s, blockstore.EntryBlockHeader))
+
+	// once the finalized head is known, it is used instead
+	require.NoError(t, heads.PutFinality(context.Background(), testChain, 94, 93))
+	putRange(t, s, blockstore.EntryBlockHeader, 85, 99, `{}`)
+	require.Equal(t, numbers(85, 93), stored(t, s, blockstore.EntryBlockHeader))
+}
+
+func TestDiskblock_NoHead(t *testing.T) {
+	s, _ := newTestDiskblock(t, config.Diskstore{}, 0)
+
+	// without a head nothing can be known to be final
+	putRange(t, s, blockstore.EntryBlockHeader, 1, 10, `{}`)
+	require.Empty(t, stored(t, s, blockstore.EntryBlockHeader))
+}
+
+func TestDiskblock_ReplaceFinalized(t *testing.T) {
+	s, _ := newTestDiskblock(t, config.Diskstore{}, 100)
+	putRange(t, s, blockstore.EntryBlockHeader, 50, 50, `{"a":1}`)
+
+	// a different block at the same number replaces the old one, which can no longer be found by hash
+	replaced := &blockstore.Entry{BlockHash: common.Hash{2}, BlockNumber: 50, Value: []byte(`{"a":2}`)}
+	require.NoError(t, s.Put(context.Background(), testChain, blockstore.EntryBlockHeader, replaced))
+	entries, err := s.Get(context.Background(), testChain, blockstore.EntryBlockHeader, blockstore.QueryNumber(50))
+	require.NoError(t, err)
+	require.Equal(t, []*blockstore.Entry{replaced}, entries)
+	_, err = s.Get(context.Background(), testChain, blockstore.EntryBlockHeader, blockstore.QueryHash(testEntry(50, "").BlockHash))
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestDiskblock_Retention(t *testing.T) {
+	s, heads := newTestDiskblock(t, config.Diskstore{Retention: 20}, 100)
+
+	// entries past the retention are not stored at all
+	putRange(t, s, blockstore.EntryBlockHeader, 70, 90, `{}`)
+	putRange(t, s, blockstore.EntryReceipts, 70, 90, `[]`)
+	require.Equal(t, numbers(80, 90), stored(t, s, blockstore.EntryBlockHeader))
+
+	// and are pruned once the head moves past them
+	_, err := heads.Put(context.Background(), testChain, 105)
+	require.NoError(t, err)
+	require.NoError(t, s.prune(context.Background()))
+	require.Equal(t, numbers(85, 90), stored(t, s, blockstore.EntryBlockHeader))
+	require.Equal(t, numbers(85, 90), stored(t, s, blockstore.EntryReceipts))
+	_, err = s.Get(context.Background(), testChain, blockstore.EntryBlockHeader, blockstore.QueryHash(testEntry(84, "").BlockHash))
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestDiskblock_MaxSize(t *testing.T) {
+	s, _ := newTestDiskblock(t, config.Diskstore{MaxSizeMB: 1}, 10000)
+
+	// about 2mb of entries, of which only the newest fit. blocks are pruned pruneBatch at a time, which is a fraction of
+	// the limit
+	value := `"` + strings.Repeat("a", 50) + `"`
+	for start := hexutil.Uint64(1); start <= 8*pruneBatch; start += pruneBatch {
+		putRange(t, s, blockstore.EntryBlockHeader, start, start+pruneBatch-1, value)
+	}
+	size, err := s.size()
+	require.NoError(t, err)
+	require.Greater(t, size, int64(1<<20))
+
+	require.NoError(t, s.prune(context.Background()))
+	size, err = s.size()
+	require.NoError(t, err)
+	require.LessOrEqual(t, size, int64(1<<20))
+
+	// the oldest blocks went first
+	left := stored(t, s, blockstore.EntryBlockHeader)
+	require.NotEmpty(t, left)
+	require.Less(t, len(left), 8*pruneBatch)
+	require.Equal(t, numbers(left[0], 8*pruneBatch), left)
+}
+
+func TestDiskblock_Invalidate(t *testing.T) {
+	s, _ := newTestDiskblock(t, config.Diskstore{}, 100)
+	putRange(t, s, blockstore.EntryBlockHeader, 50, 60, `{}`)
+	putRange(t, s, blockstore.EntryLogs, 50, 60, `[]`)
+
+	require.NoError(t, s.Invalidate(context.Background(), testChain, blockstore.QueryRange{Start: 55, End: 57}))
+	for _, typ := range []blockstore.EntryType{blockstore.EntryBlockHeader, blockstore.EntryLogs} {
+		require.Equal(t, append(numbers(50, 54), numbers(58, 60)...), stored(t, s, typ))
+		_, err := s.Get(context.Background(), testChain, typ, blockstore.QueryHash(testEntry(56, "").BlockHash))
+		require.ErrorIs(t, err, ErrNotFound)
+	}
+
+	// the blocks can be stored again, as those of the new fork
+	putRange(t, s, blockstore.EntryBlockHeader, 55, 57, `{}`)
+	require.Equal(t, numbers(50, 60), stored(t, s, blockstore.EntryBlockHeader))
+}
@@ -2,10 +2,12 @@ package rediblock
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"math"
+	"time"
 
 	"gfx.cafe/util/go/generic"
 	"github.com/ethereum/go-ethereum/common"
@@ -15,15 +17,17 @@ import (
 
 	"github.com/gfx-labs/venn/lib/config"
 	"github.com/gfx-labs/venn/lib/stores/blockstore"
+	"github.com/gfx-labs/venn/lib/stores/headstore"
 	"github.com/gfx-labs/venn/svc/shared/services/redi"
 )
 
 type Params struct {
 	fx.In
 
-	Chains map[string]*config.Chain
-	Log    *slog.Logger
-	Redi   *redi.Redis
+	Chains    map[string]*config.Chain
+	Log       *slog.Logger
+	Redi      *redi.Redis
+	Headstore headstore.Store
 }
 
 type Result struct {
@@ -33,8 +37,9 @@ type Result struct {
 }
 
 type Rediblock struct {
-	log  *slog.Logger
-	redi *redi.Redis
+	log       *slog.Logger
+	redi      *redi.Redis
+	headstore headstore.Store
 }
 
 func New(params Params) (r Result, err error) {
@@ -43,8 +48,9 @@ func New(params Params) (r Result, err error) {
 		return
 	}
 	r.Rediblock = &Rediblock{
-		log:  params.Log,
-		redi: params.Redi,
+		log:       params.Log,
+		redi:      params.Redi,
+		headstore: params.Headstore,
 	}
 	return r, nil
 }
@@ -71,9 +77,11 @@ var addEntriesScript = redis.NewScript(`
 	end
 
 	local secondsPerBlock = ARGV[1]
+	local finalized = tonumber(ARGV[2])
+	local finalizedTTL = tonumber(ARGV[3])
 
 	local i = 2
-	local j = 2
+	local j = 4
 	while true do
 		local byHashValue = KEYS[i]
 		local byHashNumber = KEYS[i+1]
@@ -95,18 +103,26 @@ var addEntriesScript = redis.NewScript(`
 			redis.call('SET', KEYS[1], number)
 		end
 
-		local behind = (head - number) + 1
-		if behind < 1 then
-			behind = 1
-		end
-
-		local exp = math.floor(behind * secondsPerBlock)
-		if exp < 1 then
-			exp = 1
-		end
-
-		if exp > 3600 then
-		  exp = 3600
+		local exp
+		if finalized > 0 and number <= finalized then
+			-- finalized entries never change
+			exp = finalizedTTL
+		else
+			-- entries which are not finalized yet expire sooner the closer they are to the head, as they are more likely
+			-- to be reorged. once the finalized head is known, they are never kept longer than it takes to finalize them
+			local behind = (head - number) + 1
+			if behind < 1 then
+				behind = 1
+			end
+
+			exp = math.floor(behind * secondsPerBlock)
+			if exp < 1 then
+				exp = 1
+			end
+
+			if finalized == 0 and exp > 3600 then
+				exp = 3600
+			end
 		end
 
 		redis.call('SETEX', byHashValue, exp, value)
@@ -118,6 +134,31 @@ var addEntriesScript = redis.NewScript(`
 	return head
 `)
 
+const (
+	// indexTTL is how long state query results and the transaction index are held for blocks which are not finalized,
+	// matching the longest such entries are held before the finalized head is known
+	indexTTL = time.Hour
+	// finalizedTTL is how long entries, state query results and the transaction index are held for finalized blocks
+	finalizedTTL = 24 * time.Hour
+)
+
+// ttl returns how long the index entries of the block are held
+func (s *Rediblock) ttl(ctx context.Context, chain *config.Chain, number hexutil.Uint64) time.Duration {
+	var finalized hexutil.Uint64
+	if heads, err := s.headstore.GetHeads(ctx, chain); err == nil {
+		finalized = heads.Finalized
+	}
+	return indexTTLOf(finalized, number)
+}
+
+// indexTTLOf returns how long the index entries of the block are held, given the finalized head
+func indexTTLOf(finalized, number hexutil.Uint64) time.Duration {
+	if finalized > 0 && number <= finalized {
+		return finalizedTTL
+	}
+	return indexTTL
+}
+
 func (s *Rediblock) namespace(chain *config.Chain) string {
 	return s.redi.Namespace() + ":{" + chain.Name + "}"
 }
@@ -194,17 +235,143 @@ func (s *Rediblock) Get(ctx context.Context, chain *config.Chain, typ blockstore
 	}
 }
 
+func (s *Rediblock) GetPartial(ctx context.Context, chain *config.Chain, typ blockstore.EntryType, query blockstore.QueryRange) ([]*blockstore.Entry, error) {
+	if query.End < query.Start {
+		return nil, nil
+	}
+
+	pipeline := s.redi.C().Pipeline()
+
+	commands := make([]*redis.StringCmd, 0, (query.End-query.Start+1)*2)
+	for i := query.Start; i <= query.End; i++ {
+		commands = append(commands,
+			pipeline.Get(ctx,
+				fmt.Sprintf("%s:entries:by_number:%d:%d:value", s.namespace(chain), typ, uint64(i)),
+			),
+			pipeline.Get(ctx,
+				fmt.Sprintf("%s:entries:by_number:%d:%d:hash", s.namespace(chain), typ, uint64(i)),
+			),
+		)
+	}
+
+	// missing keys are expected, so only fail on other errors
+	if _, err := pipeline.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	var results []*blockstore.Entry
+	for i := 0; i < len(commands)/2; i++ {
+		// the error of a missing key is set on every command of the pipeline which follows it, so the value is checked
+		value := commands[i*2].Val()
+		if value == "" {
+			continue
+		}
+		results = append(results,
+			&blockstore.Entry{
+				BlockHash:   common.HexToHash(commands[i*2+1].Val()),
+				BlockNumber: query.Start + hexutil.Uint64(i),
+				Value:       []byte(value),
+			},
+		)
+	}
+
+	return results, nil
+}
+
+// reorg deletes every entry and state held by number. the stalker invalidates only the orphaned blocks, so this is only
+// the fallback for chains which are not stalked, where the depth of a reorg is not known
 func (s *Rediblock) reorg(ctx context.Context, chain *config.Chain) error {
 	s.log.Info("reorg detected", "chain", chain.Name)
 
-	keys, err := s.redi.C().Keys(ctx, fmt.Sprintf("%s:entries:by_number:*", s.namespace(chain))).Result()
-	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			err = nil
+	var keys []string
+	for _, pattern := range []string{"%s:entries:by_number:*", "%s:state:by_number:*"} {
+		found, err := s.redi.C().Keys(ctx, fmt.Sprintf(pattern, s.namespace(chain))).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		keys = append(keys, found...)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	return s.redi.C().Del(ctx, keys...).Err()
+}
+
+// Invalidate deletes the entries of every type for the blocks in the range, including the by hash entries of the
+// hashes stored for those blocks and the transaction index of their transactions
+func (s *Rediblock) Invalidate(ctx context.Context, chain *config.Chain, query blockstore.QueryRange) error {
+	if query.End < query.Start {
+		return nil
+	}
+
+	pipeline := s.redi.C().Pipeline()
+	hashes := make(map[blockstore.EntryType][]*redis.StringCmd, blockstore.EntryTypeCount)
+	for typ := blockstore.EntryType(0); typ < blockstore.EntryTypeCount; typ++ {
+		for i := query.Start; i <= query.End; i++ {
+			hashes[typ] = append(hashes[typ], pipeline.Get(ctx,
+				fmt.Sprintf("%s:entries:by_number:%d:%d:hash", s.namespace(chain), typ, uint64(i)),
+			))
 		}
+	}
+	// the entries which hold transactions, to find the transaction index keys written for them
+	values := make(map[blockstore.EntryType][]*redis.StringCmd, 2)
+	for _, typ := range []blockstore.EntryType{blockstore.EntryBlockHeader, blockstore.EntryReceipts} {
+		for i := query.Start; i <= query.End; i++ {
+			values[typ] = append(values[typ], pipeline.Get(ctx,
+				fmt.Sprintf("%s:entries:by_number:%d:%d:value", s.namespace(chain), typ, uint64(i)),
+			))
+		}
+	}
+	if _, err := pipeline.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
 		return err
 	}
 
+	keys := make([]string, 0, int(blockstore.EntryTypeCount)*int(query.End-query.Start+1)*4)
+	for typ, cmds := range hashes {
+		for i, cmd := range cmds {
+			number := uint64(query.Start) + uint64(i)
+			keys = append(keys,
+				fmt.Sprintf("%s:entries:by_number:%d:%d:value", s.namespace(chain), typ, number),
+				fmt.Sprintf("%s:entries:by_number:%d:%d:hash", s.namespace(chain), typ, number),
+			)
+			// the error of a missing key is set on every command of the pipeline which follows it, so the value is checked
+			hash := cmd.Val()
+			if hash == "" {
+				continue
+			}
+			keys = append(keys,
+				fmt.Sprintf("%s:entries:by_hash:%d:%s:value", s.namespace(chain), typ, hash),
+				fmt.Sprintf("%s:entries:by_hash:%d:%s:number", s.namespace(chain), typ, hash),
+			)
+		}
+	}
+
+	for i := query.Start; i <= query.End; i++ {
+		keys = append(keys, fmt.Sprintf("%s:state:by_number:%d", s.namespace(chain), uint64(i)))
+	}
+
+	txs := make(map[common.Hash]struct{})
+	for typ, cmds := range values {
+		for _, cmd := range cmds {
+			value := cmd.Val()
+			if value == "" {
+				continue
+			}
+			found, err := blockstore.EntryTxHashes(typ, &blockstore.Entry{Value: []byte(value)})
+			if err != nil {
+				continue
+			}
+			for _, hash := range found {
+				txs[hash] = struct{}{}
+			}
+		}
+	}
+	for hash := range txs {
+		keys = append(keys, fmt.Sprintf("%s:txs:%s", s.namespace(chain), hash.Hex()))
+	}
+
+	s.log.Debug("invalidating entries", "chain", chain.Name, "start", query.Start, "end", query.End)
 	return s.redi.C().Del(ctx, keys...).Err()
 }
 
@@ -216,20 +383,24 @@ func (s *Rediblock) Put(ctx context.Context, chain *config.Chain, typ blockstore
 		fmt.Sprintf("%s:head", s.namespace(chain)),
 	)
 
+	// without a finalized head, entries fall back to being held for at most an hour
+	var finalized hexutil.Uint64
+	if heads, err := s.headstore.GetHeads(ctx, chain); err == nil {
+		finalized = heads.Finalized
+	}
+
 	values = append(values,
 		int(math.Max(1, chain.BlockTimeSeconds)),
+		uint64(finalized),
+		int(finalizedTTL.Seconds()),
 	)
 
 	var reorgKeys []string
 	var reorgValues []any
 
 	for _, entry := range entries {
-		if entry.ParentHash != nil {
-			if reorgKeys == nil {
-				reorgKeys = make([]string, 0, len(entries))
-				reorgValues = make([]any, 0, len(entries))
-			}
-
+		// the stalker invalidates orphaned blocks of stalked chains
+		if !chain.ParsedStalk && entry.ParentHash != nil {
 			reorgKeys = append(reorgKeys,
 				fmt.Sprintf("%s:entries:by_number:%d:%d:hash", s.namespace(chain), typ, uint64(entry.BlockNumber-1)),
 			)
@@ -268,8 +439,96 @@ func (s *Rediblock) Put(ctx context.Context, chain *config.Chain, typ blockstore
 	if errors.Is(err, redis.Nil) {
 		err = nil
 	}
+	if err != nil {
+		return err
+	}
+
+	return s.indexTxs(ctx, chain, typ, finalized, entries...)
+}
+
+// indexTxs indexes the transactions of the entries by hash, held for as long as finalized allows. the index is best
+// effort, entries which can not be decoded are skipped.
+func (s *Rediblock) indexTxs(ctx context.Context, chain *config.Chain, typ blockstore.EntryType, finalized hexutil.Uint64, entries ...*blockstore.Entry) error {
+	pipeline := s.redi.C().Pipeline()
+	for _, entry := range entries {
+		ttl := indexTTLOf(finalized, entry.BlockNumber)
+		hashes, err := blockstore.EntryTxHashes(typ, entry)
+		if err != nil {
+			s.log.Debug("failed to index transactions", "chain", chain.Name, "block", entry.BlockNumber, "error", err)
+			continue
+		}
+		for i, hash := range hashes {
+			location, err := json.Marshal(blockstore.TxLocation{
+				BlockHash:   entry.BlockHash,
+				BlockNumber: entry.BlockNumber,
+				Index:       i,
+			})
+			if err != nil {
+				return err
+			}
+			pipeline.Set(ctx, fmt.Sprintf("%s:txs:%s", s.namespace(chain), hash.Hex()), location, ttl)
+		}
+	}
+	if pipeline.Len() == 0 {
+		return nil
+	}
+	_, err := pipeline.Exec(ctx)
+	return err
+}
+
+func (s *Rediblock) GetTx(ctx context.Context, chain *config.Chain, hash common.Hash) (*blockstore.TxLocation, error) {
+	raw, err := s.redi.C().Get(ctx, fmt.Sprintf("%s:txs:%s", s.namespace(chain), hash.Hex())).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	var location blockstore.TxLocation
+	if err := json.Unmarshal(raw, &location); err != nil {
+		return nil, err
+	}
+	return &location, nil
+}
+
+// stateKey returns the key of the hash holding the state query results of the block
+func (s *Rediblock) stateKey(chain *config.Chain, block blockstore.Query) (string, error) {
+	switch q := block.(type) {
+	case blockstore.QueryHash:
+		return fmt.Sprintf("%s:state:by_hash:%s", s.namespace(chain), common.Hash(q).Hex()), nil
+	case blockstore.QueryRange:
+		if q.Start != q.End {
+			return "", errors.New("state is held for a single block")
+		}
+		return fmt.Sprintf("%s:state:by_number:%d", s.namespace(chain), uint64(q.Start)), nil
+	default:
+		return "", errors.New("unknown query")
+	}
+}
+
+func (s *Rediblock) GetState(ctx context.Context, chain *config.Chain, block blockstore.Query, key string) (json.RawMessage, error) {
+	hash, err := s.stateKey(chain, block)
+	if err != nil {
+		return nil, err
+	}
+	return s.redi.C().HGet(ctx, hash, key).Bytes()
+}
 
+func (s *Rediblock) PutState(ctx context.Context, chain *config.Chain, block blockstore.Query, key string, value json.RawMessage) error {
+	hash, err := s.stateKey(chain, block)
+	if err != nil {
+		return err
+	}
+	pipeline := s.redi.C().Pipeline()
+	ttl := indexTTL
+	if q, ok := block.(blockstore.QueryRange); ok {
+		ttl = s.ttl(ctx, chain, q.Start)
+	}
+	pipeline.HSet(ctx, hash, key, []byte(value))
+	pipeline.Expire(ctx, hash, ttl)
+	_, err = pipeline.Exec(ctx)
 	return err
 }
 
 var _ blockstore.Store = (*Rediblock)(nil)
+var _ blockstore.PartialStore = (*Rediblock)(nil)
+var _ blockstore.Invalidator = (*Rediblock)(nil)
+var _ blockstore.StateStore = (*Rediblock)(nil)
+var _ blockstore.TxIndex = (*Rediblock)(nil)
@@ -0,0 +1,85 @@
+package rediblock
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx/fxtest"
+
+	"github.com/gfx-labs/venn/lib/config"
+	"github.com/gfx-labs/venn/lib/stores/blockstore"
+	"github.com/gfx-labs/venn/lib/stores/headstore"
+	"github.com/gfx-labs/venn/svc/shared/services/redi"
+)
+
+func newTestRediblock(t *testing.T) *Rediblock {
+	lc := fxtest.NewLifecycle(t)
+	log := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	res, err := redi.New(redi.RedisParams{
+		Log: log,
+		Config: &config.Redis{
+			Namespace: "test",
+		},
+		Lc: lc,
+	})
+	require.NoError(t, err)
+	lc.RequireStart()
+	t.Cleanup(lc.RequireStop)
+	r, err := New(Params{
+		Log:       log,
+		Redi:      res.Redis,
+		Headstore: headstore.NewAtomic(),
+	})
+	require.NoError(t, err)
+	return r.Rediblock
+}
+
+func TestRediblock_Invalidate(t *testing.T) {
+	s := newTestRediblock(t)
+	ctx := context.Background()
+	chain := &config.Chain{Name: "test", ParsedStalk: true}
+	tx := common.Hash{9}
+	require.NoError(t, s.Put(ctx, chain, blockstore.EntryBlockHeader, &blockstore.Entry{
+		BlockHash:   common.Hash{1},
+		BlockNumber: 5,
+		Value:       []byte(`{"number":"0x5","transactions":["` + tx.Hex() + `"]}`),
+	}))
+	_, err := s.GetTx(ctx, chain, tx)
+	require.NoError(t, err)
+
+	// the range starts before the block, so the first lookups of the pipeline find nothing
+	require.NoError(t, s.Invalidate(ctx, chain, blockstore.QueryRange{Start: 4, End: 6}))
+	_, err = s.Get(ctx, chain, blockstore.EntryBlockHeader, blockstore.QueryNumber(5))
+	require.Error(t, err)
+	_, err = s.Get(ctx, chain, blockstore.EntryBlockHeader, blockstore.QueryHash(common.Hash{1}))
+	require.Error(t, err)
+	_, err = s.GetTx(ctx, chain, tx)
+	require.Error(t, err)
+}
+
+func TestRediblock_GetPartial(t *testing.T) {
+	s := newTestRediblock(t)
+	ctx := context.Background()
+	chain := &config.Chain{Name: "test", ParsedStalk: true}
+	for _, number := range []hexutil.Uint64{5, 7} {
+		require.NoError(t, s.Put(ctx, chain, blockstore.EntryLogs, &blockstore.Entry{
+			BlockHash:   common.Hash{byte(number)},
+			BlockNumber: number,
+			Value:       []byte(`[]`),
+		}))
+	}
+
+	// the blocks which are held are found even after ones which are not
+	entries, err := s.GetPartial(ctx, chain, blockstore.EntryLogs, blockstore.QueryRange{Start: 4, End: 8})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, hexutil.Uint64(5), entries[0].BlockNumber)
+	require.Equal(t, common.Hash{5}, entries[0].BlockHash)
+	require.Equal(t, hexutil.Uint64(7), entries[1].BlockNumber)
+	require.Equal(t, common.Hash{7}, entries[1].BlockHash)
+}
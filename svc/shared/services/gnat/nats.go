@@ -22,7 +22,7 @@ type Gnat struct {
 type Params struct {
 	fx.In
 
-	Config *config.Nats
+	Config *config.Nats `optional:"true"`
 	Ctx    context.Context
 
 	Lc  fx.Lifecycle
@@ -37,6 +37,10 @@ type Result struct {
 }
 
 func New(p Params) (r Result, err error) {
+	if p.Config == nil {
+		p.Log.Info("nats disabled", "reason", "no nats config")
+		return
+	}
 	o := &Gnat{}
 	o.log = p.Log
 
@@ -66,6 +70,7 @@ func New(p Params) (r Result, err error) {
 		}
 		p.Lc.Append(fx.Hook{
 			OnStop: func(ctx context.Context) error {
+				ns.Shutdown()
 				ns.WaitForShutdown()
 				return nil
 			},
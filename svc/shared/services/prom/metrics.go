@@ -13,6 +13,11 @@ func init() {
 		&Gateway,
 		&RemoteHealth,
 		&ChainHealth,
+		&HeadOracle,
+		&Hedges,
+		&Subscriptions,
+		&Batches,
+		&Dedup,
 	} {
 		gotoprom.MustInit(v, "venn", nil)
 	}
@@ -25,10 +30,23 @@ type GatewayRequestLabel struct {
 	Success  bool   `label:"success"`
 }
 
+type GatewayUsageLabel struct {
+	Endpoint string `label:"endpoint"`
+	Limit    string `label:"limit"`
+}
+
+type GatewayKeyLabel struct {
+	Endpoint string `label:"endpoint"`
+	Key      string `label:"key"`
+}
+
 var Gateway struct {
 	RequestLatency      func(label GatewayRequestLabel) prometheus.Histogram `name:"gateway_request_latency_ms" help:"The total latency of each request in milliseconds" buckets:"1,10,50,100,250,500,1000,2000,5000,10000,50000"`
 	SubscriptionCreated func(label GatewayRequestLabel) prometheus.Counter   `name:"gateway_subscription_created" help:"The total number of subscriptions opened"`
 	SubscriptionClosed  func(label GatewayRequestLabel) prometheus.Counter   `name:"gateway_subscription_closed" help:"The total number of subscriptions closed"`
+	UsageOverSoft       func(label GatewayUsageLabel) prometheus.Counter     `name:"gateway_usage_over_soft" help:"The number of requests served past the soft threshold of a usage limit"`
+	UsageRejected       func(label GatewayUsageLabel) prometheus.Counter     `name:"gateway_usage_rejected" help:"The number of requests rejected past the hard threshold of a usage limit"`
+	KeyCost             func(label GatewayKeyLabel) prometheus.Counter       `name:"gateway_key_cost" help:"The total cost of the requests served for each api key"`
 }
 
 type RequestLabel struct {
@@ -56,10 +74,22 @@ type StalkerLabel struct {
 	Chain string `label:"chain"`
 }
 
+type StalkerRemoteLabel struct {
+	Chain  string `label:"chain"`
+	Remote string `label:"remote"`
+}
+
 var Stalker struct {
-	PropagationDelayMean  func(label StalkerLabel) prometheus.Gauge     `name:"propagation_delay_ms" help:"the mean propogation delay for the chain"`
-	BlockPropagationDelay func(label StalkerLabel) prometheus.Histogram `name:"block_propagation_delay_ms" help:"the delay of propogation for the blocks" buckets:"1,10,50,100,250,500,1000,2000,3000,4000,5000,6000,8000,9000,10000,12000,24000,30000"`
-	HeadBlock             func(label StalkerLabel) prometheus.Gauge     `name:"stalker_head_block" help:"the head block for the chain"`
+	PropagationDelayMean  func(label StalkerLabel) prometheus.Gauge           `name:"propagation_delay_ms" help:"the mean propogation delay for the chain"`
+	BlockPropagationDelay func(label StalkerLabel) prometheus.Histogram       `name:"block_propagation_delay_ms" help:"the delay of propogation for the blocks" buckets:"1,10,50,100,250,500,1000,2000,3000,4000,5000,6000,8000,9000,10000,12000,24000,30000"`
+	HeadBlock             func(label StalkerLabel) prometheus.Gauge           `name:"stalker_head_block" help:"the head block for the chain"`
+	Leader                func(label StalkerLabel) prometheus.Gauge           `name:"stalker_leader" help:"1 if this replica is stalking the chain"`
+	SafeBlock             func(label StalkerLabel) prometheus.Gauge           `name:"stalker_safe_block" help:"the safe head block for the chain"`
+	FinalizedBlock        func(label StalkerLabel) prometheus.Gauge           `name:"stalker_finalized_block" help:"the finalized head block for the chain"`
+	HeadLag               func(label StalkerLabel) prometheus.Gauge           `name:"stalker_head_lag_blocks" help:"how many blocks the stalker head trails the head oracle consensus"`
+	Reorgs                func(label StalkerLabel) prometheus.Counter         `name:"stalker_reorgs_total" help:"the number of reorgs detected by the stalker"`
+	ReorgDepth            func(label StalkerLabel) prometheus.Histogram       `name:"stalker_reorg_depth_blocks" help:"the number of blocks orphaned by each reorg" buckets:"1,2,3,4,5,6,8,12,16,32,64,128,256"`
+	PushLead              func(label StalkerRemoteLabel) prometheus.Histogram `name:"stalker_push_lead_ms" help:"how long before polling a remote pushed each head. negative if polling was first" buckets:"-5000,-1000,-500,-250,-100,-50,0,50,100,250,500,1000,2000,5000,10000"`
 }
 
 type RemoteHealthLabel struct {
@@ -72,6 +102,14 @@ var RemoteHealth struct {
 	CheckLatency         func(label RemoteHealthLabel) prometheus.Histogram `name:"remote_health_check_latency_ms" help:"Latency of health checks in milliseconds" buckets:"1,10,50,100,250,500,1000,2000,5000,10000,30000"`
 	CheckFailures        func(label RemoteHealthLabel) prometheus.Counter   `name:"remote_health_check_failures_total" help:"Total number of health check failures"`
 	LastSuccessTimestamp func(label RemoteHealthLabel) prometheus.Gauge     `name:"remote_health_last_success_timestamp" help:"Timestamp of last successful health check"`
+	CircuitState         func(label RemoteHealthLabel) prometheus.Gauge     `name:"remote_circuit_state" help:"Circuit breaker state of remote endpoint: 0=closed, 1=half-open, 2=open, 3=rate-limited"`
+	CircuitTransitions   func(label CircuitLabel) prometheus.Counter        `name:"remote_circuit_transitions_total" help:"Total number of circuit breaker state changes, by the state changed to"`
+}
+
+type CircuitLabel struct {
+	Chain  string `label:"chain"`
+	Remote string `label:"remote"`
+	State  string `label:"state"`
 }
 
 type ChainHealthLabel struct {
@@ -84,3 +122,52 @@ var ChainHealth struct {
 	TotalRemoteCount    func(label ChainHealthLabel) prometheus.Gauge `name:"chain_total_remote_count" help:"Total number of configured remotes for the chain"`
 	RequestSuccessRate  func(label ChainHealthLabel) prometheus.Gauge `name:"chain_request_success_rate" help:"Success rate of requests to the chain (rolling average)"`
 }
+
+type HeadOracleLabel struct {
+	Chain string `label:"chain"`
+}
+
+var HeadOracle struct {
+	Consensus    func(label HeadOracleLabel) prometheus.Gauge   `name:"head_oracle_consensus" help:"the head block reported by the head oracle consensus"`
+	Failures     func(label HeadOracleLabel) prometheus.Counter `name:"head_oracle_failures_total" help:"Total number of failed head oracle queries"`
+	RemoteLag    func(label RemoteHealthLabel) prometheus.Gauge `name:"remote_head_lag_blocks" help:"how many blocks the remote trails the head oracle consensus"`
+	RemoteBehind func(label RemoteHealthLabel) prometheus.Gauge `name:"remote_head_behind" help:"1 if the remote trails the head oracle consensus by more than the lag threshold, otherwise 0"`
+}
+
+type HedgeLabel struct {
+	Chain  string `label:"chain"`
+	Method string `label:"method"`
+}
+
+var Hedges struct {
+	Hedged func(label HedgeLabel) prometheus.Counter `name:"hedged_requests_total" help:"Total number of requests which were also sent to a second remote"`
+	Wins   func(label HedgeLabel) prometheus.Counter `name:"hedged_request_wins_total" help:"Total number of hedged requests where the second remote answered first"`
+}
+
+type BatchLabel struct {
+	Chain  string `label:"chain"`
+	Remote string `label:"remote"`
+}
+
+var Batches struct {
+	Size func(label BatchLabel) prometheus.Histogram `name:"remote_batch_size" help:"The number of requests in each batch sent to a remote" buckets:"1,2,4,8,16,32,64,128"`
+}
+
+type SubscriptionLabel struct {
+	Chain string `label:"chain"`
+}
+
+var Subscriptions struct {
+	HeadSubscribers func(label SubscriptionLabel) prometheus.Gauge     `name:"head_subscribers" help:"The number of newHeads subscribers"`
+	HeadLag         func(label SubscriptionLabel) prometheus.Histogram `name:"head_subscriber_lag_blocks" help:"How many headers a newHeads subscriber was behind when it was notified" buckets:"0,1,2,4,8,16,32,64"`
+	HeadDropped     func(label SubscriptionLabel) prometheus.Counter   `name:"head_subscribers_dropped_total" help:"The number of newHeads subscribers disconnected for falling too far behind"`
+}
+
+type DedupLabel struct {
+	Chain  string `label:"chain"`
+	Method string `label:"method"`
+}
+
+var Dedup struct {
+	Hits func(label DedupLabel) prometheus.Counter `name:"dedup_hits_total" help:"Total number of requests which shared the result of an identical request already in flight"`
+}